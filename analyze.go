@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Bytes read from the start and the middle of each file
+	stealthSample = 64 * 1024
+
+	// Above this many bits per byte a sample looks like random data.
+	// Compressed files come close, plain data stays well below.
+	randomEntropy = 7.9
+
+	// Files smaller than this are too short for a meaningful entropy
+	minEntropySize = 4096
+)
+
+// Finding kinds double as translation keys. Each kind adds its points once
+// per finding, up to its cap.
+var stealthCaps = map[string]int{
+	"stealth_tool_file":    60,
+	"stealth_executable":   30,
+	"stealth_tool_names":   30,
+	"stealth_random":       30,
+	"stealth_random_share": 20,
+	"stealth_magic":        20,
+	"stealth_name_cluster": 20,
+	"stealth_size_cluster": 20,
+	"stealth_size_odd":     10,
+	"stealth_time_cluster": 15,
+	"stealth_time_future":  10,
+}
+
+// magicTypes maps file signatures to the extensions that should carry them
+var magicTypes = []struct {
+	name       string
+	offset     int
+	magic      []byte
+	exts       []string
+	compressed bool
+}{
+	{"jpeg", 0, []byte{0xFF, 0xD8, 0xFF}, []string{".jpg", ".jpeg"}, true},
+	{"png", 0, []byte("\x89PNG\r\n\x1a\n"), []string{".png"}, true},
+	{"gif", 0, []byte("GIF8"), []string{".gif"}, true},
+	{"zip", 0, []byte("PK\x03\x04"), []string{".zip", ".docx", ".xlsx", ".pptx", ".odt", ".jar", ".apk", ".epub"}, true},
+	{"gzip", 0, []byte{0x1F, 0x8B}, []string{".gz", ".tgz"}, true},
+	{"7z", 0, []byte{0x37, 0x7A, 0xBC, 0xAF, 0x27, 0x1C}, []string{".7z"}, true},
+	{"rar", 0, []byte("Rar!"), []string{".rar"}, true},
+	{"mp4", 4, []byte("ftyp"), []string{".mp4", ".mov", ".m4a", ".heic", ".3gp"}, true},
+	{"pdf", 0, []byte("%PDF"), []string{".pdf"}, true},
+	{"sqlite", 0, []byte("SQLite format 3\x00"), []string{".sqlite", ".db"}, false},
+	{"ole", 0, []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}, []string{".doc", ".xls", ".ppt", ".msi", ".db"}, false},
+	{"exe", 0, []byte("MZ"), []string{".exe", ".dll"}, true},
+}
+
+// Suffixes of unfinished downloads; their content is whatever was being
+// downloaded, usually compressed
+var partialSuffixes = []string{".crdownload", ".part", ".opdownload", ".download", ".partial"}
+
+// toolChunkPattern matches the default chunk names of this program
+var toolChunkPattern = func() *regexp.Regexp {
+	exts := append([]string(nil), chunkExtensions...)
+	for _, e := range wrapExtensions {
+		exts = append(exts, e...)
+	}
+	for i, e := range exts {
+		exts[i] = regexp.QuoteMeta(e)
+	}
+	return regexp.MustCompile(`^(?:~\$|~|\.|\.~|\$|\._)(?:[0-9a-f]{8,16}|[0-9]{1,6})(?:` + strings.Join(exts, "|") + `)$`)
+}()
+
+var nameShapePattern = regexp.MustCompile(`[0-9A-Fa-f]{4,}|[0-9]+`)
+
+// StealthFinding is one thing that makes the drive stand out
+type StealthFinding struct {
+	Kind   string
+	Path   string
+	Detail string
+}
+
+// StealthReport is what an adversary would notice about a drive. Score
+// runs from 0 (ordinary) to 100 (obviously hiding something).
+type StealthReport struct {
+	Drive    string
+	Files    int
+	Bytes    int64
+	Score    int
+	Entropy  [8]int
+	Findings []StealthFinding
+}
+
+type stealthFile struct {
+	rel     string
+	size    int64
+	mod     time.Time
+	entropy float64
+	magic   string
+	random  bool
+}
+
+// AnalyzeDrive inspects a drive the way someone looking for hidden data
+// would and reports what stands out
+func AnalyzeDrive(dev Device, progress ProgressFunc) (*StealthReport, error) {
+	var paths []string
+	err := filepath.Walk(dev.Path, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &StealthReport{Drive: dev.Path}
+	var files []stealthFile
+
+	for i, p := range paths {
+		if progress != nil {
+			progress(int64(i), int64(len(paths)), T("stealth_analyzing"))
+		}
+		f, ok := inspectFile(dev.Path, p)
+		if !ok {
+			continue
+		}
+		files = append(files, f)
+		report.Files++
+		report.Bytes += f.size
+		if f.size >= minEntropySize {
+			report.Entropy[min(7, int(f.entropy))]++
+		}
+	}
+
+	report.checkToolFiles(files)
+	report.checkContent(files)
+	report.checkNames(files)
+	report.checkSizes(files)
+	report.checkTimes(files)
+
+	points := make(map[string]int)
+	for _, f := range report.Findings {
+		points[f.Kind] = min(stealthCaps[f.Kind], points[f.Kind]+stealthPoints(f.Kind))
+	}
+	for _, p := range points {
+		report.Score += p
+	}
+	report.Score = min(100, report.Score)
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return stealthPoints(report.Findings[i].Kind) > stealthPoints(report.Findings[j].Kind)
+	})
+
+	if progress != nil {
+		progress(int64(len(paths)), int64(len(paths)), T("done"))
+	}
+	return report, nil
+}
+
+// stealthPoints is what a single finding of kind adds to the score
+func stealthPoints(kind string) int {
+	switch kind {
+	case "stealth_tool_file", "stealth_executable":
+		return 30
+	case "stealth_random_share", "stealth_tool_names", "stealth_time_cluster":
+		return 15
+	case "stealth_name_cluster", "stealth_size_cluster":
+		return 10
+	case "stealth_magic":
+		return 5
+	}
+	return 3
+}
+
+func inspectFile(root, p string) (stealthFile, bool) {
+	fh, err := os.Open(p)
+	if err != nil {
+		return stealthFile{}, false
+	}
+	defer fh.Close()
+
+	info, err := fh.Stat()
+	if err != nil {
+		return stealthFile{}, false
+	}
+
+	rel, _ := filepath.Rel(root, p)
+	f := stealthFile{rel: filepath.ToSlash(rel), size: info.Size(), mod: info.ModTime()}
+
+	head := make([]byte, stealthSample)
+	n, _ := io.ReadFull(fh, head)
+	head = head[:n]
+	f.magic = detectMagic(head)
+
+	sample := head
+	if f.size > 2*stealthSample {
+		mid := make([]byte, stealthSample)
+		if m, _ := fh.ReadAt(mid, f.size/2); m > 0 {
+			sample = append(sample, mid[:m]...)
+		}
+	}
+	f.entropy = shannonEntropy(sample)
+	f.random = f.size >= minEntropySize && f.entropy >= randomEntropy
+	return f, true
+}
+
+func shannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	e := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(data))
+			e -= p * math.Log2(p)
+		}
+	}
+	return e
+}
+
+func detectMagic(head []byte) string {
+	for _, t := range magicTypes {
+		if len(head) >= t.offset+len(t.magic) && bytes.Equal(head[t.offset:t.offset+len(t.magic)], t.magic) {
+			return t.name
+		}
+	}
+	return ""
+}
+
+// contentExt returns the extension describing the content of name, looking
+// through unfinished download suffixes
+func contentExt(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	partial := false
+	for _, s := range partialSuffixes {
+		if strings.HasSuffix(lower, s) {
+			lower = strings.TrimSuffix(lower, s)
+			partial = true
+			break
+		}
+	}
+	return path.Ext(lower), partial
+}
+
+func (r *StealthReport) add(kind, p, detail string) {
+	r.Findings = append(r.Findings, StealthFinding{Kind: kind, Path: p, Detail: detail})
+}
+
+// checkToolFiles looks for the files this program leaves behind
+func (r *StealthReport) checkToolFiles(files []stealthFile) {
+	exe := ""
+	if p, err := os.Executable(); err == nil {
+		exe = strings.ToLower(filepath.Base(p))
+	}
+
+	for _, f := range files {
+		switch f.rel {
+		case ManifestFile, JournalFile, ExcludeFile:
+			r.add("stealth_tool_file", f.rel, "")
+			continue
+		}
+
+		base := strings.ToLower(path.Base(f.rel))
+		if strings.HasPrefix(base, "unfuckable") || base == exe {
+			r.add("stealth_executable", f.rel, "")
+		}
+	}
+}
+
+// checkContent compares what files contain with what their names promise
+func (r *StealthReport) checkContent(files []stealthFile) {
+	var randomBytes int64
+
+	for _, f := range files {
+		ext, partial := contentExt(path.Base(f.rel))
+
+		var expected []string
+		for _, t := range magicTypes {
+			for _, e := range t.exts {
+				if e == ext {
+					expected = append(expected, t.name)
+				}
+			}
+		}
+
+		if len(expected) > 0 && f.size >= minEntropySize {
+			match := false
+			for _, name := range expected {
+				match = match || name == f.magic
+			}
+			if !match {
+				found := f.magic
+				if found == "" {
+					found = "?"
+				}
+				r.add("stealth_magic", f.rel, fmt.Sprintf("%s ≠ %s", ext, found))
+			}
+		}
+
+		if !f.random || partial {
+			continue
+		}
+		compressed := false
+		for _, t := range magicTypes {
+			compressed = compressed || (t.name == f.magic && t.compressed)
+		}
+		if !compressed {
+			randomBytes += f.size
+			r.add("stealth_random", f.rel, fmt.Sprintf("%.2f", f.entropy))
+		}
+	}
+
+	if r.Bytes > 1024*1024 && randomBytes*2 > r.Bytes {
+		r.add("stealth_random_share", "", fmt.Sprintf("%d%%", randomBytes*100/r.Bytes))
+	}
+}
+
+// checkNames looks for this program's naming tables and for many
+// similarly named random files in one directory
+func (r *StealthReport) checkNames(files []stealthFile) {
+	tool := 0
+	clusters := make(map[string][]stealthFile)
+
+	for _, f := range files {
+		base := path.Base(f.rel)
+		if isDecoyName(base) || toolChunkPattern.MatchString(base) {
+			tool++
+		}
+
+		key := path.Dir(f.rel) + "/" + nameShapePattern.ReplaceAllString(base, "#")
+		clusters[key] = append(clusters[key], f)
+	}
+
+	if tool > 0 {
+		r.add("stealth_tool_names", "", fmt.Sprint(tool))
+	}
+
+	var keys []string
+	for k := range clusters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		c := clusters[k]
+		random := 0
+		for _, f := range c {
+			if f.random {
+				random++
+			}
+		}
+		if len(c) >= 8 && random*2 >= len(c) {
+			r.add("stealth_name_cluster", path.Dir(k), fmt.Sprintf("%d × %s", len(c), path.Base(k)))
+		}
+	}
+}
+
+// checkSizes looks for random files of similar size and for files far
+// larger than their kind ever gets
+func (r *StealthReport) checkSizes(files []stealthFile) {
+	buckets := make(map[int][]stealthFile)
+
+	for _, f := range files {
+		base := path.Base(f.rel)
+		if (strings.HasPrefix(base, "~$") && f.size > 4096) ||
+			(strings.HasPrefix(base, "._") && f.size > 64*1024) {
+			r.add("stealth_size_odd", f.rel, FormatBytes(uint64(f.size)))
+		}
+
+		if f.random {
+			b := int(math.Log2(float64(f.size)))
+			buckets[b] = append(buckets[b], f)
+		}
+	}
+
+	for b := 0; b < 64; b++ {
+		if len(buckets[b]) >= 5 {
+			r.add("stealth_size_cluster", "", fmt.Sprintf("%d × %s–%s",
+				len(buckets[b]), FormatBytes(uint64(1)<<b), FormatBytes(uint64(1)<<(b+1))))
+		}
+	}
+}
+
+// checkTimes looks for bursts of files written together and for times in
+// the future
+func (r *StealthReport) checkTimes(files []stealthFile) {
+	const window = 2 * time.Minute
+
+	now := time.Now()
+	var times []time.Time
+	for _, f := range files {
+		times = append(times, f.mod)
+		if f.mod.After(now.Add(24 * time.Hour)) {
+			r.add("stealth_time_future", f.rel, f.mod.Format(time.RFC3339))
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	best, start := 0, 0
+	for i := range times {
+		for times[i].Sub(times[start]) > window {
+			start++
+		}
+		if i-start+1 > best {
+			best = i - start + 1
+		}
+	}
+
+	if best >= 20 && best*2 >= len(files) {
+		r.add("stealth_time_cluster", "", fmt.Sprintf("%d/%d, %s", best, len(files), window))
+	}
+}
+
+// String renders the report as plain text
+func (r *StealthReport) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %d/100\n", T("stealth_score"), r.Score)
+	fmt.Fprintf(&b, "%s: %d, %s\n\n", T("stealth_files"), r.Files, FormatBytes(uint64(r.Bytes)))
+
+	fmt.Fprintf(&b, "%s:\n", T("stealth_entropy"))
+	most := 1
+	for _, n := range r.Entropy {
+		most = max(most, n)
+	}
+	for i, n := range r.Entropy {
+		fmt.Fprintf(&b, "  %d-%d %-30s %d\n", i, i+1, strings.Repeat("#", (n*30+most-1)/most), n)
+	}
+
+	fmt.Fprintf(&b, "\n%s:\n", T("stealth_findings"))
+	if len(r.Findings) == 0 {
+		fmt.Fprintf(&b, "  %s\n", T("stealth_none"))
+	}
+	for _, f := range r.Findings {
+		line := T(f.Kind)
+		if f.Detail != "" {
+			line += " (" + f.Detail + ")"
+		}
+		if f.Path != "" {
+			line += ": " + f.Path
+		}
+		fmt.Fprintf(&b, "  [+%d] %s\n", stealthPoints(f.Kind), line)
+	}
+	return b.String()
+}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// runCommand handles command-line mode; it returns the process exit code
+func runCommand(args []string) int {
+	LoadConfig()
+
+	switch args[0] {
+	case "serve":
+		return cmdServe(args[1:])
+	case "mount":
+		return cmdMount(args[1:])
+	case "verify":
+		return cmdVerify(args[1:])
+	case "salvage":
+		return cmdSalvage(args[1:])
+	case "recover":
+		return cmdRecover(args[1:])
+	case "report":
+		return cmdReport(args[1:])
+	case "analyze":
+		return cmdAnalyze(args[1:])
+	case "reshuffle":
+		return cmdReshuffle(args[1:])
+	case "covers":
+		return cmdCovers(args[1:])
+	case "help", "-h", "--help":
+		printUsage()
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: %s\n\n", T("cli_unknown_command"), args[0])
+	printUsage()
+	return 2
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "%s v%s\n\n%s\n", AppName, AppVersion, T("cli_usage"))
+}
+
+func cmdServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := flags.Int("port", 0, "TCP port on 127.0.0.1 (0 = random)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		printUsage()
+		return 2
+	}
+
+	dev, err := resolveDrive(flags.Arg(0))
+	if err != nil {
+		return cliError(err)
+	}
+	if !dev.IsEncrypted {
+		return cliError(fmt.Errorf("%s", T("not_encrypted")))
+	}
+
+	keys, err := driveKeys(dev, false)
+	if err != nil {
+		return cliError(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s...\n", T("decrypting"))
+	vault, err := UnlockVault(dev.Path, dev.DriveID, keys, nil)
+	keys.Destroy()
+	if err != nil {
+		return cliError(err)
+	}
+
+	server, err := ServeVault(vault, *port)
+	if err != nil {
+		vault.Close()
+		return cliError(err)
+	}
+
+	server.SetErrorCallback(func(err error) {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", T("error"), err)
+	})
+
+	fmt.Printf("%s: %s\n", T("serve_url"), server.URL())
+	fmt.Fprintf(os.Stderr, "%s\n", T("serve_stop"))
+
+	// The vault stays unlocked until its changes are written
+	for {
+		waitForLock(nil)
+
+		fmt.Fprintf(os.Stderr, "%s...\n", T("sealing"))
+		err := server.Stop()
+		if err == nil {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n%s\n", T("error"), err, T("seal_retry"))
+	}
+
+	fmt.Fprintf(os.Stderr, "%s\n", T("done"))
+	return 0
+}
+
+func cmdMount(args []string) int {
+	if len(args) != 2 {
+		printUsage()
+		return 2
+	}
+
+	if !IsMountSupported() {
+		return cliError(fmt.Errorf("%s", T("mount_unsupported")))
+	}
+
+	dev, err := resolveDrive(args[0])
+	if err != nil {
+		return cliError(err)
+	}
+	if !dev.IsEncrypted {
+		return cliError(fmt.Errorf("%s", T("not_encrypted")))
+	}
+
+	keys, err := driveKeys(dev, false)
+	if err != nil {
+		return cliError(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s...\n", T("decrypting"))
+	vault, err := UnlockVault(dev.Path, dev.DriveID, keys, nil)
+	keys.Destroy()
+	if err != nil {
+		return cliError(err)
+	}
+
+	mount, err := MountVault(vault, args[1])
+	if err != nil {
+		vault.Close()
+		return cliError(err)
+	}
+
+	fmt.Printf("%s: %s\n", T("mounted_at"), args[1])
+	fmt.Fprintf(os.Stderr, "%s\n", T("mount_stop"))
+
+	// The vault stays unlocked until its changes are written. Once the
+	// mount is gone only a signal or the auto-lock retries.
+	done := mount.Done()
+	for {
+		waitForLock(done)
+
+		fmt.Fprintf(os.Stderr, "%s...\n", T("sealing"))
+		if err = mount.Unmount(); err == nil {
+			break
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n%s\n", T("error"), err, T("seal_retry"))
+		done = nil
+	}
+	loadSessions()
+	Sessions.Clear(dev.DriveID)
+
+	fmt.Fprintf(os.Stderr, "%s\n", T("done"))
+	return 0
+}
+
+func cmdVerify(args []string) int {
+	if len(args) != 1 {
+		printUsage()
+		return 2
+	}
+
+	dev, err := resolveDrive(args[0])
+	if err != nil {
+		return cliError(err)
+	}
+	if !dev.IsEncrypted {
+		return cliError(fmt.Errorf("%s", T("not_encrypted")))
+	}
+
+	keys, err := driveKeys(dev, true)
+	if err != nil {
+		return cliError(err)
+	}
+
+	report, err := VerifyVault(dev.Path, keys, nil)
+	keys.Destroy()
+	if err != nil {
+		return cliError(err)
+	}
+
+	fmt.Print(report.String())
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+func cmdReshuffle(args []string) int {
+	if len(args) != 1 {
+		printUsage()
+		return 2
+	}
+
+	dev, err := resolveDrive(args[0])
+	if err != nil {
+		return cliError(err)
+	}
+	if !dev.IsEncrypted {
+		return cliError(fmt.Errorf("%s", T("not_encrypted")))
+	}
+
+	keys, err := driveKeys(dev, true)
+	if err != nil {
+		return cliError(err)
+	}
+
+	err = ReshuffleVault(dev.Path, dev.DriveID, keys, nil)
+	keys.Destroy()
+	if err != nil {
+		return cliError(err)
+	}
+
+	fmt.Println(T("reshuffle_done"))
+	return 0
+}
+
+func cmdCovers(args []string) int {
+	if len(args) != 1 {
+		printUsage()
+		return 2
+	}
+
+	dev, err := resolveDrive(args[0])
+	if err != nil {
+		return cliError(err)
+	}
+
+	fmt.Print(EstimateCovers(dev.Path).String())
+	return 0
+}
+
+func cmdSalvage(args []string) int {
+	if len(args) != 2 {
+		printUsage()
+		return 2
+	}
+
+	dev, err := resolveDrive(args[0])
+	if err != nil {
+		return cliError(err)
+	}
+	if !dev.IsEncrypted {
+		return cliError(fmt.Errorf("%s", T("not_encrypted")))
+	}
+
+	keys, err := driveKeys(dev, true)
+	if err != nil {
+		return cliError(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s...\n", T("salvaging"))
+	report, err := SalvageVault(dev.Path, keys, args[1], nil)
+	keys.Destroy()
+	if err != nil {
+		return cliError(err)
+	}
+
+	fmt.Print(report.String())
+	if len(report.DamagedChunks) > 0 || len(report.Truncated) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func cmdRecover(args []string) int {
+	if len(args) != 1 && len(args) != 2 {
+		printUsage()
+		return 2
+	}
+
+	source := args[0]
+	target := source
+	if len(args) == 2 {
+		target = args[1]
+	}
+
+	dev, err := resolveDrive(target)
+	if err != nil {
+		return cliError(err)
+	}
+
+	password, err := readPassword(T("enter_password"))
+	if err != nil {
+		return cliError(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s...\n", T("recover_scanning"))
+	report, err := RecoverVault(source, dev.Path, password, nil)
+	password.Destroy()
+	if report != nil {
+		fmt.Print(report.String())
+	}
+	if err != nil {
+		return cliError(err)
+	}
+
+	return 0
+}
+
+func cmdReport(args []string) int {
+	if len(args) != 1 && len(args) != 2 {
+		printUsage()
+		return 2
+	}
+
+	dev, err := resolveDrive(args[0])
+	if err != nil {
+		return cliError(err)
+	}
+	if !dev.IsEncrypted {
+		return cliError(fmt.Errorf("%s", T("not_encrypted")))
+	}
+
+	keys, err := driveKeys(dev, true)
+	if err != nil {
+		return cliError(err)
+	}
+
+	report, err := LoadWipeReport(dev.Path, keys)
+	keys.Destroy()
+	if err != nil {
+		return cliError(err)
+	}
+	local, err := VerifyWipeReport(report)
+	if err != nil {
+		return cliError(err)
+	}
+	if local {
+		fmt.Fprintf(os.Stderr, "%s\n", T("report_signed"))
+	} else {
+		fmt.Fprintf(os.Stderr, "%s\n", T("report_unpinned"))
+	}
+
+	if len(args) == 1 {
+		fmt.Print(report.String())
+		return 0
+	}
+
+	path, err := ExportWipeReport(report, args[1])
+	if err != nil {
+		return cliError(err)
+	}
+	fmt.Printf("%s: %s\n", T("report_exported"), path)
+	return 0
+}
+
+// waitForLock blocks until the user interrupts, the auto-lock timer fires
+// or done is closed
+func waitForLock(done <-chan struct{}) {
+	lock := make(chan struct{}, 1)
+
+	AutoLocker.SetTimeout(AppConfig.AutoLockMinutes)
+	AutoLocker.SetCallback(func() {
+		select {
+		case lock <- struct{}{}:
+		default:
+		}
+	})
+	AutoLocker.Touch()
+	AutoLocker.Start()
+	defer AutoLocker.Stop()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case <-signals:
+	case <-done:
+	case <-lock:
+		fmt.Fprintf(os.Stderr, "%s\n", T("auto_locked"))
+	}
+}
+
+func cmdAnalyze(args []string) int {
+	if len(args) != 1 {
+		printUsage()
+		return 2
+	}
+
+	dev, err := resolveDrive(args[0])
+	if err != nil {
+		return cliError(err)
+	}
+
+	report, err := AnalyzeDrive(dev, nil)
+	if err != nil {
+		return cliError(err)
+	}
+
+	fmt.Print(report.String())
+	if report.Score >= 50 {
+		return 1
+	}
+	return 0
+}
+
+// resolveDrive finds the device mounted at path, falling back to a plain
+// directory when it is not a detected removable drive
+func resolveDrive(path string) (Device, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Device{}, err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return Device{}, err
+	}
+	if !info.IsDir() {
+		return Device{}, fmt.Errorf("%s: not a directory", path)
+	}
+
+	if devices, err := ScanDevices(); err == nil {
+		for _, d := range devices {
+			if filepath.Clean(d.Path) == filepath.Clean(abs) {
+				return d, nil
+			}
+		}
+	}
+
+	dev := Device{
+		Path:    abs,
+		Label:   filepath.Base(abs),
+		DriveID: generateDriveID(abs, ""),
+	}
+	dev.IsEncrypted = checkEncrypted(dev.Path)
+	dev.Interrupted = HasJournal(dev.Path)
+	dev.HasSession = hasSession(dev.DriveID)
+
+	return dev, nil
+}
+
+// driveKeys returns the session keys of dev, or derives them from a
+// password read from the terminal. Serving and mounting always ask, like
+// decrypting does.
+func driveKeys(dev Device, useSession bool) (*VaultKeys, error) {
+	if useSession {
+		loadSessions()
+		unlockSessionStore()
+		if keys, ok := Sessions.Get(dev.DriveID); ok {
+			return keys, nil
+		}
+	}
+	password, err := readPassword(T("enter_password"))
+	if err != nil {
+		return nil, err
+	}
+	defer password.Destroy()
+	return OpenVaultKeys(dev.Path, password)
+}
+
+var sessionsOnce sync.Once
+
+// loadSessions opens the session store the first time a command needs it,
+// so commands without sessions never reach the keyring
+func loadSessions() {
+	sessionsOnce.Do(Sessions.LoadFromConfig)
+}
+
+// unlockSessionStore asks for the PIN of a locked session store when there
+// is a terminal to ask on. An empty PIN goes on without sessions.
+func unlockSessionStore() {
+	if !Sessions.StoreLocked() || !Sessions.StoreExists() || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return
+	}
+	pin, err := readPassword(T("session_pin"))
+	if err != nil {
+		return
+	}
+	defer pin.Destroy()
+	if pin.Len() == 0 {
+		return
+	}
+	if err := Sessions.UnlockStore(pin); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", T("warning"), err)
+	}
+}
+
+// readPassword reads a line without echo into secure memory, which the
+// caller destroys
+func readPassword(prompt string) (*SecureBuffer, error) {
+	fmt.Fprintf(os.Stderr, "%s: ", prompt)
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		pw, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, err
+		}
+		return SecureBufferFrom(pw)
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, err
+	}
+	defer SecureZero(line)
+	return concatSecure(bytes.TrimRight(line, "\r\n"))
+}
+
+func cliError(err error) int {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", T("error"), err)
+	return 1
+}
@@ -36,14 +36,16 @@ const (
 	MinDecoySize  = 1024
 	MaxDecoySize  = 1024 * 1024
 
-	DefaultAutoLockMinutes = 5
-	SessionExpiryHours     = 24 * 7
+	DefaultAutoLockMinutes  = 5
+	SessionExpiryHours      = 24 * 7
+	DefaultSessionIdleHours = 24
 
 	UIWidth       = 95
 	UIHeight      = 28
 	ProgressWidth = 50
 
 	ManifestFile = ".sys"
+	JournalFile  = ".sys~"
 	ExcludeFile  = ".unfuckable.exclude"
 
 	// Chunk defaults
@@ -51,6 +53,14 @@ const (
 	MinChunkSize         = 1 * 1024 * 1024  // 1 MB
 	MaxChunkSize         = 50 * 1024 * 1024 // 50 MB
 	DefaultChunkVariance = 30               // 30%
+
+	// Archives are written as a series of gzip members of roughly this
+	// uncompressed size, so a damaged chunk only loses nearby files
+	ArchiveSegmentSize = 1024 * 1024 // 1 MB
+
+	// Every chunk starts with an encrypted header naming its vault and
+	// position, so a vault can be rebuilt when the manifest is lost
+	ChunkHeaderSize = 100
 )
 
 type Config struct {
@@ -58,20 +68,40 @@ type Config struct {
 	Theme           string            `json:"theme"`
 	AutoLockMinutes int               `json:"auto_lock_minutes"`
 	SecureWipe      bool              `json:"secure_wipe"`
+	WipeFreeSpace   bool              `json:"wipe_free_space"`
+	WipeStrategy    string            `json:"wipe_strategy"`
+	WipePassCount   int               `json:"wipe_custom_passes"`
+	WipeVerify      bool              `json:"wipe_verify"`
+	WipeFlashAware  bool              `json:"wipe_flash_aware"`
+	WipeReport      bool              `json:"wipe_report"`
+	WipeReportDir   string            `json:"wipe_report_dir"`
 	DoubleEncrypt   bool              `json:"double_encrypt"`
 	PanicHotkey     string            `json:"panic_hotkey"`
 	PanicEnabled    bool              `json:"panic_enabled"`
 	GenerateDecoys  bool              `json:"generate_decoys"`
 	DecoyCount      int               `json:"decoy_count"`
-	Sessions        map[string]string `json:"sessions"`
+	Sessions        map[string]string `json:"sessions,omitempty"` // legacy, dropped on load
+	SessionStore    string            `json:"session_store"`
 	Exclusions      []string          `json:"exclusions"`
 	ConfirmActions  bool              `json:"confirm_actions"`
 	LastDrive       string            `json:"last_drive"`
 
 	// Chunk settings
-	UseChunks     bool `json:"use_chunks"`
-	ChunkSizeMB   int  `json:"chunk_size_mb"`
-	ChunkVariance int  `json:"chunk_variance"`
+	UseChunks     bool   `json:"use_chunks"`
+	ChunkSizeMB   int    `json:"chunk_size_mb"`
+	ChunkVariance int    `json:"chunk_variance"`
+	WrapChunks    bool   `json:"wrap_chunks"`
+	Placement     string `json:"placement"`
+	SizeModel     string `json:"size_model"`
+	Stego         bool   `json:"stego"`
+	Reshuffle     bool   `json:"reshuffle_on_quick_encrypt"`
+
+	// Chunk naming profile per drive ID
+	NameProfiles map[string]string `json:"name_profiles"`
+
+	// Session limits: total lifetime and idle time, in hours
+	SessionLifetimeHours int `json:"session_lifetime_hours"`
+	SessionIdleHours     int `json:"session_idle_hours"`
 }
 
 var AppConfig = &Config{
@@ -79,12 +109,16 @@ var AppConfig = &Config{
 	Theme:           "default",
 	AutoLockMinutes: DefaultAutoLockMinutes,
 	SecureWipe:      true,
+	WipeStrategy:    WipeCustom,
+	WipePassCount:   WipePasses,
+	WipeFlashAware:  true,
 	DoubleEncrypt:   true,
 	PanicHotkey:     "Ctrl+Shift+F12",
 	PanicEnabled:    true,
 	GenerateDecoys:  true,
 	DecoyCount:      100,
 	Sessions:        make(map[string]string),
+	SessionStore:    StoreKeyring,
 	Exclusions:      []string{},
 	ConfirmActions:  true,
 	LastDrive:       "",
@@ -93,6 +127,12 @@ var AppConfig = &Config{
 	UseChunks:     true,
 	ChunkSizeMB:   5,
 	ChunkVariance: 30,
+	Placement:     PlaceRoot,
+	SizeModel:     SizeUniform,
+	NameProfiles:  make(map[string]string),
+
+	SessionLifetimeHours: SessionExpiryHours,
+	SessionIdleHours:     DefaultSessionIdleHours,
 }
 
 func getConfigDir() string {
@@ -141,6 +181,9 @@ func LoadConfig() error {
 	if AppConfig.Sessions == nil {
 		AppConfig.Sessions = make(map[string]string)
 	}
+	if AppConfig.NameProfiles == nil {
+		AppConfig.NameProfiles = make(map[string]string)
+	}
 
 	return nil
 }
@@ -21,10 +21,11 @@ var (
 	ErrIntegrity     = errors.New("integrity check failed")
 )
 
-// DeriveKey creates key from password using Argon2id
-func DeriveKey(password string, salt []byte) []byte {
+// DeriveKey creates key from password using Argon2id. The password is a
+// byte slice so it can come straight from a SecureBuffer.
+func DeriveKey(password []byte, salt []byte) []byte {
 	return argon2.IDKey(
-		[]byte(password),
+		password,
 		salt,
 		Argon2Time,
 		Argon2Memory,
@@ -34,9 +35,9 @@ func DeriveKey(password string, salt []byte) []byte {
 }
 
 // DeriveKeyFast for session verification (not for encryption)
-func DeriveKeyFast(password string, salt []byte) []byte {
+func DeriveKeyFast(password []byte, salt []byte) []byte {
 	return argon2.IDKey(
-		[]byte(password),
+		password,
 		salt,
 		1,
 		64*1024,
@@ -154,9 +155,16 @@ func Encrypt(plaintext []byte, password string) ([]byte, error) {
 		return nil, err
 	}
 
-	key := DeriveKey(password, salt)
+	key := DeriveKey([]byte(password), salt)
+	defer SecureZero(key)
 
+	return encryptWithKey(plaintext, salt, key)
+}
+
+// encryptWithKey is Encrypt with the key already derived from salt
+func encryptWithKey(plaintext, salt, key []byte) ([]byte, error) {
 	var encrypted []byte
+	var err error
 	var flag byte = 0x01 // single encryption
 
 	if AppConfig.DoubleEncrypt {
@@ -170,6 +178,7 @@ func Encrypt(plaintext []byte, password string) ([]byte, error) {
 
 		// Derive second key
 		key2 := DeriveSecondKey(key)
+		defer SecureZero(key2)
 
 		// Layer 2: XChaCha20-Poly1305
 		encrypted, err = EncryptXChaCha20(layer1, key2)
@@ -199,18 +208,28 @@ func Decrypt(encrypted []byte, password string) ([]byte, error) {
 		return nil, ErrInvalidData
 	}
 
+	key := DeriveKey([]byte(password), encrypted[1:1+SaltSize])
+	defer SecureZero(key)
+
+	return decryptWithKey(encrypted, key)
+}
+
+// decryptWithKey is Decrypt with the key already derived from the salt
+func decryptWithKey(encrypted, key []byte) ([]byte, error) {
+	if len(encrypted) < 1+SaltSize {
+		return nil, ErrInvalidData
+	}
+
 	flag := encrypted[0]
-	salt := encrypted[1 : 1+SaltSize]
 	data := encrypted[1+SaltSize:]
 
-	key := DeriveKey(password, salt)
-
 	var plaintext []byte
 	var err error
 
 	if flag == 0x02 {
 		// Double encryption
 		key2 := DeriveSecondKey(key)
+		defer SecureZero(key2)
 
 		// Layer 2: XChaCha20
 		layer1, err := DecryptXChaCha20(data, key2)
@@ -242,7 +261,7 @@ func DeriveSecondKey(key []byte) []byte {
 
 // HashPassword creates password hash for verification
 func HashPassword(password string, salt []byte) []byte {
-	key := DeriveKeyFast(password, salt)
+	key := DeriveKeyFast([]byte(password), salt)
 	h := sha256.Sum256(key)
 	return h[:]
 }
@@ -254,6 +273,16 @@ func HMAC256(data, key []byte) []byte {
 	return h.Sum(nil)
 }
 
+// HMAC256Reader creates HMAC-SHA256 of everything read from r
+func HMAC256Reader(r io.Reader, key []byte) ([]byte, int64, error) {
+	h := hmac.New(sha256.New, key)
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, n, err
+	}
+	return h.Sum(nil), n, nil
+}
+
 // VerifyHMAC verifies HMAC
 func VerifyHMAC(data, mac, key []byte) bool {
 	expected := HMAC256(data, key)
@@ -5,6 +5,8 @@ import (
 	"math/big"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 )
 
 var decoyPrefixes = []string{
@@ -18,34 +20,49 @@ var decoyPrefixes = []string{
 	"sock", "pipe", "fifo", "shm", "sem", "mtx", "evt",
 }
 
-var decoyExtensions = []string{
-	"", "dat", "bin", "sys", "tmp", "bak", "old", "new",
-	"0", "1", "2", "db", "idx", "log", "cache",
-}
-
 func generateDecoyFileNames(count int) []string {
-	names := make([]string, count)
-
-	for i := 0; i < count; i++ {
-		prefix := decoyPrefixes[randomInt(len(decoyPrefixes))]
-		hex := RandomHex(randomInt(8) + 4)
-		ext := decoyExtensions[randomInt(len(decoyExtensions))]
-
-		if ext == "" {
-			names[i] = prefix + "_" + hex
-		} else {
-			names[i] = prefix + "_" + hex + "." + ext
+	names := make([]string, 0, count)
+	seen := make(map[string]bool, count)
+
+	for len(names) < count {
+		name := generateDecoyFileName()
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
 		}
 	}
 
 	return names
 }
 
-func generateDecoyData() []byte {
-	size := MinDecoySize + randomInt(MaxDecoySize-MinDecoySize)
-	data := make([]byte, size)
-	rand.Read(data)
-	return data
+// generateDecoyFileName picks a content kind first so the extension always
+// matches what generateDecoyData writes
+func generateDecoyFileName() string {
+	// Now and then an Office lock file
+	if randomInt(12) == 0 {
+		word := officeLockWords[randomInt(len(officeLockWords))]
+		return "~$" + word + "." + officeLockExts[randomInt(len(officeLockExts))]
+	}
+
+	prefix := decoyPrefixes[randomInt(len(decoyPrefixes))]
+	hex := RandomHex(randomInt(8) + 4)
+	kind := decoyKinds[randomInt(len(decoyKinds))]
+	ext := kind.exts[randomInt(len(kind.exts))]
+
+	switch ext {
+	case "":
+		return prefix + "_" + hex
+	case "0", "1", "2":
+		// Rotated logs
+		return prefix + "_" + hex + ".log." + ext
+	}
+	return prefix + "_" + hex + "." + ext
+}
+
+// generateDecoyData produces about size bytes of content that fits the
+// decoy's name
+func generateDecoyData(name string, size int) []byte {
+	return decoyKindFor(name)(decoyRand(), size)
 }
 
 func randomInt(max int) int {
@@ -56,39 +73,80 @@ func randomInt(max int) int {
 	return int(n.Int64())
 }
 
-func removeDecoyFiles(drivePath string) {
-	entries, _ := os.ReadDir(drivePath)
-
-	for _, e := range entries {
-		name := e.Name()
+// Decoy names as generated now and by earlier versions, used for vaults
+// whose manifest does not list its decoys
+var decoyNamePattern = func() *regexp.Regexp {
+	var exts []string
+	for _, k := range decoyKinds {
+		exts = append(exts, k.exts...)
+	}
+	exts = append(exts, "dat", "bin", "sys", "tmp", "bak", "old", "new", "0", "1", "2", "db", "idx", "log", "cache")
 
-		// Skip manifest
-		if name == ManifestFile {
-			continue
+	var quoted []string
+	for _, e := range exts {
+		if e != "" {
+			quoted = append(quoted, regexp.QuoteMeta(e))
 		}
+	}
 
-		// Remove all hidden files (they are decoys or vault files)
-		if len(name) > 0 && name[0] == '.' {
-			path := filepath.Join(drivePath, name)
-			if AppConfig.SecureWipe {
-				SecureDelete(path)
-			} else {
-				os.Remove(path)
+	return regexp.MustCompile(`^\.(?:(?:` + strings.Join(decoyPrefixes, "|") + `)_[0-9a-f]{4,10}(?:\.(?:` +
+		strings.Join(quoted, "|") + `))?(?:\.[0-2])?|~\$[a-z0-9]+\.(?:` + strings.Join(officeLockExts, "|") + `))$`)
+}()
+
+// isDecoyName reports whether a file in the drive root looks like a decoy
+func isDecoyName(name string) bool {
+	return decoyNamePattern.MatchString(name)
+}
+
+// decoyNames returns the decoys of the vault that are still on the drive.
+// Vaults sealed before decoys were recorded fall back to their names.
+func decoyNames(drivePath string, manifest *VaultManifest) []string {
+	if manifest.Decoys == nil && !manifest.HasDecoy {
+		return nil
+	}
+
+	var names []string
+	if manifest.Decoys != nil {
+		for _, name := range manifest.Decoys {
+			if _, err := os.Lstat(filepath.Join(drivePath, name)); err == nil {
+				names = append(names, name)
 			}
 		}
+		return names
 	}
-}
 
-func CountDecoyFiles(drivePath string) int {
-	count := 0
 	entries, _ := os.ReadDir(drivePath)
-
 	for _, e := range entries {
-		name := e.Name()
-		if len(name) > 0 && name[0] == '.' && name != ManifestFile {
-			count++
+		if e.Type().IsRegular() && isDecoyName(e.Name()) {
+			names = append(names, e.Name())
+		}
+		if e.IsDir() && isClutterRoot(e.Name()) {
+			filepath.WalkDir(filepath.Join(drivePath, e.Name()), func(path string, d os.DirEntry, err error) error {
+				if err == nil && d.Type().IsRegular() && isDecoyName(d.Name()) {
+					rel, _ := filepath.Rel(drivePath, path)
+					names = append(names, filepath.ToSlash(rel))
+				}
+				return nil
+			})
 		}
 	}
+	return names
+}
+
+// removeDecoyFiles deletes the decoys of the vault described by manifest
+func removeDecoyFiles(drivePath string, manifest *VaultManifest) {
+	names := decoyNames(drivePath, manifest)
+	for _, name := range names {
+		path := filepath.Join(drivePath, name)
+		if AppConfig.SecureWipe {
+			SecureDelete(path)
+		} else {
+			os.Remove(path)
+		}
+	}
+	removePlacedDirs(drivePath, names)
+}
 
-	return count
+func CountDecoyFiles(drivePath string, manifest *VaultManifest) int {
+	return len(decoyNames(drivePath, manifest))
 }
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// decoyKind produces plausible content for decoys with matching extensions.
+// Random bytes look exactly like the vault, so decoys are ordinary
+// low-entropy junk instead.
+type decoyKind struct {
+	exts     []string
+	generate func(r *mrand.Rand, size int) []byte
+}
+
+var decoyKinds = []decoyKind{
+	{[]string{"log", "0", "1", "2"}, generateLogDecoy},
+	{[]string{"", "cfg", "ini", "inf"}, generateINIDecoy},
+	{[]string{"json", "new", "old", "bak"}, generateJSONDecoy},
+	{[]string{"db", "idx", "sqlite"}, generateSQLiteDecoy},
+	{[]string{"cache", "tmp", "dat"}, generateCacheDecoy},
+}
+
+// Office lock files are named after the document they guard
+var (
+	officeLockExts  = []string{"docx", "xlsx", "pptx"}
+	officeLockWords = []string{
+		"report", "budget", "notes", "invoice", "draft", "minutes",
+		"contract", "summary", "plan", "q3", "final", "presentation",
+	}
+	decoyUserNames = []string{
+		"user", "admin", "Owner", "j.smith", "HP", "office", "anna", "dev",
+	}
+)
+
+// decoyRand seeds a fast generator for one decoy; the content only has to
+// look plausible, not be unpredictable
+func decoyRand() *mrand.Rand {
+	var seed [8]byte
+	rand.Read(seed[:])
+	return mrand.New(mrand.NewSource(int64(binary.LittleEndian.Uint64(seed[:]))))
+}
+
+// decoyKindFor picks the generator matching the extension of name
+func decoyKindFor(name string) func(r *mrand.Rand, size int) []byte {
+	base := filepath.Base(name)
+	if strings.HasPrefix(strings.TrimPrefix(base, "."), "~$") {
+		return generateOfficeLockDecoy
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(base), ".")
+	for _, k := range decoyKinds {
+		for _, e := range k.exts {
+			if e == ext {
+				return k.generate
+			}
+		}
+	}
+	return generateCacheDecoy
+}
+
+func pick(r *mrand.Rand, list []string) string {
+	return list[r.Intn(len(list))]
+}
+
+// decoyTime returns a moment in the last few weeks
+func decoyTime(r *mrand.Rand) time.Time {
+	return time.Now().Add(-time.Duration(r.Int63n(int64(30 * 24 * time.Hour)))).Truncate(time.Millisecond)
+}
+
+var (
+	logLevels     = []string{"INFO ", "INFO ", "INFO ", "DEBUG", "DEBUG", "WARN ", "ERROR"}
+	logComponents = []string{"svc.worker", "net.http", "updater", "cache", "scheduler", "db.pool", "auth", "telemetry"}
+	logMessages   = []string{
+		"Connection pool refreshed (%d active, %d idle)",
+		"Request completed in %d ms (status %d)",
+		"Cache hit ratio %d.%d%%",
+		"Scheduled task %d finished, next run in %d s",
+		"Retrying operation after timeout (attempt %d of %d)",
+		"Loaded %d entries from index in %d ms",
+		"Heartbeat ok, latency %d ms, queue %d",
+		"Check for updates: no new version (build %d.%d)",
+	}
+)
+
+func generateLogDecoy(r *mrand.Rand, size int) []byte {
+	var b bytes.Buffer
+	t := decoyTime(r)
+	pid := 1000 + r.Intn(30000)
+
+	for b.Len() < size {
+		t = t.Add(time.Duration(r.Intn(5000)) * time.Millisecond)
+		msg := fmt.Sprintf(pick(r, logMessages), r.Intn(500), r.Intn(500))
+		fmt.Fprintf(&b, "%s [%s] %s[%d]: %s\n", t.Format("2006-01-02 15:04:05.000"), pick(r, logLevels), pick(r, logComponents), pid, msg)
+	}
+	return b.Bytes()
+}
+
+var iniSections = map[string][]string{
+	"General":  {"Version", "Language", "FirstRun", "InstallDir", "LastUpdateCheck"},
+	"Display":  {"Width", "Height", "Maximized", "Theme", "FontSize"},
+	"Network":  {"ProxyEnabled", "ProxyPort", "Timeout", "Retries", "UseIPv6"},
+	"Update":   {"Channel", "AutoInstall", "Interval", "LastBuild"},
+	"Logging":  {"Level", "MaxFiles", "MaxSizeKB", "Path"},
+	"Security": {"VerifySignatures", "AllowUnsigned", "CertStore"},
+}
+
+func iniValue(r *mrand.Rand, key string) string {
+	switch {
+	case strings.HasSuffix(key, "Dir") || key == "Path" || key == "CertStore":
+		return fmt.Sprintf(`C:\ProgramData\%s\%s`, pick(r, logComponents), pick(r, []string{"data", "logs", "cache"}))
+	case key == "Language":
+		return pick(r, []string{"en-US", "de-DE", "ru-RU", "uk-UA"})
+	case key == "Version" || key == "LastBuild":
+		return fmt.Sprintf("%d.%d.%d", 1+r.Intn(12), r.Intn(20), r.Intn(9000))
+	case key == "Channel" || key == "Level" || key == "Theme":
+		return pick(r, []string{"stable", "default", "info", "light", "dark"})
+	case strings.HasPrefix(key, "Use") || strings.HasPrefix(key, "Allow") || strings.HasPrefix(key, "Auto") ||
+		strings.HasPrefix(key, "Verify") || strings.HasSuffix(key, "Enabled") || key == "Maximized" || key == "FirstRun":
+		return pick(r, []string{"0", "1", "true", "false"})
+	case key == "LastUpdateCheck":
+		return decoyTime(r).Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%d", r.Intn(4096))
+}
+
+func generateINIDecoy(r *mrand.Rand, size int) []byte {
+	var b bytes.Buffer
+	size = min(size, 32*1024)
+
+	for _, section := range []string{"General", "Display", "Network", "Update", "Logging", "Security"} {
+		if r.Intn(4) == 0 && section != "General" {
+			continue
+		}
+		fmt.Fprintf(&b, "[%s]\r\n", section)
+		for _, key := range iniSections[section] {
+			fmt.Fprintf(&b, "%s=%s\r\n", key, iniValue(r, key))
+		}
+		b.WriteString("\r\n")
+	}
+
+	// Config files grow through their most-recently-used lists
+	b.WriteString("[Recent]\r\n")
+	for i := 1; b.Len() < size; i++ {
+		fmt.Fprintf(&b, "File%d=C:\\Users\\%s\\Documents\\%s_%d.%s\r\n", i, pick(r, decoyUserNames), pick(r, officeLockWords), r.Intn(100), pick(r, officeLockExts))
+	}
+	return b.Bytes()
+}
+
+func generateJSONDecoy(r *mrand.Rand, size int) []byte {
+	size = min(size, 64*1024)
+
+	type entry struct {
+		ID       int    `json:"id"`
+		Path     string `json:"path"`
+		Opened   string `json:"opened"`
+		Pinned   bool   `json:"pinned"`
+		Position int    `json:"position"`
+	}
+
+	doc := struct {
+		Version  string            `json:"version"`
+		Updated  string            `json:"updated"`
+		Settings map[string]string `json:"settings"`
+		Recent   []entry           `json:"recent"`
+	}{
+		Version:  iniValue(r, "Version"),
+		Updated:  decoyTime(r).Format(time.RFC3339),
+		Settings: map[string]string{},
+	}
+
+	for _, keys := range iniSections {
+		for _, key := range keys {
+			if r.Intn(3) == 0 {
+				doc.Settings[strings.ToLower(key[:1])+key[1:]] = iniValue(r, key)
+			}
+		}
+	}
+
+	// Each entry adds roughly 150 bytes once indented
+	for i := 0; i < size/150; i++ {
+		doc.Recent = append(doc.Recent, entry{
+			ID:       i + 1,
+			Path:     fmt.Sprintf("C:\\Users\\%s\\Documents\\%s_%d.%s", pick(r, decoyUserNames), pick(r, officeLockWords), r.Intn(100), pick(r, officeLockExts)),
+			Opened:   decoyTime(r).Format(time.RFC3339),
+			Pinned:   r.Intn(5) == 0,
+			Position: r.Intn(20000),
+		})
+	}
+
+	data, _ := json.MarshalIndent(doc, "", "  ")
+	return append(data, '\n')
+}
+
+const sqlitePageSize = 4096
+
+// sqliteVarint encodes v the way SQLite stores integers in records
+func sqliteVarint(v uint64) []byte {
+	if v <= 0x7f {
+		return []byte{byte(v)}
+	}
+
+	var tmp [9]byte
+	n := 0
+	for v > 0 && n < 8 {
+		tmp[n] = byte(v & 0x7f)
+		v >>= 7
+		n++
+	}
+
+	out := make([]byte, n)
+	for i := 0; i < n; i++ {
+		out[i] = tmp[n-1-i]
+		if i < n-1 {
+			out[i] |= 0x80
+		}
+	}
+	return out
+}
+
+// sqliteRecord encodes values (nil, int64 or string) as a record payload
+func sqliteRecord(values ...interface{}) []byte {
+	var types, body []byte
+
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			// INTEGER PRIMARY KEY columns live in the rowid
+			types = append(types, 0)
+		case int64:
+			types = append(types, sqliteVarint(6)...)
+			body = binary.BigEndian.AppendUint64(body, uint64(v))
+		case string:
+			types = append(types, sqliteVarint(uint64(13+2*len(v)))...)
+			body = append(body, v...)
+		}
+	}
+
+	header := append(sqliteVarint(uint64(len(types)+1)), types...)
+	return append(header, body...)
+}
+
+func sqliteCell(rowid int64, payload []byte) []byte {
+	cell := sqliteVarint(uint64(len(payload)))
+	cell = append(cell, sqliteVarint(uint64(rowid))...)
+	return append(cell, payload...)
+}
+
+// sqlitePage lays out a b-tree page starting at offset (100 on page 1).
+// Cells that do not fit are returned for the next page.
+func sqlitePage(page []byte, offset int, flag byte, cells [][]byte, rightChild uint32) [][]byte {
+	headerSize := 8
+	if flag == 0x05 {
+		headerSize = 12
+	}
+
+	content := len(page)
+	ptr := offset + headerSize
+	n := 0
+
+	for _, c := range cells {
+		if content-len(c) < ptr+2 {
+			break
+		}
+		content -= len(c)
+		copy(page[content:], c)
+		binary.BigEndian.PutUint16(page[ptr:], uint16(content))
+		ptr += 2
+		n++
+	}
+
+	page[offset] = flag
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(n))
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content))
+	if flag == 0x05 {
+		binary.BigEndian.PutUint32(page[offset+8:], rightChild)
+	}
+	return cells[n:]
+}
+
+var sqliteSchemas = []struct {
+	name, sql string
+}{
+	{"urls", "CREATE TABLE urls(id INTEGER PRIMARY KEY,url LONGVARCHAR,title LONGVARCHAR,visit_count INTEGER,last_visit_time INTEGER)"},
+	{"thumbnails", "CREATE TABLE thumbnails(id INTEGER PRIMARY KEY,path TEXT,width INTEGER,height INTEGER,modified INTEGER)"},
+	{"events", "CREATE TABLE events(id INTEGER PRIMARY KEY,source TEXT,message TEXT,level INTEGER,created INTEGER)"},
+}
+
+var decoyHosts = []string{
+	"www.google.com", "docs.microsoft.com", "github.com", "en.wikipedia.org",
+	"stackoverflow.com", "www.youtube.com", "news.ycombinator.com", "mail.yahoo.com",
+}
+
+// generateSQLiteDecoy writes a small but well-formed SQLite database with
+// one table spread over leaf pages under an interior root
+func generateSQLiteDecoy(r *mrand.Rand, size int) []byte {
+	schema := sqliteSchemas[r.Intn(len(sqliteSchemas))]
+	leaves := max(1, size/sqlitePageSize-2)
+
+	id := int64(0)
+	nextRow := func() []byte {
+		id++
+		switch schema.name {
+		case "urls":
+			host := pick(r, decoyHosts)
+			return sqliteCell(id, sqliteRecord(nil, fmt.Sprintf("https://%s/%s/%d", host, pick(r, officeLockWords), r.Intn(100000)),
+				pick(r, officeLockWords)+" - "+host, int64(1+r.Intn(40)), decoyTime(r).UnixMicro()))
+		case "thumbnails":
+			return sqliteCell(id, sqliteRecord(nil, fmt.Sprintf("C:\\Users\\%s\\Pictures\\IMG_%04d.jpg", pick(r, decoyUserNames), r.Intn(10000)),
+				int64(96+r.Intn(160)), int64(96+r.Intn(160)), decoyTime(r).Unix()))
+		}
+		return sqliteCell(id, sqliteRecord(nil, pick(r, logComponents), fmt.Sprintf(pick(r, logMessages), r.Intn(500), r.Intn(500)),
+			int64(r.Intn(4)), decoyTime(r).Unix()))
+	}
+
+	// Rows for one leaf page, keeping the row that did not fit for the next
+	var pending []byte
+	leafRows := func() [][]byte {
+		var rows [][]byte
+		used := 8
+		for {
+			if pending == nil {
+				pending = nextRow()
+			}
+			if used+len(pending)+2 > sqlitePageSize {
+				return rows
+			}
+			rows = append(rows, pending)
+			used += len(pending) + 2
+			pending = nil
+		}
+	}
+
+	// Page 1 holds the schema, page 2 is the table root, then the leaves
+	total := leaves + 2
+	if leaves == 1 {
+		total = 2
+	}
+	db := make([]byte, total*sqlitePageSize)
+
+	// Database header
+	copy(db, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(db[16:], sqlitePageSize)
+	db[18], db[19] = 1, 1
+	db[21], db[22], db[23] = 64, 32, 32
+	counter := uint32(1 + r.Intn(5000))
+	binary.BigEndian.PutUint32(db[24:], counter)
+	binary.BigEndian.PutUint32(db[28:], uint32(total))
+	binary.BigEndian.PutUint32(db[40:], uint32(1+r.Intn(50)))
+	binary.BigEndian.PutUint32(db[44:], 4)
+	binary.BigEndian.PutUint32(db[56:], 1)
+	binary.BigEndian.PutUint32(db[92:], counter)
+	binary.BigEndian.PutUint32(db[96:], 3039004)
+
+	master := sqliteCell(1, sqliteRecord("table", schema.name, schema.name, int64(2), schema.sql))
+	sqlitePage(db[:sqlitePageSize], 100, 0x0D, [][]byte{master}, 0)
+
+	if leaves == 1 {
+		sqlitePage(db[sqlitePageSize:2*sqlitePageSize], 0, 0x0D, leafRows(), 0)
+		return db
+	}
+
+	// Each leaf but the last gets a pointer keyed by its largest rowid
+	var pointers [][]byte
+	for i := 0; i < leaves; i++ {
+		pageNo := i + 3
+		sqlitePage(db[(pageNo-1)*sqlitePageSize:pageNo*sqlitePageSize], 0, 0x0D, leafRows(), 0)
+
+		if i < leaves-1 {
+			last := id
+			if pending != nil {
+				last--
+			}
+			p := binary.BigEndian.AppendUint32(nil, uint32(pageNo))
+			pointers = append(pointers, append(p, sqliteVarint(uint64(last))...))
+		}
+	}
+	sqlitePage(db[sqlitePageSize:2*sqlitePageSize], 0, 0x05, pointers, uint32(leaves+2))
+	return db
+}
+
+var cacheTypes = []struct {
+	ext, mime string
+}{
+	{"css", "text/css"},
+	{"js", "application/javascript"},
+	{"html", "text/html; charset=utf-8"},
+	{"json", "application/json"},
+}
+
+// generateCacheDecoy looks like a browser disk cache entry: the key,
+// response headers and an uncompressed text body
+func generateCacheDecoy(r *mrand.Rand, size int) []byte {
+	var b bytes.Buffer
+	size = min(size, 256*1024)
+
+	host := pick(r, decoyHosts)
+	ct := cacheTypes[r.Intn(len(cacheTypes))]
+	url := fmt.Sprintf("https://%s/static/%s/%s.%x.%s", host, ct.ext, pick(r, officeLockWords), r.Uint32(), ct.ext)
+	date := decoyTime(r).UTC()
+
+	fmt.Fprintf(&b, "_dk_https://%s https://%s %s\n", host, host, url)
+	fmt.Fprintf(&b, "HTTP/1.1 200 OK\r\nContent-Type: %s\r\nCache-Control: public, max-age=%d\r\n", ct.mime, 3600*(1+r.Intn(720)))
+	fmt.Fprintf(&b, "Date: %s\r\nLast-Modified: %s\r\nETag: \"%x\"\r\nVary: Accept-Encoding\r\n\r\n",
+		date.Format(time.RFC1123), date.Add(-time.Duration(r.Intn(1000))*time.Hour).Format(time.RFC1123), r.Uint64())
+
+	for i := 0; b.Len() < size; i++ {
+		name := pick(r, officeLockWords)
+		switch ct.ext {
+		case "css":
+			fmt.Fprintf(&b, ".%s-%d{margin:%dpx %dpx;padding:%dpx;color:#%06x}\n", name, i, r.Intn(32), r.Intn(32), r.Intn(16), r.Intn(0x1000000))
+		case "js":
+			fmt.Fprintf(&b, "function %s%d(e){return e&&e.%s?e.%s[%d]:null}\n", name, i, name, name, r.Intn(64))
+		case "html":
+			fmt.Fprintf(&b, "<div class=\"%s\"><a href=\"/%s/%d\">%s %d</a></div>\n", name, name, r.Intn(10000), name, i)
+		default:
+			fmt.Fprintf(&b, "{\"id\":%d,\"name\":\"%s\",\"count\":%d},\n", i, name, r.Intn(1000))
+		}
+	}
+	return b.Bytes()
+}
+
+// generateOfficeLockDecoy mimics the owner file Office leaves next to an
+// open document: the user name in ANSI and UTF-16, padded to 162 bytes
+func generateOfficeLockDecoy(r *mrand.Rand, _ int) []byte {
+	user := pick(r, decoyUserNames)
+	data := bytes.Repeat([]byte{0x20}, 162)
+
+	data[0] = byte(len(user))
+	copy(data[1:], user)
+
+	binary.LittleEndian.PutUint16(data[54:], uint16(len(user)))
+	for i, c := range utf16.Encode([]rune(user)) {
+		binary.LittleEndian.PutUint16(data[56+2*i:], c)
+	}
+	return data
+}
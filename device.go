@@ -20,6 +20,7 @@ type Device struct {
 	Free        uint64
 	FileSystem  string
 	IsEncrypted bool
+	Interrupted bool
 	DriveID     string
 	HasSession  bool
 }
@@ -116,6 +117,7 @@ func scanWindows() ([]Device, error) {
 		}
 
 		dev.IsEncrypted = checkEncrypted(dev.Path)
+		dev.Interrupted = HasJournal(dev.Path)
 		dev.HasSession = hasSession(dev.DriveID)
 
 		devices = append(devices, dev)
@@ -155,6 +157,7 @@ func scanUnix() ([]Device, error) {
 		}
 
 		dev.IsEncrypted = checkEncrypted(dev.Path)
+		dev.Interrupted = HasJournal(dev.Path)
 		dev.HasSession = hasSession(dev.DriveID)
 
 		devices = append(devices, dev)
@@ -183,8 +186,7 @@ func checkEncrypted(path string) bool {
 }
 
 func hasSession(driveID string) bool {
-	_, ok := AppConfig.Sessions[driveID]
-	return ok
+	return Sessions.Has(driveID)
 }
 
 func generateDriveID(mountpoint, device string) string {
@@ -212,6 +214,9 @@ func (d *Device) UsagePercent() float64 {
 }
 
 func (d *Device) StatusIcon() string {
+	if d.Interrupted {
+		return "⚠"
+	}
 	if d.IsEncrypted {
 		return "🔒"
 	}
@@ -219,6 +224,9 @@ func (d *Device) StatusIcon() string {
 }
 
 func (d *Device) StatusText() string {
+	if d.Interrupted {
+		return T("interrupted")
+	}
 	if d.IsEncrypted {
 		return T("encrypted")
 	}
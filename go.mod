@@ -4,9 +4,14 @@ go 1.21
 
 require (
 	github.com/gdamore/tcell/v2 v2.7.4
+	github.com/godbus/dbus/v5 v5.1.0
+	github.com/hanwen/go-fuse/v2 v2.7.2
 	github.com/rivo/tview v0.0.0-20241103174730-c76f7879f592
 	github.com/shirou/gopsutil/v3 v3.24.5
 	golang.org/x/crypto v0.29.0
+	golang.org/x/net v0.31.0
+	golang.org/x/sys v0.27.0
+	golang.org/x/term v0.26.0
 )
 
 require (
@@ -17,7 +22,5 @@ require (
 	github.com/power-devops/perfstat v0.0.0-20210106213030-5aafc221ea8c // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
-	golang.org/x/sys v0.27.0 // indirect
-	golang.org/x/term v0.26.0 // indirect
 	golang.org/x/text v0.20.0 // indirect
 )
@@ -45,6 +45,7 @@ var translations = map[string]map[string]string{
 		"encrypt":         "Encrypt",
 		"decrypt":         "Decrypt",
 		"quick_encrypt":   "Quick Encrypt",
+		"quick_reshuffle": "Quick Reshuffle",
 		"change_password": "Change Password",
 		"view_info":       "View Info",
 		"erase_vault":     "Erase Vault",
@@ -100,10 +101,11 @@ var translations = map[string]map[string]string{
 		"compressing":     "Compressing",
 
 		// Confirmations
-		"confirm_encrypt": "Encrypt this drive?",
-		"confirm_decrypt": "Decrypt this drive?",
-		"confirm_erase":   "PERMANENTLY ERASE vault? Cannot be undone!",
-		"confirm_panic":   "PANIC: Encrypt ALL decrypted drives NOW?",
+		"confirm_encrypt":   "Encrypt this drive?",
+		"confirm_decrypt":   "Decrypt this drive?",
+		"confirm_reshuffle": "Reshuffle this vault?",
+		"confirm_erase":     "PERMANENTLY ERASE vault? Cannot be undone!",
+		"confirm_panic":     "PANIC: Encrypt ALL decrypted drives NOW?",
 
 		// Exclusions
 		"exclusion_pattern": "Pattern",
@@ -142,6 +144,196 @@ var translations = map[string]map[string]string{
 		"enable":      "Enable",
 		"disable":     "Disable",
 
+		// Command line
+		"cli_unknown_command": "Unknown command",
+		"cli_usage":           "Usage:\n  unfuckable-usb                       start the interactive UI\n  unfuckable-usb serve [-port N] <drive>\n                                       serve the vault over WebDAV on 127.0.0.1\n  unfuckable-usb mount <drive> <dir>  mount the vault with FUSE (Linux)\n  unfuckable-usb verify <drive>        check chunks without decrypting\n  unfuckable-usb salvage <drive> <dir> recover readable files into dir\n  unfuckable-usb recover <drive|image> [<drive>]\n                                       rebuild a lost manifest from chunk headers\n  unfuckable-usb report <drive> [<dir>]\n                                       print the signed wipe report or export it to dir\n  unfuckable-usb analyze <drive>       score how detectable the drive looks\n  unfuckable-usb reshuffle <drive>     re-split the vault into new chunks\n  unfuckable-usb covers <drive>        list the files that can hide the vault\n  unfuckable-usb help                  show this help",
+		"not_encrypted":       "Drive is not encrypted",
+		"serve_url":           "WebDAV address",
+		"serve_stop":          "Press Ctrl+C to lock the vault and stop the server",
+		"sealing":             "Sealing vault",
+		"auto_locked":         "Auto-lock timeout reached",
+		"seal_retry":          "Changes are still in memory. Fix the problem and press Ctrl+C to try again",
+
+		// Mount
+		"mount_unsupported": "FUSE mounting is only supported on Linux",
+		"mounted_at":        "Vault mounted at",
+		"mount_stop":        "Press Ctrl+C or unmount to lock the vault",
+
+		// Verify
+		"verify_vault":      "Verify Vault",
+		"verifying":         "Verifying chunks",
+		"verify_ok":         "Vault is intact",
+		"verify_failed":     "Vault is DAMAGED",
+		"verify_healthy":    "Healthy chunks",
+		"verify_missing":    "Missing",
+		"verify_corrupted":  "Corrupted",
+		"verify_wrong_size": "Wrong size",
+		"verify_unexpected": "Unexpected files",
+
+		// Salvage
+		"salvage":                "Salvage files",
+		"salvaging":              "Salvaging",
+		"salvage_destination":    "Destination folder",
+		"salvage_recovered":      "Recovered files",
+		"salvage_damaged_chunks": "Damaged chunks",
+		"salvage_lost_bytes":     "Lost data",
+		"salvage_segments":       "Intact segments",
+		"salvage_lost_segments":  "Damaged segments",
+		"salvage_lost_files":     "Lost or truncated files",
+
+		// Recover
+		"recover_vault":    "Recover Vault",
+		"recover_scanning": "Scanning for chunks",
+		"recover_found":    "Chunk headers found",
+		"recover_vaults":   "Vault seals found",
+		"recover_chunks":   "Chunks restored",
+
+		// Journal
+		"interrupted":      "INTERRUPTED",
+		"journal_resume":   "Resume Interrupted Operation",
+		"journal_rollback": "Roll Back Interrupted Operation",
+		"journal_hint":     "An encrypt or decrypt on this drive did not finish. No data is lost either way.",
+
+		// Round trip
+		"roundtrip_failed":     "The sealed vault does not match the originals. Nothing was deleted.",
+		"roundtrip_missing":    "missing from the vault",
+		"roundtrip_unreadable": "cannot be read",
+		"roundtrip_size":       "size differs",
+		"roundtrip_hash":       "content differs",
+
+		// Preflight
+		"preflight_no_space":    "Not enough free space on the drive, needed",
+		"preflight_free":        "free",
+		"preflight_fat_file":    "The vault would exceed the 4 GB file limit of FAT. Enable chunks in settings",
+		"preflight_fat_entries": "Too many files for one FAT directory. Increase the chunk size or reduce decoys",
+		"preflight_covers":      "The covers on the drive cannot hold the vault",
+
+		// Free space wipe
+		"wipe_free_space":   "Wipe Free Space After Encrypt",
+		"wiping_free_space": "Wiping free space",
+		"esc_cancel":        "Esc to cancel",
+
+		// Wipe strategies
+		"wipe_settings":        "Wipe Settings",
+		"wipe_strategy":        "Strategy",
+		"wipe_strategy_random": "Single random pass",
+		"wipe_strategy_zero":   "Zero fill",
+		"wipe_strategy_dod":    "DoD 3-pass",
+		"wipe_strategy_custom": "Custom: N random + zeros",
+		"wipe_passes":          "Random Passes (custom)",
+		"wipe_verify":          "Verify by Reading Back",
+		"wipe_flash_aware":     "Flash-aware (truncate before removing)",
+		"wipe_failed":          "The vault is sealed, but these originals could not be wiped:",
+
+		// Wipe report
+		"wipe_report":       "Signed Wipe Report",
+		"wipe_report_dir":   "Export Reports To",
+		"wipe_report_view":  "Wipe Report",
+		"report_none":       "This vault has no wipe report",
+		"report_signed":     "Signature is valid",
+		"report_unpinned":   "Signature is valid, but not made with this machine's key. Compare the public key with the signing machine's",
+		"report_export_key": "x to export",
+		"report_exported":   "Report exported",
+		"report_operation":  "Operation",
+		"report_drive":      "Drive",
+		"report_host":       "Host",
+		"report_method":     "Method, passes",
+		"report_started":    "Started",
+		"report_finished":   "Finished",
+		"report_files":      "Files",
+		"report_failed":     "Failed",
+		"report_public_key": "Public key",
+		"report_signature":  "Signature",
+
+		// Chunk wrappers
+		"wrap_chunks": "Disguise Chunks as ZIP/PNG/SQLite",
+
+		// Erase plan
+		"erase_plan":      "Files that will be deleted:",
+		"erase_plan_kept": "Other files on the drive are kept.",
+
+		// Placement
+		"placement":         "Chunk Placement",
+		"placement_root":    "Drive root",
+		"placement_scatter": "Scatter into system-like folders",
+
+		// Chunk naming profiles
+		"name_profile":         "Chunk Names",
+		"name_profile_mixed":   "Mixed junk",
+		"name_profile_windows": "Windows temp files",
+		"name_profile_macos":   "macOS AppleDouble/Spotlight",
+		"name_profile_linux":   "Linux app caches",
+		"name_profile_dcim":    "Camera DCIM leftovers",
+		"name_profile_browser": "Browser download partials",
+
+		// Stealth analyzer
+		"stealth_analyze":      "Stealth Check",
+		"stealth_analyzing":    "Analyzing files",
+		"stealth_score":        "Detectability score",
+		"stealth_files":        "Files scanned",
+		"stealth_entropy":      "Entropy, bits per byte",
+		"stealth_findings":     "Findings",
+		"stealth_none":         "Nothing stands out",
+		"stealth_tool_file":    "File of this program",
+		"stealth_executable":   "Copy of the program",
+		"stealth_tool_names":   "Files named like this program's chunks or decoys",
+		"stealth_random":       "Random-looking data in a file that should not be",
+		"stealth_random_share": "Share of the drive that looks random",
+		"stealth_magic":        "Content does not match the extension",
+		"stealth_name_cluster": "Many random files with the same name pattern",
+		"stealth_size_cluster": "Random files of similar size",
+		"stealth_size_odd":     "Unusual size for this kind of file",
+		"stealth_time_cluster": "Files written within minutes of each other",
+		"stealth_time_future":  "Modification time in the future",
+
+		// Reshuffle
+		"reshuffle":          "Reshuffle Layout",
+		"reshuffling":        "Reshuffling chunks...",
+		"reshuffle_on_quick": "Reshuffle on quick encrypt",
+		"reshuffle_done":     "Vault reshuffled into new chunks",
+
+		// Size models
+		"size_model":           "Chunk sizes",
+		"size_model_uniform":   "Uniform around chunk size",
+		"size_model_lognormal": "Log-normal (long tail)",
+		"size_model_extension": "Typical for the extension",
+		"size_model_drive":     "Like files on the drive",
+
+		// Steganography
+		"stego":             "Hide chunks in PNG/BMP/WAV covers",
+		"stego_estimate":    "Cover Capacity",
+		"stego_scanning":    "Looking for covers...",
+		"stego_covers":      "Cover files",
+		"stego_capacity":    "Capacity",
+		"stego_needed":      "Files to hide (uncompressed)",
+		"stego_short":       "The covers may be too small; the vault is compressed, so it can still fit",
+		"stego_no_capacity": "Not enough room in cover files",
+
+		// Session store
+		"session_store":         "Session store",
+		"session_store_keyring": "System keyring",
+		"session_store_file":    "File with PIN",
+		"session_store_none":    "Memory only",
+		"session_store_locked":  "locked",
+		"session_unlock":        "Unlock",
+		"session_pin":           "Session PIN",
+		"session_pin_confirm":   "Confirm PIN",
+		"session_pin_min":       "PIN must be at least 4 characters",
+		"session_pin_checking":  "Checking PIN...",
+		"keyring_unavailable":   "System keyring is unavailable",
+		"keyring_dismissed":     "Keyring prompt was dismissed",
+
+		// Vault keys
+		"deriving_keys": "Deriving vault keys...",
+
+		// Session expiry
+		"session_lifetime":   "Session lifetime (hours)",
+		"session_idle":       "Session idle timeout (hours)",
+		"session_expires_in": "expires in",
+		"session_expired":    "Expired sessions ended",
+		"unit_hours":         "h",
+		"unit_minutes":       "m",
+
 		// Help text
 		"help_text": `[yellow]UnFuckable USB - Quick Guide[-]
 
@@ -238,6 +430,7 @@ var translations = map[string]map[string]string{
 		"encrypt":         "Зашифровать",
 		"decrypt":         "Расшифровать",
 		"quick_encrypt":   "Быстрое шифрование",
+		"quick_reshuffle": "Быстро перемешать",
 		"change_password": "Сменить пароль",
 		"view_info":       "Информация",
 		"erase_vault":     "Удалить хранилище",
@@ -293,10 +486,11 @@ var translations = map[string]map[string]string{
 		"compressing":     "Сжатие",
 
 		// Confirmations
-		"confirm_encrypt": "Зашифровать этот диск?",
-		"confirm_decrypt": "Расшифровать этот диск?",
-		"confirm_erase":   "БЕЗВОЗВРАТНО УДАЛИТЬ хранилище?",
-		"confirm_panic":   "ПАНИКА: Зашифровать ВСЕ диски СЕЙЧАС?",
+		"confirm_encrypt":   "Зашифровать этот диск?",
+		"confirm_decrypt":   "Расшифровать этот диск?",
+		"confirm_reshuffle": "Перемешать это хранилище?",
+		"confirm_erase":     "БЕЗВОЗВРАТНО УДАЛИТЬ хранилище?",
+		"confirm_panic":     "ПАНИКА: Зашифровать ВСЕ диски СЕЙЧАС?",
 
 		// Exclusions
 		"exclusion_pattern": "Паттерн",
@@ -335,6 +529,196 @@ var translations = map[string]map[string]string{
 		"enable":      "Включить",
 		"disable":     "Отключить",
 
+		// Command line
+		"cli_unknown_command": "Неизвестная команда",
+		"cli_usage":           "Использование:\n  unfuckable-usb                       запустить интерактивный интерфейс\n  unfuckable-usb serve [-port N] <диск>\n                                       открыть хранилище по WebDAV на 127.0.0.1\n  unfuckable-usb mount <диск> <папка> смонтировать хранилище через FUSE (Linux)\n  unfuckable-usb verify <диск>         проверить чанки без расшифровки\n  unfuckable-usb salvage <диск> <папка>\n                                       спасти читаемые файлы в папку\n  unfuckable-usb recover <диск|образ> [<диск>]\n                                       восстановить утерянный манифест по заголовкам чанков\n  unfuckable-usb report <диск> [<папка>]\n                                       показать подписанный отчёт о затирании или выгрузить его в папку\n  unfuckable-usb analyze <диск>        оценить, насколько заметен диск\n  unfuckable-usb reshuffle <диск>      перемешать хранилище по новым чанкам\n  unfuckable-usb covers <диск>         показать файлы, в которых можно спрятать хранилище\n  unfuckable-usb help                  показать эту справку",
+		"not_encrypted":       "Диск не зашифрован",
+		"serve_url":           "Адрес WebDAV",
+		"serve_stop":          "Нажмите Ctrl+C, чтобы заблокировать хранилище и остановить сервер",
+		"sealing":             "Запечатывание хранилища",
+		"auto_locked":         "Сработала автоблокировка",
+		"seal_retry":          "Изменения всё ещё в памяти. Устраните проблему и нажмите Ctrl+C, чтобы повторить",
+
+		// Mount
+		"mount_unsupported": "Монтирование через FUSE поддерживается только в Linux",
+		"mounted_at":        "Хранилище смонтировано в",
+		"mount_stop":        "Нажмите Ctrl+C или отмонтируйте, чтобы заблокировать хранилище",
+
+		// Verify
+		"verify_vault":      "Проверить хранилище",
+		"verifying":         "Проверка чанков",
+		"verify_ok":         "Хранилище в порядке",
+		"verify_failed":     "Хранилище ПОВРЕЖДЕНО",
+		"verify_healthy":    "Целые чанки",
+		"verify_missing":    "Отсутствуют",
+		"verify_corrupted":  "Повреждены",
+		"verify_wrong_size": "Неверный размер",
+		"verify_unexpected": "Посторонние файлы",
+
+		// Salvage
+		"salvage":                "Спасти файлы",
+		"salvaging":              "Спасение файлов",
+		"salvage_destination":    "Папка назначения",
+		"salvage_recovered":      "Восстановленные файлы",
+		"salvage_damaged_chunks": "Повреждённые чанки",
+		"salvage_lost_bytes":     "Потеряно данных",
+		"salvage_segments":       "Целые сегменты",
+		"salvage_lost_segments":  "Повреждённые сегменты",
+		"salvage_lost_files":     "Потерянные или обрезанные файлы",
+
+		// Recover
+		"recover_vault":    "Восстановить хранилище",
+		"recover_scanning": "Поиск чанков",
+		"recover_found":    "Найдено заголовков чанков",
+		"recover_vaults":   "Найдено версий хранилища",
+		"recover_chunks":   "Восстановлено чанков",
+
+		// Journal
+		"interrupted":      "ПРЕРВАНО",
+		"journal_resume":   "Продолжить прерванную операцию",
+		"journal_rollback": "Откатить прерванную операцию",
+		"journal_hint":     "Шифрование или расшифровка на этом диске не завершились. Данные не теряются ни в одном случае.",
+
+		// Round trip
+		"roundtrip_failed":     "Запечатанное хранилище не совпадает с оригиналами. Ничего не удалено.",
+		"roundtrip_missing":    "отсутствует в хранилище",
+		"roundtrip_unreadable": "не удаётся прочитать",
+		"roundtrip_size":       "размер отличается",
+		"roundtrip_hash":       "содержимое отличается",
+
+		// Preflight
+		"preflight_no_space":    "Недостаточно свободного места на диске, нужно",
+		"preflight_free":        "свободно",
+		"preflight_fat_file":    "Хранилище превысит лимит FAT в 4 ГБ на файл. Включите чанки в настройках",
+		"preflight_fat_entries": "Слишком много файлов для одной папки FAT. Увеличьте размер чанков или уменьшите число приманок",
+		"preflight_covers":      "Обложки на диске не вместят хранилище",
+
+		// Free space wipe
+		"wipe_free_space":   "Затирать свободное место после шифрования",
+		"wiping_free_space": "Затирание свободного места",
+		"esc_cancel":        "Esc — отмена",
+
+		// Wipe strategies
+		"wipe_settings":        "Настройки затирания",
+		"wipe_strategy":        "Метод",
+		"wipe_strategy_random": "Один случайный проход",
+		"wipe_strategy_zero":   "Заполнение нулями",
+		"wipe_strategy_dod":    "DoD, 3 прохода",
+		"wipe_strategy_custom": "Свой: N случайных + нули",
+		"wipe_passes":          "Случайных проходов (свой)",
+		"wipe_verify":          "Проверять чтением",
+		"wipe_flash_aware":     "Для флеш (обрезка перед удалением)",
+		"wipe_failed":          "Хранилище запечатано, но эти оригиналы не удалось затереть:",
+
+		// Wipe report
+		"wipe_report":       "Подписанный отчёт о затирании",
+		"wipe_report_dir":   "Выгружать отчёты в",
+		"wipe_report_view":  "Отчёт о затирании",
+		"report_none":       "В этом хранилище нет отчёта о затирании",
+		"report_signed":     "Подпись верна",
+		"report_unpinned":   "Подпись верна, но сделана не ключом этого компьютера. Сверьте открытый ключ с ключом компьютера, где создан отчёт",
+		"report_export_key": "x — выгрузить",
+		"report_exported":   "Отчёт выгружен",
+		"report_operation":  "Операция",
+		"report_drive":      "Диск",
+		"report_host":       "Компьютер",
+		"report_method":     "Метод, проходов",
+		"report_started":    "Начато",
+		"report_finished":   "Завершено",
+		"report_files":      "Файлов",
+		"report_failed":     "Ошибок",
+		"report_public_key": "Открытый ключ",
+		"report_signature":  "Подпись",
+
+		// Chunk wrappers
+		"wrap_chunks": "Маскировать чанки под ZIP/PNG/SQLite",
+
+		// Erase plan
+		"erase_plan":      "Будут удалены файлы:",
+		"erase_plan_kept": "Остальные файлы на диске останутся.",
+
+		// Placement
+		"placement":         "Размещение чанков",
+		"placement_root":    "Корень диска",
+		"placement_scatter": "Разбросать по системным папкам",
+
+		// Chunk naming profiles
+		"name_profile":         "Имена чанков",
+		"name_profile_mixed":   "Смешанный мусор",
+		"name_profile_windows": "Временные файлы Windows",
+		"name_profile_macos":   "macOS AppleDouble/Spotlight",
+		"name_profile_linux":   "Кэши приложений Linux",
+		"name_profile_dcim":    "Остатки DCIM с камеры",
+		"name_profile_browser": "Недокачанные загрузки браузера",
+
+		// Stealth analyzer
+		"stealth_analyze":      "Проверка заметности",
+		"stealth_analyzing":    "Анализ файлов",
+		"stealth_score":        "Оценка заметности",
+		"stealth_files":        "Проверено файлов",
+		"stealth_entropy":      "Энтропия, бит на байт",
+		"stealth_findings":     "Находки",
+		"stealth_none":         "Ничего подозрительного",
+		"stealth_tool_file":    "Файл этой программы",
+		"stealth_executable":   "Копия программы",
+		"stealth_tool_names":   "Файлы с именами как у чанков или приманок этой программы",
+		"stealth_random":       "Случайные данные там, где их быть не должно",
+		"stealth_random_share": "Доля диска со случайными данными",
+		"stealth_magic":        "Содержимое не соответствует расширению",
+		"stealth_name_cluster": "Много случайных файлов с одинаковым шаблоном имени",
+		"stealth_size_cluster": "Случайные файлы похожего размера",
+		"stealth_size_odd":     "Необычный размер для такого файла",
+		"stealth_time_cluster": "Файлы записаны с разницей в минуты",
+		"stealth_time_future":  "Время изменения в будущем",
+
+		// Reshuffle
+		"reshuffle":          "Перемешать чанки",
+		"reshuffling":        "Перемешивание чанков...",
+		"reshuffle_on_quick": "Перемешивать при быстром шифровании",
+		"reshuffle_done":     "Хранилище перемешано по новым чанкам",
+
+		// Size models
+		"size_model":           "Размеры чанков",
+		"size_model_uniform":   "Равномерно вокруг размера чанка",
+		"size_model_lognormal": "Логнормально (длинный хвост)",
+		"size_model_extension": "Типично для расширения",
+		"size_model_drive":     "Как файлы на диске",
+
+		// Steganography
+		"stego":             "Прятать чанки в PNG/BMP/WAV",
+		"stego_estimate":    "Ёмкость обложек",
+		"stego_scanning":    "Поиск обложек...",
+		"stego_covers":      "Файлы-обложки",
+		"stego_capacity":    "Ёмкость",
+		"stego_needed":      "Файлы для скрытия (без сжатия)",
+		"stego_short":       "Обложек может не хватить; хранилище сжимается, так что оно ещё может поместиться",
+		"stego_no_capacity": "Недостаточно места в файлах-обложках",
+
+		// Session store
+		"session_store":         "Хранилище сессий",
+		"session_store_keyring": "Системная связка ключей",
+		"session_store_file":    "Файл с PIN-кодом",
+		"session_store_none":    "Только в памяти",
+		"session_store_locked":  "заблокировано",
+		"session_unlock":        "Разблокировать",
+		"session_pin":           "PIN сессий",
+		"session_pin_confirm":   "Подтвердите PIN",
+		"session_pin_min":       "PIN должен быть не короче 4 символов",
+		"session_pin_checking":  "Проверка PIN...",
+		"keyring_unavailable":   "Системная связка ключей недоступна",
+		"keyring_dismissed":     "Запрос связки ключей отклонён",
+
+		// Vault keys
+		"deriving_keys": "Вычисление ключей хранилища...",
+
+		// Session expiry
+		"session_lifetime":   "Время жизни сессии (часы)",
+		"session_idle":       "Простой сессии (часы)",
+		"session_expires_in": "истекает через",
+		"session_expired":    "Истёкшие сессии завершены",
+		"unit_hours":         "ч",
+		"unit_minutes":       "м",
+
 		// Help text
 		"help_text": `[yellow] UnFuckable USB - Краткое руководство[-]
 
@@ -431,6 +815,7 @@ var translations = map[string]map[string]string{
 		"encrypt":         "Зашифрувати",
 		"decrypt":         "Розшифрувати",
 		"quick_encrypt":   "Швидке шифрування",
+		"quick_reshuffle": "Швидко перемішати",
 		"change_password": "Змінити пароль",
 		"view_info":       "Інформація",
 		"erase_vault":     "Видалити сховище",
@@ -486,10 +871,11 @@ var translations = map[string]map[string]string{
 		"compressing":     "Стиснення",
 
 		// Confirmations
-		"confirm_encrypt": "Зашифрувати цей диск?",
-		"confirm_decrypt": "Розшифрувати цей диск?",
-		"confirm_erase":   "БЕЗПОВОРОТНО ВИДАЛИТИ сховище?",
-		"confirm_panic":   "ПАНІКА: Зашифрувати ВСІ диски ЗАРАЗ?",
+		"confirm_encrypt":   "Зашифрувати цей диск?",
+		"confirm_decrypt":   "Розшифрувати цей диск?",
+		"confirm_reshuffle": "Перемішати це сховище?",
+		"confirm_erase":     "БЕЗПОВОРОТНО ВИДАЛИТИ сховище?",
+		"confirm_panic":     "ПАНІКА: Зашифрувати ВСІ диски ЗАРАЗ?",
 
 		// Exclusions
 		"exclusion_pattern": "Патерн",
@@ -528,6 +914,196 @@ var translations = map[string]map[string]string{
 		"enable":      "Увімкнути",
 		"disable":     "Вимкнути",
 
+		// Command line
+		"cli_unknown_command": "Невідома команда",
+		"cli_usage":           "Використання:\n  unfuckable-usb                       запустити інтерактивний інтерфейс\n  unfuckable-usb serve [-port N] <диск>\n                                       відкрити сховище через WebDAV на 127.0.0.1\n  unfuckable-usb mount <диск> <тека>  змонтувати сховище через FUSE (Linux)\n  unfuckable-usb verify <диск>         перевірити чанки без розшифрування\n  unfuckable-usb salvage <диск> <тека>\n                                       врятувати читабельні файли в теку\n  unfuckable-usb recover <диск|образ> [<диск>]\n                                       відновити втрачений маніфест за заголовками чанків\n  unfuckable-usb report <диск> [<тека>]\n                                       показати підписаний звіт про затирання або вивантажити його в теку\n  unfuckable-usb analyze <диск>        оцінити, наскільки помітний диск\n  unfuckable-usb reshuffle <диск>      перемішати сховище за новими чанками\n  unfuckable-usb covers <диск>         показати файли, у яких можна сховати сховище\n  unfuckable-usb help                  показати цю довідку",
+		"not_encrypted":       "Диск не зашифровано",
+		"serve_url":           "Адреса WebDAV",
+		"serve_stop":          "Натисніть Ctrl+C, щоб заблокувати сховище та зупинити сервер",
+		"sealing":             "Запечатування сховища",
+		"auto_locked":         "Спрацювало автоблокування",
+		"seal_retry":          "Зміни досі в пам'яті. Усуньте проблему та натисніть Ctrl+C, щоб повторити",
+
+		// Mount
+		"mount_unsupported": "Монтування через FUSE підтримується лише в Linux",
+		"mounted_at":        "Сховище змонтовано в",
+		"mount_stop":        "Натисніть Ctrl+C або відмонтуйте, щоб заблокувати сховище",
+
+		// Verify
+		"verify_vault":      "Перевірити сховище",
+		"verifying":         "Перевірка чанків",
+		"verify_ok":         "Сховище ціле",
+		"verify_failed":     "Сховище ПОШКОДЖЕНО",
+		"verify_healthy":    "Цілі чанки",
+		"verify_missing":    "Відсутні",
+		"verify_corrupted":  "Пошкоджені",
+		"verify_wrong_size": "Невірний розмір",
+		"verify_unexpected": "Сторонні файли",
+
+		// Salvage
+		"salvage":                "Врятувати файли",
+		"salvaging":              "Рятування файлів",
+		"salvage_destination":    "Тека призначення",
+		"salvage_recovered":      "Відновлені файли",
+		"salvage_damaged_chunks": "Пошкоджені чанки",
+		"salvage_lost_bytes":     "Втрачено даних",
+		"salvage_segments":       "Цілі сегменти",
+		"salvage_lost_segments":  "Пошкоджені сегменти",
+		"salvage_lost_files":     "Втрачені або обрізані файли",
+
+		// Recover
+		"recover_vault":    "Відновити сховище",
+		"recover_scanning": "Пошук чанків",
+		"recover_found":    "Знайдено заголовків чанків",
+		"recover_vaults":   "Знайдено версій сховища",
+		"recover_chunks":   "Відновлено чанків",
+
+		// Journal
+		"interrupted":      "ПЕРЕРВАНО",
+		"journal_resume":   "Продовжити перервану операцію",
+		"journal_rollback": "Відкотити перервану операцію",
+		"journal_hint":     "Шифрування або розшифрування на цьому диску не завершилося. Дані не втрачаються в жодному разі.",
+
+		// Round trip
+		"roundtrip_failed":     "Запечатане сховище не збігається з оригіналами. Нічого не видалено.",
+		"roundtrip_missing":    "відсутній у сховищі",
+		"roundtrip_unreadable": "не вдається прочитати",
+		"roundtrip_size":       "розмір відрізняється",
+		"roundtrip_hash":       "вміст відрізняється",
+
+		// Preflight
+		"preflight_no_space":    "Недостатньо вільного місця на диску, потрібно",
+		"preflight_free":        "вільно",
+		"preflight_fat_file":    "Сховище перевищить ліміт FAT у 4 ГБ на файл. Увімкніть чанки в налаштуваннях",
+		"preflight_fat_entries": "Забагато файлів для однієї теки FAT. Збільште розмір чанків або зменште кількість приманок",
+		"preflight_covers":      "Обкладинки на диску не вмістять сховище",
+
+		// Free space wipe
+		"wipe_free_space":   "Затирати вільне місце після шифрування",
+		"wiping_free_space": "Затирання вільного місця",
+		"esc_cancel":        "Esc — скасувати",
+
+		// Wipe strategies
+		"wipe_settings":        "Налаштування затирання",
+		"wipe_strategy":        "Метод",
+		"wipe_strategy_random": "Один випадковий прохід",
+		"wipe_strategy_zero":   "Заповнення нулями",
+		"wipe_strategy_dod":    "DoD, 3 проходи",
+		"wipe_strategy_custom": "Власний: N випадкових + нулі",
+		"wipe_passes":          "Випадкових проходів (власний)",
+		"wipe_verify":          "Перевіряти читанням",
+		"wipe_flash_aware":     "Для флеш (обрізання перед видаленням)",
+		"wipe_failed":          "Сховище запечатано, але ці оригінали не вдалося затерти:",
+
+		// Wipe report
+		"wipe_report":       "Підписаний звіт про затирання",
+		"wipe_report_dir":   "Вивантажувати звіти в",
+		"wipe_report_view":  "Звіт про затирання",
+		"report_none":       "У цьому сховищі немає звіту про затирання",
+		"report_signed":     "Підпис дійсний",
+		"report_unpinned":   "Підпис дійсний, але зроблений не ключем цього комп'ютера. Звірте відкритий ключ із ключем комп'ютера, де створено звіт",
+		"report_export_key": "x — вивантажити",
+		"report_exported":   "Звіт вивантажено",
+		"report_operation":  "Операція",
+		"report_drive":      "Диск",
+		"report_host":       "Комп'ютер",
+		"report_method":     "Метод, проходів",
+		"report_started":    "Розпочато",
+		"report_finished":   "Завершено",
+		"report_files":      "Файлів",
+		"report_failed":     "Помилок",
+		"report_public_key": "Відкритий ключ",
+		"report_signature":  "Підпис",
+
+		// Chunk wrappers
+		"wrap_chunks": "Маскувати чанки під ZIP/PNG/SQLite",
+
+		// Erase plan
+		"erase_plan":      "Будуть видалені файли:",
+		"erase_plan_kept": "Інші файли на диску залишаться.",
+
+		// Placement
+		"placement":         "Розміщення чанків",
+		"placement_root":    "Корінь диска",
+		"placement_scatter": "Розкидати по системних теках",
+
+		// Chunk naming profiles
+		"name_profile":         "Імена чанків",
+		"name_profile_mixed":   "Змішане сміття",
+		"name_profile_windows": "Тимчасові файли Windows",
+		"name_profile_macos":   "macOS AppleDouble/Spotlight",
+		"name_profile_linux":   "Кеші застосунків Linux",
+		"name_profile_dcim":    "Залишки DCIM з камери",
+		"name_profile_browser": "Недозавантажені файли браузера",
+
+		// Stealth analyzer
+		"stealth_analyze":      "Перевірка помітності",
+		"stealth_analyzing":    "Аналіз файлів",
+		"stealth_score":        "Оцінка помітності",
+		"stealth_files":        "Перевірено файлів",
+		"stealth_entropy":      "Ентропія, біт на байт",
+		"stealth_findings":     "Знахідки",
+		"stealth_none":         "Нічого підозрілого",
+		"stealth_tool_file":    "Файл цієї програми",
+		"stealth_executable":   "Копія програми",
+		"stealth_tool_names":   "Файли з іменами як у чанків або приманок цієї програми",
+		"stealth_random":       "Випадкові дані там, де їх не має бути",
+		"stealth_random_share": "Частка диска з випадковими даними",
+		"stealth_magic":        "Вміст не відповідає розширенню",
+		"stealth_name_cluster": "Багато випадкових файлів з однаковим шаблоном імені",
+		"stealth_size_cluster": "Випадкові файли схожого розміру",
+		"stealth_size_odd":     "Незвичний розмір для такого файлу",
+		"stealth_time_cluster": "Файли записані з різницею в хвилини",
+		"stealth_time_future":  "Час зміни в майбутньому",
+
+		// Reshuffle
+		"reshuffle":          "Перемішати чанки",
+		"reshuffling":        "Перемішування чанків...",
+		"reshuffle_on_quick": "Перемішувати при швидкому шифруванні",
+		"reshuffle_done":     "Сховище перемішано за новими чанками",
+
+		// Size models
+		"size_model":           "Розміри чанків",
+		"size_model_uniform":   "Рівномірно навколо розміру чанка",
+		"size_model_lognormal": "Логнормально (довгий хвіст)",
+		"size_model_extension": "Типово для розширення",
+		"size_model_drive":     "Як файли на диску",
+
+		// Steganography
+		"stego":             "Ховати чанки в PNG/BMP/WAV",
+		"stego_estimate":    "Місткість обкладинок",
+		"stego_scanning":    "Пошук обкладинок...",
+		"stego_covers":      "Файли-обкладинки",
+		"stego_capacity":    "Місткість",
+		"stego_needed":      "Файли для приховування (без стиснення)",
+		"stego_short":       "Обкладинок може не вистачити; сховище стискається, тож воно ще може вміститися",
+		"stego_no_capacity": "Недостатньо місця у файлах-обкладинках",
+
+		// Session store
+		"session_store":         "Сховище сесій",
+		"session_store_keyring": "Системна в'язка ключів",
+		"session_store_file":    "Файл з PIN-кодом",
+		"session_store_none":    "Лише в пам'яті",
+		"session_store_locked":  "заблоковано",
+		"session_unlock":        "Розблокувати",
+		"session_pin":           "PIN сесій",
+		"session_pin_confirm":   "Підтвердіть PIN",
+		"session_pin_min":       "PIN має бути не коротшим за 4 символи",
+		"session_pin_checking":  "Перевірка PIN...",
+		"keyring_unavailable":   "Системна в'язка ключів недоступна",
+		"keyring_dismissed":     "Запит в'язки ключів відхилено",
+
+		// Vault keys
+		"deriving_keys": "Обчислення ключів сховища...",
+
+		// Session expiry
+		"session_lifetime":   "Час життя сесії (години)",
+		"session_idle":       "Простій сесії (години)",
+		"session_expires_in": "спливає через",
+		"session_expired":    "Прострочені сесії завершено",
+		"unit_hours":         "год",
+		"unit_minutes":       "хв",
+
 		// Help text
 		"help_text": `[yellow] UnFuckable USB - Короткий посібник[-]
 
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Journal operations and their phases
+const (
+	JournalEncrypt   = "encrypt"
+	JournalDecrypt   = "decrypt"
+	JournalReshuffle = "reshuffle"
+
+	PhaseSealing    = "sealing"    // writing chunks, decoys and manifest
+	PhaseWiping     = "wiping"     // vault complete, removing originals
+	PhaseExtracting = "extracting" // vault intact, writing files
+	PhaseRemoving   = "removing"   // files restored, removing the vault
+)
+
+// ErrInterrupted is returned when a drive has an unfinished operation
+var ErrInterrupted = errors.New("an interrupted operation must be resumed or rolled back first")
+
+// Journal records the progress of an encrypt, decrypt or reshuffle run so it can be
+// resumed or rolled back after a crash. It is stored encrypted next to the
+// manifest: the salt, the length of the sealed journal and the journal,
+// then the names addCreated appended since, each sealed on its own.
+type Journal struct {
+	Op       string         `json:"op"`
+	Phase    string         `json:"p"`
+	Started  time.Time      `json:"t"`
+	Created  []string       `json:"c,omitempty"`
+	Files    []string       `json:"f,omitempty"`
+	Manifest *VaultManifest `json:"m,omitempty"`
+
+	drivePath string
+	salt      []byte
+	key       *SecureBuffer
+}
+
+// HasJournal reports whether an operation on drivePath was interrupted
+func HasJournal(drivePath string) bool {
+	_, err := os.Stat(filepath.Join(drivePath, JournalFile))
+	return err == nil
+}
+
+// beginJournal starts a journal for op, sealed with the master key of keys
+// so the password that opens the vault also opens the journal
+func beginJournal(drivePath, op, phase string, keys *VaultKeys) (*Journal, error) {
+	key, err := concatSecure(keys.Master)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		Op:        op,
+		Phase:     phase,
+		Started:   time.Now(),
+		drivePath: drivePath,
+		salt:      append([]byte(nil), keys.Salt...),
+		key:       key,
+	}
+
+	if err := j.save(); err != nil {
+		j.close()
+		return nil, err
+	}
+	return j, nil
+}
+
+func loadJournal(drivePath string, keys *VaultKeys) (*Journal, error) {
+	data, err := os.ReadFile(filepath.Join(drivePath, JournalFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < SaltSize {
+		return nil, ErrInvalidData
+	}
+
+	salt := data[:SaltSize]
+	master, ok := keys.masterFor(salt)
+	if !ok {
+		return nil, fmt.Errorf("wrong password or corrupted journal")
+	}
+	key, err := SecureBufferFrom(master)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, created, err := openJournal(data, key.Bytes())
+	if err != nil {
+		key.Destroy()
+		return nil, fmt.Errorf("wrong password or corrupted journal")
+	}
+	defer SecureZero(plain)
+
+	j := &Journal{drivePath: drivePath, salt: salt, key: key}
+	if err := json.Unmarshal(plain, j); err != nil {
+		j.close()
+		return nil, err
+	}
+	j.Created = append(j.Created, created...)
+	return j, nil
+}
+
+// openJournal decrypts a journal file with key, returning the journal and
+// the names appended to it. A name cut short by a crash ends the list.
+// Journals written before names were appended are the sealed journal alone.
+func openJournal(data, key []byte) ([]byte, []string, error) {
+	body := data[SaltSize:]
+	if len(body) >= 4 {
+		if n := binary.BigEndian.Uint32(body); uint64(n) <= uint64(len(body)-4) {
+			if plain, err := DecryptAESGCM(body[4:4+n], key); err == nil {
+				var created []string
+				for rest := body[4+n:]; len(rest) >= 2; {
+					size := int(binary.BigEndian.Uint16(rest))
+					if size > len(rest)-2 {
+						break
+					}
+					name, err := DecryptAESGCM(rest[2:2+size], key)
+					if err != nil {
+						break
+					}
+					created = append(created, string(name))
+					rest = rest[2+size:]
+				}
+				return plain, created, nil
+			}
+		}
+	}
+
+	plain, err := DecryptAESGCM(body, key)
+	return plain, nil, err
+}
+
+// save writes the journal through a temporary file so a crash never leaves
+// it half written
+func (j *Journal) save() error {
+	plain, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	defer SecureZero(plain)
+
+	enc, err := EncryptAESGCM(plain, j.key.Bytes())
+	if err != nil {
+		return err
+	}
+	data := make([]byte, SaltSize+4, SaltSize+4+len(enc))
+	copy(data, j.salt)
+	binary.BigEndian.PutUint32(data[SaltSize:], uint32(len(enc)))
+	data = append(data, enc...)
+
+	path := filepath.Join(j.drivePath, JournalFile)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (j *Journal) setPhase(phase string) error {
+	j.Phase = phase
+	return j.save()
+}
+
+// addCreated records a file before the operation writes it by appending
+// its name to the journal file. Appends are not synced one by one; the
+// save before each phase that deletes anything syncs them all. A nil
+// journal is allowed for callers that are not journaled.
+func (j *Journal) addCreated(name string) error {
+	if j == nil {
+		return nil
+	}
+	j.Created = append(j.Created, name)
+
+	enc, err := EncryptAESGCM([]byte(name), j.key.Bytes())
+	if err != nil {
+		return err
+	}
+	record := make([]byte, 2, 2+len(enc))
+	binary.BigEndian.PutUint16(record, uint16(len(enc)))
+	record = append(record, enc...)
+
+	f, err := os.OpenFile(filepath.Join(j.drivePath, JournalFile), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(record); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// createDirs makes dir and its missing parents below the drive, recording
+// each before making it. Directories that already exist are not recorded,
+// so a rollback leaves them alone.
+func (j *Journal) createDirs(dir string, perm os.FileMode) error {
+	if dir == "." {
+		return nil
+	}
+	parts := strings.Split(filepath.ToSlash(dir), "/")
+	for i := range parts {
+		rel := filepath.Join(parts[:i+1]...)
+		full := filepath.Join(j.drivePath, rel)
+		if _, err := os.Lstat(full); err == nil {
+			continue
+		}
+		if err := j.addCreated(rel); err != nil {
+			return err
+		}
+		if err := os.Mkdir(full, perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish removes the journal once the drive is consistent again
+func (j *Journal) finish() {
+	os.Remove(filepath.Join(j.drivePath, JournalFile))
+	j.close()
+}
+
+func (j *Journal) close() {
+	j.key.Destroy()
+}
+
+// removeCreated deletes every file and directory the operation wrote,
+// newest first so directories are empty by the time they are reached
+func (j *Journal) removeCreated() {
+	for i := len(j.Created) - 1; i >= 0; i-- {
+		os.Remove(filepath.Join(j.drivePath, j.Created[i]))
+	}
+}
+
+// removeVault deletes what is left of the vault described in the journal
+func (j *Journal) removeVault() {
+	if j.Manifest != nil {
+		removeVaultData(j.drivePath, j.Manifest)
+		removeDecoyFiles(j.drivePath, j.Manifest)
+	}
+	os.Remove(filepath.Join(j.drivePath, ManifestFile))
+}
+
+// ResumeOperation completes an interrupted encrypt, decrypt or reshuffle
+func ResumeOperation(drivePath, driveID string, keys *VaultKeys, progress ProgressFunc) error {
+	j, err := loadJournal(drivePath, keys)
+	if err != nil {
+		return err
+	}
+
+	switch j.Op + "/" + j.Phase {
+	case JournalEncrypt + "/" + PhaseSealing:
+		// Originals are intact, start over
+		j.removeCreated()
+		os.Remove(filepath.Join(drivePath, ManifestFile))
+		j.finish()
+		return EncryptDrive(drivePath, driveID, keys, progress)
+
+	case JournalEncrypt + "/" + PhaseWiping:
+		// The vault is complete; wipe the originals that are left the way
+		// the run would have
+		manifest, err := loadManifest(drivePath, keys)
+		if err != nil {
+			j.close()
+			return errWrongPassword
+		}
+		err = wipeOriginals(drivePath, driveID, j.Files, manifest, keys)
+		j.finish()
+		Sessions.Clear(driveID)
+		return err
+
+	case JournalDecrypt + "/" + PhaseExtracting:
+		// The vault is intact, extract again over the partial files
+		j.removeCreated()
+		j.finish()
+		return DecryptDrive(drivePath, driveID, keys, progress)
+
+	case JournalDecrypt + "/" + PhaseRemoving:
+		j.removeVault()
+		j.finish()
+		Sessions.Set(driveID, drivePath, keys)
+		return nil
+
+	case JournalReshuffle + "/" + PhaseSealing:
+		// The old layout is intact, start over
+		j.removeCreated()
+		j.finish()
+		return ReshuffleVault(drivePath, driveID, keys, progress)
+
+	case JournalReshuffle + "/" + PhaseWiping:
+		return j.finishReshuffle(keys)
+	}
+
+	j.close()
+	return fmt.Errorf("unknown journal state: %s/%s", j.Op, j.Phase)
+}
+
+// RollbackOperation returns the drive to the state before the interrupted
+// operation. Once originals or vault pieces have been deleted the other
+// direction is run instead, so no data is lost.
+func RollbackOperation(drivePath, driveID string, keys *VaultKeys, progress ProgressFunc) error {
+	j, err := loadJournal(drivePath, keys)
+	if err != nil {
+		return err
+	}
+
+	switch j.Op + "/" + j.Phase {
+	case JournalEncrypt + "/" + PhaseSealing:
+		j.removeCreated()
+		os.Remove(filepath.Join(drivePath, ManifestFile))
+		j.finish()
+		return nil
+
+	case JournalEncrypt + "/" + PhaseWiping:
+		// Some originals are gone, restore them all from the vault
+		j.finish()
+		return DecryptDrive(drivePath, driveID, keys, progress)
+
+	case JournalDecrypt + "/" + PhaseExtracting:
+		j.removeCreated()
+		j.finish()
+		return nil
+
+	case JournalDecrypt + "/" + PhaseRemoving:
+		// The vault is partly gone, seal the restored files again
+		j.removeVault()
+		j.finish()
+		return EncryptDrive(drivePath, driveID, keys, progress)
+
+	case JournalReshuffle + "/" + PhaseSealing:
+		j.removeCreated()
+		j.finish()
+		return nil
+
+	case JournalReshuffle + "/" + PhaseWiping:
+		// The new layout is complete and old pieces may be gone
+		return j.finishReshuffle(keys)
+	}
+
+	j.close()
+	return fmt.Errorf("unknown journal state: %s/%s", j.Op, j.Phase)
+}
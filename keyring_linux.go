@@ -0,0 +1,314 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	secretService      = "org.freedesktop.secrets"
+	secretServicePath  = "/org/freedesktop/secrets"
+	secretServiceIf    = "org.freedesktop.Secret.Service"
+	secretCollectionIf = "org.freedesktop.Secret.Collection"
+	secretItemIf       = "org.freedesktop.Secret.Item"
+	secretPromptIf     = "org.freedesktop.Secret.Prompt"
+	secretCollection   = "/org/freedesktop/secrets/aliases/default"
+
+	// Secrets cross the bus encrypted with a key agreed by Diffie-Hellman
+	secretAlgorithm = "dh-ietf1024-sha256-aes128-cbc-pkcs7"
+
+	// Attribute that marks our items in the keyring
+	keyringApp = "unfuckable-usb"
+
+	keyringPromptTimeout = 2 * time.Minute
+)
+
+// The 1024-bit MODP group of RFC 2409 the Secret Service agrees keys in
+var (
+	secretDHPrime, _ = new(big.Int).SetString(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+			"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437"+
+			"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381FFFFFFFFFFFFFFFF", 16)
+	secretDHGenerator = big.NewInt(2)
+)
+
+// secretValue is the Secret Service's (oayays) secret struct
+type secretValue struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// keyringStore keeps secrets in the Secret Service (GNOME Keyring, KWallet,
+// KeePassXC) on the session bus
+type keyringStore struct {
+	mu      sync.Mutex
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+	key     *SecureBuffer // AES key the session agreed on
+}
+
+func newKeyringStore() (SessionStore, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", T("keyring_unavailable"), err)
+	}
+	k, err := openSecretSession(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s: %w", T("keyring_unavailable"), err)
+	}
+	return k, nil
+}
+
+// openSecretSession agrees on a transfer key with the service on conn
+func openSecretSession(conn *dbus.Conn) (*keyringStore, error) {
+	private, err := rand.Int(rand.Reader, secretDHPrime)
+	if err != nil {
+		return nil, err
+	}
+	public := new(big.Int).Exp(secretDHGenerator, private, secretDHPrime)
+
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err = conn.Object(secretService, secretServicePath).
+		Call(secretServiceIf+".OpenSession", 0, secretAlgorithm, dbus.MakeVariant(public.Bytes())).
+		Store(&output, &session)
+	if err != nil {
+		return nil, err
+	}
+
+	peerBytes, ok := output.Value().([]byte)
+	if !ok {
+		return nil, errors.New("keyring: bad OpenSession reply")
+	}
+	peer := new(big.Int).SetBytes(peerBytes)
+	if peer.Cmp(big.NewInt(1)) <= 0 || peer.Cmp(new(big.Int).Sub(secretDHPrime, big.NewInt(1))) >= 0 {
+		return nil, errors.New("keyring: bad OpenSession reply")
+	}
+
+	shared := new(big.Int).Exp(peer, private, secretDHPrime).FillBytes(make([]byte, 128))
+	defer SecureZero(shared)
+	aesKey := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, nil, nil), aesKey); err != nil {
+		return nil, err
+	}
+	key, err := SecureBufferFrom(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	return &keyringStore{conn: conn, session: session, key: key}, nil
+}
+
+// seal encrypts secret for the bus with the session key
+func (k *keyringStore) seal(secret []byte) (secretValue, error) {
+	block, err := aes.NewCipher(k.key.Bytes())
+	if err != nil {
+		return secretValue{}, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return secretValue{}, err
+	}
+
+	pad := aes.BlockSize - len(secret)%aes.BlockSize
+	padded := append(append([]byte(nil), secret...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	defer SecureZero(padded)
+	value := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(value, padded)
+
+	return secretValue{Session: k.session, Parameters: iv, Value: value, ContentType: "application/octet-stream"}, nil
+}
+
+// open decrypts a secret the service sent
+func (k *keyringStore) open(s secretValue) ([]byte, error) {
+	block, err := aes.NewCipher(k.key.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Parameters) != aes.BlockSize || len(s.Value) == 0 || len(s.Value)%aes.BlockSize != 0 {
+		return nil, ErrInvalidData
+	}
+
+	plain := make([]byte, len(s.Value))
+	cipher.NewCBCDecrypter(block, s.Parameters).CryptBlocks(plain, s.Value)
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		SecureZero(plain)
+		return nil, ErrInvalidData
+	}
+	return plain[:len(plain)-pad], nil
+}
+
+// prompt runs a Secret Service prompt, such as unlocking the keyring, and
+// waits for the user to answer it
+func (k *keyringStore) prompt(path dbus.ObjectPath) error {
+	if path == "" || path == "/" {
+		return nil
+	}
+
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface(secretPromptIf),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := k.conn.AddMatchSignal(match...); err != nil {
+		return err
+	}
+	defer k.conn.RemoveMatchSignal(match...)
+
+	signals := make(chan *dbus.Signal, 4)
+	k.conn.Signal(signals)
+	defer k.conn.RemoveSignal(signals)
+
+	if err := k.conn.Object(secretService, path).Call(secretPromptIf+".Prompt", 0, "").Err; err != nil {
+		return err
+	}
+
+	timeout := time.After(keyringPromptTimeout)
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != path || sig.Name != secretPromptIf+".Completed" {
+				continue
+			}
+			if len(sig.Body) > 0 {
+				if dismissed, _ := sig.Body[0].(bool); dismissed {
+					return errors.New(T("keyring_dismissed"))
+				}
+			}
+			return nil
+		case <-timeout:
+			return errors.New("keyring: prompt timed out")
+		}
+	}
+}
+
+// search returns our items matching attrs, unlocking locked ones
+func (k *keyringStore) search(attrs map[string]string) ([]dbus.ObjectPath, error) {
+	attrs["application"] = keyringApp
+
+	service := k.conn.Object(secretService, secretServicePath)
+	var unlocked, locked []dbus.ObjectPath
+	if err := service.Call(secretServiceIf+".SearchItems", 0, attrs).Store(&unlocked, &locked); err != nil {
+		return nil, err
+	}
+	if len(locked) == 0 {
+		return unlocked, nil
+	}
+
+	var done []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := service.Call(secretServiceIf+".Unlock", 0, locked).Store(&done, &prompt); err != nil {
+		return nil, err
+	}
+	if err := k.prompt(prompt); err != nil {
+		return nil, err
+	}
+	return append(unlocked, locked...), nil
+}
+
+func (k *keyringStore) Load() (map[string][]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	items, err := k.search(map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]byte)
+	for _, path := range items {
+		item := k.conn.Object(secretService, path)
+
+		prop, err := item.GetProperty(secretItemIf + ".Attributes")
+		if err != nil {
+			continue
+		}
+		attrs, _ := prop.Value().(map[string]string)
+		driveID := attrs["drive"]
+		if driveID == "" {
+			continue
+		}
+
+		var secret secretValue
+		if err := item.Call(secretItemIf+".GetSecret", 0, k.session).Store(&secret); err != nil {
+			continue
+		}
+		if value, err := k.open(secret); err == nil {
+			result[driveID] = value
+		}
+	}
+	return result, nil
+}
+
+func (k *keyringStore) Save(driveID string, secret []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	value, err := k.seal(secret)
+	if err != nil {
+		return err
+	}
+	props := map[string]dbus.Variant{
+		secretItemIf + ".Label": dbus.MakeVariant(AppName + " " + driveID),
+		secretItemIf + ".Attributes": dbus.MakeVariant(map[string]string{
+			"application": keyringApp,
+			"drive":       driveID,
+		}),
+	}
+
+	var item, prompt dbus.ObjectPath
+	err = k.conn.Object(secretService, secretCollection).
+		Call(secretCollectionIf+".CreateItem", 0, props, value, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return err
+	}
+	return k.prompt(prompt)
+}
+
+func (k *keyringStore) Delete(driveID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.remove(map[string]string{"drive": driveID})
+}
+
+func (k *keyringStore) Clear() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.remove(map[string]string{})
+}
+
+func (k *keyringStore) remove(attrs map[string]string) error {
+	items, err := k.search(attrs)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err := k.conn.Object(secretService, item).Call(secretItemIf+".Delete", 0).Store(&prompt); err != nil {
+			return err
+		}
+		if err := k.prompt(prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
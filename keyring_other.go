@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// newKeyringStore is not available without the Secret Service
+func newKeyringStore() (SessionStore, error) {
+	return nil, fmt.Errorf("%s", T("keyring_unavailable"))
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// VaultKeys are the keys a vault is sealed with. Master is derived from the
+// password once per operation; Header and HMAC are derived from Master, so
+// they belong to this one vault. A session keeps Salt and Master, nothing
+// that could be tested against the password without this vault's salt.
+// Everything written with one set of keys shares Salt, so Master opens the
+// archive, the manifest and the journal alike. All four live in one
+// SecureBuffer, which is unmapped once the keys are unreachable: a function
+// that hands a field on keeps its keys alive until it returns.
+type VaultKeys struct {
+	Salt   []byte // salt Master was derived with
+	Master []byte // Argon2id of the password; seals archive, manifest, journal
+	Header []byte // seals chunk headers when the password is not at hand
+	HMAC   []byte // authenticates chunk payloads
+
+	mem *SecureBuffer
+
+	// password derives the master key for another salt, which vaults
+	// written before keys existed need, and the keys that depend on the
+	// password alone. Both only live as long as the operation that was
+	// given the password.
+	password *SecureBuffer
+	recovery *SecureBuffer
+}
+
+const vaultKeysVersion = 2
+
+var (
+	errWrongPassword = errors.New("wrong password or corrupted vault")
+	errNeedPassword  = errors.New("this vault was sealed by an older version; enter its password")
+)
+
+// newVaultKeys derives Header and HMAC from master and copies the keys into
+// secure memory. The caller zeroes its own copies.
+func newVaultKeys(salt, master []byte) (*VaultKeys, error) {
+	header, err := vaultSubkey(master, salt, "chunk header")
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(header)
+	hmacKey, err := vaultSubkey(master, salt, "chunk hmac")
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(hmacKey)
+
+	mem, err := concatSecure(salt, master, header, hmacKey)
+	if err != nil {
+		return nil, err
+	}
+	b := mem.Bytes()
+	k := &VaultKeys{mem: mem}
+	k.Salt, b = b[:len(salt):len(salt)], b[len(salt):]
+	k.Master, b = b[:len(master):len(master)], b[len(master):]
+	k.Header, b = b[:len(header):len(header)], b[len(header):]
+	k.HMAC = b
+	return k, nil
+}
+
+func vaultSubkey(master, salt []byte, purpose string) ([]byte, error) {
+	key := make([]byte, Argon2KeyLength)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, master, salt, []byte(purpose)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// NewVaultKeys derives keys with a fresh salt for sealing a new vault
+func NewVaultKeys(password *SecureBuffer) (*VaultKeys, error) {
+	salt, err := GenerateSalt()
+	if err != nil {
+		return nil, err
+	}
+	return passwordKeys(password, salt)
+}
+
+// passwordKeys derives the keys of the vault from password and keeps the
+// password for the ones that depend on it alone
+func passwordKeys(password *SecureBuffer, salt []byte) (*VaultKeys, error) {
+	master := DeriveKey(password.Bytes(), salt)
+	defer SecureZero(master)
+
+	keys, err := newVaultKeys(salt, master)
+	if err != nil {
+		return nil, err
+	}
+	if keys.password, err = password.Clone(); err != nil {
+		keys.Destroy()
+		return nil, err
+	}
+	return keys, nil
+}
+
+// deriveHMACKey derives the key older vaults authenticate chunk payloads
+// with. It depends on the password alone.
+func deriveHMACKey(password []byte) ([]byte, error) {
+	input, err := concatSecure(password, []byte("_hmac"))
+	if err != nil {
+		return nil, err
+	}
+	defer input.Destroy()
+	return DeriveKeyFast(input.Bytes(), []byte("chunk_integrity")), nil
+}
+
+// OpenVaultKeys derives the keys of the vault on drivePath from password
+// and checks them. The salt comes from the journal of an interrupted
+// operation if there is one, otherwise from the manifest.
+func OpenVaultKeys(drivePath string, password *SecureBuffer) (*VaultKeys, error) {
+	journal, _ := os.ReadFile(filepath.Join(drivePath, JournalFile))
+	manifest, _ := os.ReadFile(filepath.Join(drivePath, ManifestFile))
+
+	var salt []byte
+	switch {
+	case len(journal) >= SaltSize:
+		salt = journal[:SaltSize]
+	case len(manifest) >= 1+SaltSize:
+		salt = manifest[1 : 1+SaltSize]
+	default:
+		return nil, fmt.Errorf("%s", T("not_encrypted"))
+	}
+
+	keys, err := passwordKeys(password, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(journal) >= SaltSize {
+		var plain []byte
+		if plain, _, err = openJournal(journal, keys.Master); err == nil {
+			SecureZero(plain)
+		}
+	} else {
+		var plain []byte
+		if plain, err = keys.Open(manifest); err == nil {
+			SecureZero(plain)
+		}
+	}
+	if err != nil {
+		keys.Destroy()
+		return nil, errWrongPassword
+	}
+	return keys, nil
+}
+
+// masterFor returns the master key for data sealed with salt. The result
+// is a copy the caller may zero.
+func (k *VaultKeys) masterFor(salt []byte) ([]byte, bool) {
+	defer runtime.KeepAlive(k)
+	if bytes.Equal(salt, k.Salt) {
+		return append([]byte(nil), k.Master...), true
+	}
+	if k.password != nil {
+		return DeriveKey(k.password.Bytes(), salt), true
+	}
+	return nil, false
+}
+
+// recoveryKey returns the chunk header key derived from the password alone,
+// or nil without the password. It costs an Argon2id run, so it is only
+// derived when first needed. The result is a copy the caller zeroes.
+func (k *VaultKeys) recoveryKey() ([]byte, error) {
+	defer runtime.KeepAlive(k)
+	if k.recovery == nil && k.password != nil {
+		var err error
+		if k.recovery, err = SecureBufferFrom(deriveChunkHeaderKey(k.password.Bytes())); err != nil {
+			return nil, err
+		}
+	}
+	return append([]byte(nil), k.recovery.Bytes()...), nil
+}
+
+// sealKey returns the key new chunk headers are sealed with. With the
+// password at hand that is the recovery key, so the vault can be found
+// again from the password alone; from a session it is Header. The result
+// is a copy the caller zeroes.
+func (k *VaultKeys) sealKey() ([]byte, error) {
+	key, err := k.recoveryKey()
+	if err != nil || key != nil {
+		return key, err
+	}
+	defer runtime.KeepAlive(k)
+	return append([]byte(nil), k.Header...), nil
+}
+
+// headerKeys lists the keys a chunk header of this vault may be sealed
+// with, as copies the caller zeroes
+func (k *VaultKeys) headerKeys() ([][]byte, error) {
+	key, err := k.recoveryKey()
+	if err != nil {
+		return nil, err
+	}
+	defer runtime.KeepAlive(k)
+	header := append([]byte(nil), k.Header...)
+	if key == nil {
+		return [][]byte{header}, nil
+	}
+	return [][]byte{key, header}, nil
+}
+
+// hmacFor returns the key the chunk HMACs of manifest were made with.
+// Vaults sealed before HMAC came from the master key need the password.
+// The result is a copy the caller may zero.
+func (k *VaultKeys) hmacFor(manifest *VaultManifest) ([]byte, error) {
+	defer runtime.KeepAlive(k)
+	if manifest.KeyedHMAC {
+		return append([]byte(nil), k.HMAC...), nil
+	}
+	if k.password == nil {
+		return nil, errNeedPassword
+	}
+	return deriveHMACKey(k.password.Bytes())
+}
+
+// Seal encrypts like Encrypt, with the master key and its salt
+func (k *VaultKeys) Seal(plaintext []byte) ([]byte, error) {
+	defer runtime.KeepAlive(k)
+	return encryptWithKey(plaintext, k.Salt, k.Master)
+}
+
+// Open decrypts what Seal or Encrypt produced
+func (k *VaultKeys) Open(encrypted []byte) ([]byte, error) {
+	if len(encrypted) < 1+SaltSize {
+		return nil, ErrInvalidData
+	}
+	key, ok := k.masterFor(encrypted[1 : 1+SaltSize])
+	if !ok {
+		return nil, ErrDecryptFailed
+	}
+	defer SecureZero(key)
+	return decryptWithKey(encrypted, key)
+}
+
+// Clone copies the keys without the password or anything derived from it
+// alone
+func (k *VaultKeys) Clone() (*VaultKeys, error) {
+	defer runtime.KeepAlive(k)
+	return newVaultKeys(k.Salt, k.Master)
+}
+
+// Destroy zeroes the keys and the password. The key fields are cleared;
+// copies of them taken before read zeros, and stay mapped while k is
+// reachable.
+func (k *VaultKeys) Destroy() {
+	if k == nil {
+		return
+	}
+	if k.mem != nil {
+		k.mem.Destroy()
+	} else {
+		SecureZero(k.Master)
+		SecureZero(k.Header)
+		SecureZero(k.HMAC)
+	}
+	k.password.Destroy()
+	k.recovery.Destroy()
+	k.Salt, k.Master, k.Header, k.HMAC = nil, nil, nil, nil
+	k.password, k.recovery = nil, nil
+}
+
+// MarshalBinary encodes the keys for a session store: version, salt and
+// master key. The rest is derived again when they are read back.
+func (k *VaultKeys) MarshalBinary() ([]byte, error) {
+	defer runtime.KeepAlive(k)
+	b := make([]byte, 0, 1+SaltSize+Argon2KeyLength)
+	b = append(b, vaultKeysVersion)
+	b = append(b, k.Salt...)
+	return append(b, k.Master...), nil
+}
+
+// unmarshalVaultKeys decodes MarshalBinary. Anything else, such as the
+// password-derived keys or passwords earlier versions kept in sessions,
+// is rejected.
+func unmarshalVaultKeys(b []byte) (*VaultKeys, error) {
+	if len(b) != 1+SaltSize+Argon2KeyLength || b[0] != vaultKeysVersion {
+		return nil, ErrInvalidData
+	}
+	return newVaultKeys(b[1:1+SaltSize], b[1+SaltSize:])
+}
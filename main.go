@@ -6,6 +6,10 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	app := NewApp()
 
 	if err := app.Run(); err != nil {
@@ -0,0 +1,403 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"golang.org/x/net/webdav"
+)
+
+// VaultMount is an unlocked vault exposed through FUSE
+type VaultMount struct {
+	vault      *UnlockedVault
+	server     *fuse.Server
+	mountpoint string
+	done       chan struct{}
+}
+
+// IsMountSupported returns true on Linux
+func IsMountSupported() bool {
+	return true
+}
+
+// MountVault mounts v at mountpoint; the vault is re-sealed on Unmount
+func MountVault(v *UnlockedVault, mountpoint string) (*VaultMount, error) {
+	root := &vaultNode{vfs: v.FileSystem()}
+
+	timeout := time.Second
+	server, err := fs.Mount(mountpoint, root, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:      "vault",
+			Name:        "unfuckable",
+			DirectMount: os.Geteuid() == 0,
+		},
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+		UID:          uint32(os.Getuid()),
+		GID:          uint32(os.Getgid()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m := &VaultMount{
+		vault:      v,
+		server:     server,
+		mountpoint: mountpoint,
+		done:       make(chan struct{}),
+	}
+
+	go func() {
+		server.Wait()
+		close(m.done)
+	}()
+
+	return m, nil
+}
+
+// Done is closed when the file system is unmounted, including externally
+// via fusermount -u
+func (m *VaultMount) Done() <-chan struct{} {
+	return m.done
+}
+
+// Unmount writes pending changes, detaches the file system and locks the
+// vault. Changes are written before anything else, so a failed flush
+// leaves the vault mounted. A mount that is busy, say a shell still in
+// it, is detached lazily; what is written until the vault locks is
+// flushed by Close.
+func (m *VaultMount) Unmount() error {
+	select {
+	case <-m.done:
+	default:
+		if err := m.vault.Flush(); err != nil {
+			return err
+		}
+		if err := m.server.Unmount(); err != nil {
+			if lazyUnmount(m.mountpoint) != nil {
+				return err
+			}
+		} else {
+			<-m.done
+		}
+	}
+
+	return m.vault.Close()
+}
+
+// lazyUnmount detaches mountpoint now and lets the kernel finish once the
+// last process leaves it
+func lazyUnmount(mountpoint string) error {
+	if os.Geteuid() == 0 {
+		if err := syscall.Unmount(mountpoint, syscall.MNT_DETACH); err == nil {
+			return nil
+		}
+	}
+	for _, bin := range []string{"fusermount3", "fusermount"} {
+		if path, err := exec.LookPath(bin); err == nil {
+			return exec.Command(path, "-u", "-z", mountpoint).Run()
+		}
+	}
+	return exec.ErrNotFound
+}
+
+// vaultNode maps a FUSE inode onto a path in the vault tree
+type vaultNode struct {
+	fs.Inode
+	vfs webdav.FileSystem
+}
+
+var (
+	_ = (fs.NodeGetattrer)((*vaultNode)(nil))
+	_ = (fs.NodeSetattrer)((*vaultNode)(nil))
+	_ = (fs.NodeLookuper)((*vaultNode)(nil))
+	_ = (fs.NodeReaddirer)((*vaultNode)(nil))
+	_ = (fs.NodeOpener)((*vaultNode)(nil))
+	_ = (fs.NodeReader)((*vaultNode)(nil))
+	_ = (fs.NodeWriter)((*vaultNode)(nil))
+	_ = (fs.NodeCreater)((*vaultNode)(nil))
+	_ = (fs.NodeMkdirer)((*vaultNode)(nil))
+	_ = (fs.NodeUnlinker)((*vaultNode)(nil))
+	_ = (fs.NodeRmdirer)((*vaultNode)(nil))
+	_ = (fs.NodeRenamer)((*vaultNode)(nil))
+)
+
+func (n *vaultNode) vaultPath() string {
+	return "/" + n.Path(nil)
+}
+
+func (n *vaultNode) childPath(name string) string {
+	return path.Join(n.vaultPath(), name)
+}
+
+func (n *vaultNode) newChild(ctx context.Context, info os.FileInfo, out *fuse.EntryOut) *fs.Inode {
+	mode := uint32(syscall.S_IFREG)
+	if info.IsDir() {
+		mode = syscall.S_IFDIR
+	}
+
+	fillAttr(info, &out.Attr)
+	return n.NewInode(ctx, &vaultNode{vfs: n.vfs}, fs.StableAttr{Mode: mode})
+}
+
+func (n *vaultNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	info, err := n.vfs.Stat(ctx, n.vaultPath())
+	if err != nil {
+		return toErrno(err)
+	}
+
+	fillAttr(info, &out.Attr)
+	return 0
+}
+
+func (n *vaultNode) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	AutoLocker.Touch()
+
+	if size, ok := in.GetSize(); ok {
+		if err := truncateFS(ctx, n.vfs, n.vaultPath(), int64(size)); err != nil {
+			return toErrno(err)
+		}
+	}
+
+	return n.Getattr(ctx, fh, out)
+}
+
+func (n *vaultNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	info, err := n.vfs.Stat(ctx, n.childPath(name))
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	return n.newChild(ctx, info, out), 0
+}
+
+func (n *vaultNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	AutoLocker.Touch()
+
+	d, err := n.vfs.OpenFile(ctx, n.vaultPath(), os.O_RDONLY, 0)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	defer d.Close()
+
+	infos, err := d.Readdir(-1)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	entries := make([]fuse.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		mode := uint32(syscall.S_IFREG)
+		if info.IsDir() {
+			mode = syscall.S_IFDIR
+		}
+		entries = append(entries, fuse.DirEntry{Name: info.Name(), Mode: mode})
+	}
+
+	return fs.NewListDirStream(entries), 0
+}
+
+func (n *vaultNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	AutoLocker.Touch()
+
+	if flags&syscall.O_TRUNC != 0 {
+		if err := truncateFS(ctx, n.vfs, n.vaultPath(), 0); err != nil {
+			return nil, 0, toErrno(err)
+		}
+	}
+
+	return nil, 0, 0
+}
+
+func (n *vaultNode) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	f, err := n.vfs.OpenFile(ctx, n.vaultPath(), os.O_RDONLY, 0)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return nil, toErrno(err)
+	}
+
+	read, err := io.ReadFull(f, dest)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, toErrno(err)
+	}
+
+	return fuse.ReadResultData(dest[:read]), 0
+}
+
+func (n *vaultNode) Write(ctx context.Context, fh fs.FileHandle, data []byte, off int64) (uint32, syscall.Errno) {
+	AutoLocker.Touch()
+
+	f, err := n.vfs.OpenFile(ctx, n.vaultPath(), os.O_WRONLY, 0)
+	if err != nil {
+		return 0, toErrno(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return 0, toErrno(err)
+	}
+
+	written, err := f.Write(data)
+	if err != nil {
+		return uint32(written), toErrno(err)
+	}
+
+	return uint32(written), 0
+}
+
+func (n *vaultNode) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	AutoLocker.Touch()
+
+	childPath := n.childPath(name)
+	f, err := n.vfs.OpenFile(ctx, childPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(mode&0777))
+	if err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+	f.Close()
+
+	info, err := n.vfs.Stat(ctx, childPath)
+	if err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+
+	return n.newChild(ctx, info, out), nil, 0, 0
+}
+
+func (n *vaultNode) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	AutoLocker.Touch()
+
+	childPath := n.childPath(name)
+	if err := n.vfs.Mkdir(ctx, childPath, os.FileMode(mode&0777)); err != nil {
+		return nil, toErrno(err)
+	}
+
+	info, err := n.vfs.Stat(ctx, childPath)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	return n.newChild(ctx, info, out), 0
+}
+
+func (n *vaultNode) Unlink(ctx context.Context, name string) syscall.Errno {
+	AutoLocker.Touch()
+	return toErrno(n.vfs.RemoveAll(ctx, n.childPath(name)))
+}
+
+func (n *vaultNode) Rmdir(ctx context.Context, name string) syscall.Errno {
+	AutoLocker.Touch()
+
+	childPath := n.childPath(name)
+	d, err := n.vfs.OpenFile(ctx, childPath, os.O_RDONLY, 0)
+	if err != nil {
+		return toErrno(err)
+	}
+	entries, err := d.Readdir(-1)
+	d.Close()
+	if err != nil {
+		return toErrno(err)
+	}
+	if len(entries) > 0 {
+		return syscall.ENOTEMPTY
+	}
+
+	return toErrno(n.vfs.RemoveAll(ctx, childPath))
+}
+
+func (n *vaultNode) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	AutoLocker.Touch()
+
+	parent, ok := newParent.(*vaultNode)
+	if !ok {
+		return syscall.EXDEV
+	}
+
+	return toErrno(n.vfs.Rename(ctx, n.childPath(name), parent.childPath(newName)))
+}
+
+func fillAttr(info os.FileInfo, attr *fuse.Attr) {
+	if info.IsDir() {
+		attr.Mode = syscall.S_IFDIR | 0755
+	} else {
+		attr.Mode = syscall.S_IFREG | uint32(info.Mode().Perm())
+		if info.Mode().Perm() == 0 {
+			attr.Mode |= 0644
+		}
+	}
+
+	attr.Size = uint64(info.Size())
+	attr.Blocks = (attr.Size + 511) / 512
+
+	mtime := info.ModTime()
+	attr.SetTimes(&mtime, &mtime, &mtime)
+}
+
+// truncateFS resizes a file in the vault tree, which has no native truncate
+func truncateFS(ctx context.Context, vfs webdav.FileSystem, name string, size int64) error {
+	var data []byte
+
+	if size > 0 {
+		f, err := vfs.OpenFile(ctx, name, os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		data, err = io.ReadAll(io.LimitReader(f, size))
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := vfs.OpenFile(ctx, name, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if len(data) > 0 {
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if int64(len(data)) < size {
+		if _, err := f.Seek(size-1, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := f.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func toErrno(err error) syscall.Errno {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, os.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, os.ErrExist):
+		return syscall.EEXIST
+	case errors.Is(err, os.ErrInvalid):
+		return syscall.EINVAL
+	case errors.Is(err, os.ErrClosed):
+		return syscall.EIO
+	}
+	return fs.ToErrno(err)
+}
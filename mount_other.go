@@ -0,0 +1,28 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// VaultMount is a stub for platforms without FUSE support
+type VaultMount struct{}
+
+// IsMountSupported returns false on non-Linux platforms
+func IsMountSupported() bool {
+	return false
+}
+
+// MountVault is not available on non-Linux platforms
+func MountVault(v *UnlockedVault, mountpoint string) (*VaultMount, error) {
+	return nil, fmt.Errorf("%s", T("mount_unsupported"))
+}
+
+// Done is a stub for non-Linux platforms
+func (m *VaultMount) Done() <-chan struct{} {
+	return nil
+}
+
+// Unmount is a stub for non-Linux platforms
+func (m *VaultMount) Unmount() error {
+	return nil
+}
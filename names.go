@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	mrand "math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Chunk naming profiles. Mixed is the original junk-name mix and uses the
+// configured chunk size; the others imitate one kind of drive.
+const (
+	ProfileMixed   = "mixed"
+	ProfileWindows = "windows"
+	ProfileMacOS   = "macos"
+	ProfileLinux   = "linux"
+	ProfileDCIM    = "dcim"
+	ProfileBrowser = "browser"
+)
+
+var NameProfiles = []string{ProfileMixed, ProfileWindows, ProfileMacOS, ProfileLinux, ProfileDCIM, ProfileBrowser}
+
+// nameGrammar produces one kind of file name. Chunks named by it are sized
+// log-uniformly between minMB and maxMB on disk.
+type nameGrammar struct {
+	minMB, maxMB int
+	name         func(r *mrand.Rand) (stem, ext string)
+}
+
+// nameProfile is a set of grammars and, per wrap format, the extensions a
+// wrapped chunk may take in place of the grammar's own
+type nameProfile struct {
+	grammars []nameGrammar
+	wraps    map[string][]string
+}
+
+var downloadNames = []string{
+	"setup_x64", "ubuntu-24.04.1-desktop-amd64", "VSCodeUserSetup-x64-1.93.1",
+	"Firefox Installer", "driver_package", "dataset", "backup_2024",
+	"archive", "video", "export", "OBS-Studio-30.2-Windows", "photos",
+}
+
+var downloadExts = []string{".exe", ".iso", ".zip", ".msi", ".mp4", ".dmg", ".7z"}
+
+var nameProfiles = map[string]nameProfile{
+	ProfileWindows: {
+		grammars: []nameGrammar{
+			{1, 8, func(r *mrand.Rand) (string, string) { return "~DF" + nameHex(r, 4, true), ".TMP" }},
+			{1, 6, func(r *mrand.Rand) (string, string) { return "~WRL" + nameDigits(r, 4), ".tmp" }},
+			{1, 16, func(r *mrand.Rand) (string, string) { return clutterGUID(r), ".tmp" }},
+			{1, 4, func(r *mrand.Rand) (string, string) { return "MSI" + nameHex(r, 5, false), ".LOG" }},
+			{1, 1, func(r *mrand.Rand) (string, string) { return "edb" + nameHex(r, 5, true), ".log" }},
+		},
+		wraps: map[string][]string{
+			wrapZIP:    {".tmp", ".TMP"},
+			wrapPNG:    {".tmp"},
+			wrapSQLite: {".db", ".dat"},
+		},
+	},
+	ProfileMacOS: {
+		grammars: []nameGrammar{
+			{1, 4, func(r *mrand.Rand) (string, string) { return nameHex(r, 16, false), "" }},
+			{1, 24, func(r *mrand.Rand) (string, string) {
+				return fmt.Sprintf("live.%d.index%s", r.Intn(4),
+					pick(r, []string{"Arrays", "Postings", "Positions", "Compact", "Updates", "Head", "Ids"})), ""
+			}},
+			{1, 8, func(r *mrand.Rand) (string, string) {
+				return "._IMG_" + nameDigits(r, 4), pick(r, []string{".JPG", ".HEIC", ".PNG"})
+			}},
+			{2, 32, func(r *mrand.Rand) (string, string) { return "._" + downloadName(r), "" }},
+		},
+		wraps: map[string][]string{
+			wrapZIP:    {".zip"},
+			wrapPNG:    {".png", ".PNG"},
+			wrapSQLite: {".db"},
+		},
+	},
+	ProfileLinux: {
+		grammars: []nameGrammar{
+			{1, 8, func(r *mrand.Rand) (string, string) { return ".goutputstream-" + nameAlnum(r, 6), "" }},
+			{1, 16, func(r *mrand.Rand) (string, string) { return "tmp." + nameAlnum(r, 10), "" }},
+			{1, 12, func(r *mrand.Rand) (string, string) { return nameHex(r, 16, false), "_0" }},
+			{1, 8, func(r *mrand.Rand) (string, string) { return "f_" + nameHex(r, 6, false), "" }},
+			{8, 50, func(r *mrand.Rand) (string, string) { return fmt.Sprintf("core.%d", 1000+r.Intn(60000)), "" }},
+		},
+		wraps: map[string][]string{
+			wrapZIP:    {".zip"},
+			wrapPNG:    {".png"},
+			wrapSQLite: {".sqlite", ".db"},
+		},
+	},
+	ProfileDCIM: {
+		grammars: []nameGrammar{
+			{2, 8, func(r *mrand.Rand) (string, string) { return "IMG_" + nameDigits(r, 4), ".JPG" }},
+			{3, 12, func(r *mrand.Rand) (string, string) { return "DSC" + nameDigits(r, 5), ".JPG" }},
+			{2, 8, func(r *mrand.Rand) (string, string) {
+				return "P" + fmt.Sprint(100+r.Intn(10)) + nameDigits(r, 4), ".JPG"
+			}},
+			{15, 50, func(r *mrand.Rand) (string, string) { return "MVI_" + nameDigits(r, 4), ".MOV" }},
+			{20, 50, func(r *mrand.Rand) (string, string) { return "GOPR" + nameDigits(r, 4), ".MP4" }},
+			{10, 50, func(r *mrand.Rand) (string, string) { return "VID_" + nameStamp(r), ".mp4" }},
+			{2, 6, func(r *mrand.Rand) (string, string) {
+				t := nameTime(r)
+				return fmt.Sprintf(".trashed-%d-IMG_%s", t.Add(30*24*time.Hour).Unix(), t.Format("20060102_150405")), ".jpg"
+			}},
+		},
+		wraps: map[string][]string{
+			wrapPNG: {".PNG", ".png"},
+		},
+	},
+	ProfileBrowser: {
+		grammars: []nameGrammar{
+			{5, 50, func(r *mrand.Rand) (string, string) { return "Unconfirmed " + nameDigits(r, 6), ".crdownload" }},
+			{5, 50, func(r *mrand.Rand) (string, string) { return downloadName(r), ".crdownload" }},
+			{5, 50, func(r *mrand.Rand) (string, string) { return downloadName(r), ".part" }},
+			{5, 50, func(r *mrand.Rand) (string, string) { return downloadName(r), ".opdownload" }},
+		},
+		wraps: map[string][]string{
+			wrapZIP: {".zip.crdownload", ".zip.part"},
+			wrapPNG: {".png.part"},
+		},
+	},
+}
+
+// downloadName is a downloaded file name, numbered the way browsers number
+// repeated downloads
+func downloadName(r *mrand.Rand) string {
+	name := pick(r, downloadNames)
+	if r.Intn(3) == 0 {
+		name += fmt.Sprintf(" (%d)", r.Intn(9)+1)
+	}
+	return name + pick(r, downloadExts)
+}
+
+func nameDigits(r *mrand.Rand, n int) string {
+	return fmt.Sprintf("%0*d", n, r.Int63n(int64(math.Pow10(n))))
+}
+
+func nameHex(r *mrand.Rand, n int, upper bool) string {
+	const lower, upperChars = "0123456789abcdef", "0123456789ABCDEF"
+	chars := lower
+	if upper {
+		chars = upperChars
+	}
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = chars[r.Intn(16)]
+	}
+	return string(b)
+}
+
+func nameAlnum(r *mrand.Rand, n int) string {
+	const chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = chars[r.Intn(len(chars))]
+	}
+	return string(b)
+}
+
+// nameTime is a capture time within the past two years
+func nameTime(r *mrand.Rand) time.Time {
+	return time.Now().Add(-time.Duration(r.Int63n(int64(2 * 365 * 24 * time.Hour))))
+}
+
+func nameStamp(r *mrand.Rand) string {
+	return nameTime(r).Format("20060102_150405")
+}
+
+// driveNameProfile returns the naming profile chosen for a drive
+func driveNameProfile(driveID string) string {
+	if p, ok := AppConfig.NameProfiles[driveID]; ok {
+		if _, ok := nameProfiles[p]; ok {
+			return p
+		}
+	}
+	return ProfileMixed
+}
+
+// chunkSlot is one planned chunk: how much data it carries and the grammar
+// its name comes from (nil for the mixed profile), or for mixed chunks the
+// extension its size was drawn for
+type chunkSlot struct {
+	size    int
+	grammar *nameGrammar
+	ext     string
+}
+
+// planChunks splits dataLen bytes into chunks sized for profile
+func planChunks(sz *sizer, profile string, dataLen int) []chunkSlot {
+	np, ok := nameProfiles[profile]
+	var slots []chunkSlot
+
+	for offset := 0; offset < dataLen; {
+		var slot chunkSlot
+		if ok {
+			slot.grammar = &np.grammars[randomIntN(len(np.grammars))]
+		} else {
+			slot.ext = sz.chunkExt()
+		}
+		slot.size = sz.chunkSize(slot.grammar, slot.ext)
+
+		if offset+slot.size > dataLen {
+			slot.size = dataLen - offset
+		}
+
+		slots = append(slots, slot)
+		offset += slot.size
+	}
+
+	return slots
+}
+
+// chunkSizeRange returns the smallest and largest chunk profile produces
+func chunkSizeRange(profile string) (int, int) {
+	np, ok := nameProfiles[profile]
+	if !ok && sizeModel() != SizeUniform {
+		return MinChunkSize - ChunkHeaderSize, MaxChunkSize - ChunkHeaderSize
+	}
+	if !ok {
+		chunkSize, variance := chunkSettings()
+		return max(1, chunkSize-chunkSize*variance/100), chunkSize + chunkSize*variance/100
+	}
+
+	lo, hi := math.MaxInt, 0
+	for _, g := range np.grammars {
+		lo = min(lo, g.minMB)
+		hi = max(hi, g.maxMB)
+	}
+	return max(MinChunkSize-ChunkHeaderSize, lo*1024*1024-ChunkHeaderSize), min(MaxChunkSize, hi*1024*1024)
+}
+
+// uniqueChunkName picks a name for the chunk in slot that is not taken yet
+// on the drive, placed by p. It returns the drive-relative name and the
+// wrap format.
+func uniqueChunkName(drivePath, profile string, slot chunkSlot, p *placer) (string, string, error) {
+	for try := 0; ; try++ {
+		// Grammars with few names can run out in one directory
+		if try == 16 {
+			slot.grammar = nil
+		}
+		if try == 32 {
+			profile = ProfileMixed
+		}
+
+		name, format := newChunkName(profile, slot)
+		name, err := p.place(name)
+		if err != nil {
+			return "", "", err
+		}
+		if _, err := os.Lstat(filepath.Join(drivePath, name)); err != nil {
+			return name, format, nil
+		}
+	}
+}
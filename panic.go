@@ -126,7 +126,9 @@ func GetHotkeyStatus() string {
 	return "F12 (" + T("in_app_only") + ")"
 }
 
-// EncryptAllDecrypted encrypts all currently decrypted drives with sessions
+// EncryptAllDecrypted encrypts all currently decrypted drives with sessions.
+// Drives that are already sealed are left alone, never reshuffled: a panic
+// lock is no time to rewrite whole vaults.
 func EncryptAllDecrypted(progress ProgressFunc) []error {
 	devices, err := ScanDevices()
 	if err != nil {
@@ -136,7 +138,7 @@ func EncryptAllDecrypted(progress ProgressFunc) []error {
 	var errors []error
 
 	for _, dev := range devices {
-		if dev.IsEncrypted {
+		if dev.Interrupted || dev.IsEncrypted {
 			continue
 		}
 
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	mrand "math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Placement strategies for chunks and decoys
+const (
+	PlaceRoot    = "root"    // everything in the drive root
+	PlaceScatter = "scatter" // spread across OS-like directory trees
+)
+
+var PlacementStrategies = []string{PlaceRoot, PlaceScatter}
+
+// clutterTree is a directory layout operating systems and apps leave on
+// removable drives. leaf returns a directory below root, or "" for root
+// itself.
+type clutterTree struct {
+	root string
+	leaf func(r *mrand.Rand) string
+}
+
+var clutterTrees = []clutterTree{
+	{"System Volume Information", func(r *mrand.Rand) string {
+		return fmt.Sprintf("_restore%s/RP%d", clutterGUID(r), r.Intn(400)+1)
+	}},
+	{".Trashes", func(r *mrand.Rand) string {
+		return "501"
+	}},
+	{"FOUND.000", func(r *mrand.Rand) string {
+		return ""
+	}},
+	{".Spotlight-V100", func(r *mrand.Rand) string {
+		return "Store-V2/" + strings.Trim(clutterGUID(r), "{}")
+	}},
+	{".fseventsd", func(r *mrand.Rand) string {
+		return ""
+	}},
+	{".TemporaryItems", func(r *mrand.Rand) string {
+		return "folders.501/TemporaryItems"
+	}},
+	{"AppData", func(r *mrand.Rand) string {
+		if r.Intn(2) == 0 {
+			return "Local/Temp/" + clutterGUID(r)
+		}
+		return "Local/Microsoft/Windows/INetCache/IE/" + clutterAlnum(r, 8)
+	}},
+	{"$RECYCLE.BIN", func(r *mrand.Rand) string {
+		return fmt.Sprintf("S-1-5-21-%d-%d-%d-1001", 1e9+r.Int63n(3e9), 1e9+r.Int63n(3e9), 1e9+r.Int63n(3e9))
+	}},
+	{".Trash-1000", func(r *mrand.Rand) string {
+		return "files"
+	}},
+}
+
+func clutterGUID(r *mrand.Rand) string {
+	b := make([]byte, 16)
+	r.Read(b)
+	return fmt.Sprintf("{%X-%X-%X-%X-%X}", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func clutterAlnum(r *mrand.Rand, n int) string {
+	const chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = chars[r.Intn(len(chars))]
+	}
+	return string(b)
+}
+
+// isClutterRoot reports whether name is the top directory of a clutter tree
+func isClutterRoot(name string) bool {
+	for _, t := range clutterTrees {
+		if t.root == name {
+			return true
+		}
+	}
+	return false
+}
+
+// placer picks where new chunks and decoys go. A nil placer keeps them in
+// the drive root.
+type placer struct {
+	drivePath string
+	j         *Journal
+	dirs      []string
+	made      map[string]bool
+}
+
+// newPlacer returns a placer for the configured strategy. Trees that already
+// exist on the drive are left alone unless they belong to this vault, so
+// removing the vault never touches the user's own directories.
+func newPlacer(drivePath string, manifest *VaultManifest, j *Journal) *placer {
+	if AppConfig.Placement != PlaceScatter {
+		return nil
+	}
+
+	names := append([]string(nil), manifest.Decoys...)
+	for _, chunk := range manifest.Chunks {
+		if chunk.Cover == "" {
+			names = append(names, chunk.Name)
+		}
+	}
+
+	ours := make(map[string]bool)
+	for _, dir := range placedDirs(names) {
+		ours[dir] = true
+	}
+
+	r := decoyRand()
+	p := &placer{drivePath: drivePath, j: j, made: make(map[string]bool)}
+
+	for _, i := range r.Perm(len(clutterTrees))[:3+r.Intn(4)] {
+		t := clutterTrees[i]
+		if _, err := os.Lstat(filepath.Join(drivePath, t.root)); err == nil && !ours[t.root] {
+			continue
+		}
+		p.dirs = append(p.dirs, path.Join(t.root, t.leaf(r)))
+	}
+
+	if len(p.dirs) == 0 {
+		return nil
+	}
+	return p
+}
+
+// place returns the drive-relative path for a new file called name and
+// creates its directory
+func (p *placer) place(name string) (string, error) {
+	if p == nil {
+		return name, nil
+	}
+
+	dir := p.dirs[randomIntN(len(p.dirs))]
+	if !p.made[dir] {
+		parts := strings.Split(dir, "/")
+		for i := range parts {
+			rel := strings.Join(parts[:i+1], "/")
+			full := filepath.Join(p.drivePath, rel)
+			if _, err := os.Lstat(full); err == nil {
+				continue
+			}
+			if err := p.j.addCreated(rel); err != nil {
+				return "", err
+			}
+			if err := os.Mkdir(full, 0755); err != nil {
+				return "", err
+			}
+		}
+		p.made[dir] = true
+	}
+
+	return path.Join(dir, name), nil
+}
+
+// placedDirs lists the directories above the given drive-relative paths,
+// deepest first
+func placedDirs(names []string) []string {
+	seen := make(map[string]bool)
+	var dirs []string
+
+	for _, name := range names {
+		for dir := path.Dir(name); dir != "." && dir != "/" && !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], "/") > strings.Count(dirs[j], "/")
+	})
+	return dirs
+}
+
+// removePlacedDirs deletes the directories created for names once they are
+// empty
+func removePlacedDirs(drivePath string, names []string) {
+	for _, dir := range placedDirs(names) {
+		os.Remove(filepath.Join(drivePath, dir))
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+const (
+	// FAT cannot hold files of 4 GB or more
+	fatMaxFileSize = 4*1024*1024*1024 - 1
+
+	// A FAT directory holds at most 65536 entries and every long file
+	// name takes several of them: one per 13 characters plus a short one
+	fatMaxDirEntries  = 65536
+	fatEntriesPerFile = 4
+	fatNameChars      = 13
+
+	// Encrypt adds a flag, salt, nonces and tags around the payload
+	vaultOverhead = 1 + SaltSize + XNonceSize + NonceSize + 16 + 16
+
+	// Headroom for the manifest, journal and filesystem metadata
+	preflightMargin = 1024 * 1024
+)
+
+// preflightEncrypt checks that a vault sealing archiveSize bytes fits on the
+// drive before anything is written
+func preflightEncrypt(drivePath, profile string, archiveSize int64) error {
+	vaultSize := archiveSize + vaultOverhead
+	pieces := int64(1)
+
+	if AppConfig.UseChunks {
+		// A plan drawn like the real one splits the vault at the mean
+		// chunk size of the profile and size model
+		pieces = int64(len(planChunks(newSizer(drivePath, nil), profile, int(vaultSize))))
+	}
+
+	// Covers take the vault without growing, bar one temporary copy of
+	// the largest
+	var coverCopy int64
+	if AppConfig.Stego {
+		covers := EstimateCovers(drivePath)
+		if covers.Capacity < vaultSize {
+			return fmt.Errorf("%s (%s / %s)", T("preflight_covers"),
+				FormatBytes(uint64(max(covers.Capacity, 0))), FormatBytes(uint64(vaultSize)))
+		}
+		for _, c := range covers.Covers {
+			if info, err := os.Stat(filepath.Join(drivePath, filepath.FromSlash(c.Name))); err == nil {
+				coverCopy = max(coverCopy, info.Size())
+			}
+		}
+		vaultSize, pieces = 0, 0
+	}
+
+	need := vaultSize + coverCopy + pieces*ChunkHeaderSize + preflightMargin
+	if AppConfig.UseChunks && AppConfig.WrapChunks {
+		need += pieces * wrapMaxOverhead
+	}
+
+	decoys := int64(0)
+	if AppConfig.GenerateDecoys {
+		decoys = int64(AppConfig.DecoyCount)
+		need += decoys * MaxDecoySize
+	}
+
+	fs := filesystemType(drivePath)
+	if isFAT(fs) {
+		if !AppConfig.UseChunks && vaultSize+ChunkHeaderSize > fatMaxFileSize {
+			return fmt.Errorf("%s (%s, %s)", T("preflight_fat_file"), fs, FormatBytes(uint64(vaultSize)))
+		}
+		if fatBusiestDir(drivePath, pieces+decoys) > fatMaxDirEntries {
+			return fmt.Errorf("%s (%s, %d)", T("preflight_fat_entries"), fs, pieces+decoys)
+		}
+	}
+
+	return checkFreeSpace(drivePath, need)
+}
+
+// fatBusiestDir estimates how many entries the fullest directory ends up
+// with once files more are written. The root still holds the files being
+// encrypted, which are only removed at the end. Scattered files spread
+// over the clutter trees the placer picks: at worst three, less any that
+// already exist.
+func fatBusiestDir(drivePath string, files int64) int64 {
+	root := int64(0)
+	if entries, err := os.ReadDir(drivePath); err == nil {
+		for _, e := range entries {
+			root += fatNameEntries(e.Name())
+		}
+	}
+
+	trees := int64(0)
+	if AppConfig.Placement == PlaceScatter {
+		trees = 3
+		for _, t := range clutterTrees {
+			if _, err := os.Lstat(filepath.Join(drivePath, t.root)); err == nil {
+				trees--
+			}
+		}
+	}
+	if trees <= 0 {
+		return root + files*fatEntriesPerFile
+	}
+
+	// Each file goes to a random tree; a third over the even share covers
+	// the spread
+	perTree := (files + trees - 1) / trees
+	perTree += perTree / 3
+	return max(root+trees*fatEntriesPerFile, perTree*fatEntriesPerFile)
+}
+
+// fatNameEntries is how many directory entries a file called name takes
+func fatNameEntries(name string) int64 {
+	return 1 + int64((utf8.RuneCountInString(name)+fatNameChars-1)/fatNameChars)
+}
+
+// preflightDecrypt checks that count files of size bytes in total can be
+// extracted next to the vault
+func preflightDecrypt(drivePath string, size int64, count int) error {
+	// Every file wastes part of its last cluster
+	slack := int64(4096)
+	if isFAT(filesystemType(drivePath)) {
+		slack = 32 * 1024
+	}
+
+	return checkFreeSpace(drivePath, size+int64(count)*slack+preflightMargin)
+}
+
+func checkFreeSpace(drivePath string, need int64) error {
+	usage, err := disk.Usage(drivePath)
+	if err != nil {
+		return nil
+	}
+
+	if uint64(need) > usage.Free {
+		return fmt.Errorf("%s: %s, %s: %s", T("preflight_no_space"), FormatBytes(uint64(need)),
+			T("preflight_free"), FormatBytes(usage.Free))
+	}
+	return nil
+}
+
+// filesystemType returns the filesystem of the partition holding path, or
+// an empty string if it cannot be determined
+func filesystemType(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+
+	partitions, err := disk.Partitions(true)
+	if err != nil {
+		return ""
+	}
+
+	best, fs := "", ""
+	for _, p := range partitions {
+		if len(p.Mountpoint) > len(best) && isUnder(abs, p.Mountpoint) {
+			best, fs = p.Mountpoint, p.Fstype
+		}
+	}
+	return fs
+}
+
+func isUnder(path, mountpoint string) bool {
+	path = strings.ToLower(filepath.Clean(path))
+	mountpoint = strings.ToLower(filepath.Clean(mountpoint))
+
+	if path == mountpoint {
+		return true
+	}
+	if !strings.HasSuffix(mountpoint, string(filepath.Separator)) {
+		mountpoint += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, mountpoint)
+}
+
+func isFAT(fs string) bool {
+	switch strings.ToLower(fs) {
+	case "vfat", "fat", "fat12", "fat16", "fat32", "msdos":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// chunkHeaderSalt is fixed because the header key has to be derivable from
+// the password alone: the per-vault salt lives in the manifest that may be
+// lost
+var chunkHeaderSalt = []byte("unfuckable-usb chunk header v1")
+
+const (
+	chunkHeaderPlainSize = 16 + 4 + 4 + 8 + 8 + 32
+
+	// Raw images are scanned for headers at sector boundaries
+	imageSectorSize = 512
+	imageBlockSize  = 4 * 1024 * 1024
+)
+
+// chunkHeader identifies a piece of vault data
+type chunkHeader struct {
+	VaultID []byte
+	Index   uint32
+	Total   uint32
+	Size    int64
+	Sealed  int64
+	HMAC    []byte
+}
+
+// RecoverReport describes a vault rebuilt from its chunk headers
+type RecoverReport struct {
+	Found  int
+	Vaults int
+	Chunks int
+	Files  int
+	Size   int64
+	Sealed time.Time
+}
+
+// String formats the report for display
+func (r *RecoverReport) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %d\n", T("recover_found"), r.Found)
+	fmt.Fprintf(&b, "%s: %d\n", T("recover_vaults"), r.Vaults)
+	fmt.Fprintf(&b, "%s: %d\n", T("recover_chunks"), r.Chunks)
+	fmt.Fprintf(&b, "%s: %d\n", T("vault_files"), r.Files)
+	fmt.Fprintf(&b, "%s: %s\n", T("vault_size"), FormatBytes(uint64(r.Size)))
+	if !r.Sealed.IsZero() {
+		fmt.Fprintf(&b, "%s: %s\n", T("vault_created"), r.Sealed.Format("2006-01-02 15:04:05"))
+	}
+
+	return b.String()
+}
+
+// foundChunk is a chunk header located in a file or disk image
+type foundChunk struct {
+	header  *chunkHeader
+	raw     []byte
+	path    string
+	offset  int64  // start of the chunk data
+	wrapped bool   // the file is a container around the chunk
+	salt    []byte // vault salt, for headers sealed with a vault's own key
+}
+
+// chunkCandidate is where a chunk header would be in a file: at its start,
+// or inside it when the file is a chunk wrapper
+type chunkCandidate struct {
+	path    string
+	raw     []byte
+	lead    []byte // what follows the header, enough for a payload's salt
+	start   int64
+	length  int64
+	wrapped bool
+}
+
+// salt returns the vault salt the candidate's payload would start with if
+// it were the first chunk of a vault
+func (c *chunkCandidate) salt() []byte {
+	if len(c.lead) < 1+SaltSize || (c.lead[0] != 0x01 && c.lead[0] != 0x02) {
+		return nil
+	}
+	return c.lead[1 : 1+SaltSize]
+}
+
+func deriveChunkHeaderKey(password []byte) []byte {
+	return DeriveKey(password, chunkHeaderSalt)
+}
+
+func chunkHeaderAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func newVaultID() []byte {
+	id, _ := RandomBytes(16)
+	return id
+}
+
+// sealChunkHeader encrypts a header into exactly ChunkHeaderSize bytes
+func sealChunkHeader(key []byte, h chunkHeader) ([]byte, error) {
+	plain := make([]byte, chunkHeaderPlainSize)
+	copy(plain[0:16], h.VaultID)
+	binary.BigEndian.PutUint32(plain[16:20], h.Index)
+	binary.BigEndian.PutUint32(plain[20:24], h.Total)
+	binary.BigEndian.PutUint64(plain[24:32], uint64(h.Size))
+	binary.BigEndian.PutUint64(plain[32:40], uint64(h.Sealed))
+	copy(plain[40:72], h.HMAC)
+
+	return EncryptAESGCM(plain, key)
+}
+
+// openChunkHeader decrypts a header, returning false for anything that was
+// not sealed with this key
+func openChunkHeader(aead cipher.AEAD, raw []byte) (*chunkHeader, bool) {
+	if len(raw) < ChunkHeaderSize {
+		return nil, false
+	}
+
+	plain, err := aead.Open(nil, raw[:NonceSize], raw[NonceSize:ChunkHeaderSize], nil)
+	if err != nil || len(plain) != chunkHeaderPlainSize {
+		return nil, false
+	}
+
+	h := &chunkHeader{
+		VaultID: plain[0:16],
+		Index:   binary.BigEndian.Uint32(plain[16:20]),
+		Total:   binary.BigEndian.Uint32(plain[20:24]),
+		Size:    int64(binary.BigEndian.Uint64(plain[24:32])),
+		Sealed:  int64(binary.BigEndian.Uint64(plain[32:40])),
+		HMAC:    plain[40:72],
+	}
+	if h.Total == 0 || h.Index >= h.Total || h.Size < 0 {
+		return nil, false
+	}
+
+	return h, true
+}
+
+// RecoverVault rebuilds the manifest of a vault from its chunk headers.
+// source is a drive folder or a raw disk image. Chunks found elsewhere than
+// in drivePath itself are copied there under new names. When several seals
+// of a vault are found, the newest complete one wins.
+//
+// Headers sealed while the password was typed are found with the key
+// derived from the password alone. Headers sealed from a session use the
+// key of their own vault, which only a folder scan can find: the salt of
+// every payload that could start a vault is tried.
+func RecoverVault(source, drivePath string, password *SecureBuffer, progress ProgressFunc) (*RecoverReport, error) {
+	if checkEncrypted(drivePath) {
+		return nil, fmt.Errorf("%s already holds a vault", drivePath)
+	}
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+
+	headerKey := deriveChunkHeaderKey(password.Bytes())
+	aead, err := chunkHeaderAEAD(headerKey)
+	SecureZero(headerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []foundChunk
+	if info.IsDir() {
+		candidates := scanChunkFiles(source, progress)
+		found = openCandidates(candidates, aead, nil)
+		keyed, err := findKeyedChunks(candidates, password, progress)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, keyed...)
+	} else {
+		found, err = scanChunkImage(source, aead, progress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report := &RecoverReport{Found: len(found)}
+
+	vaults := make(map[string][]foundChunk)
+	for _, c := range found {
+		id := hex.EncodeToString(c.header.VaultID)
+		vaults[id] = append(vaults[id], c)
+	}
+	report.Vaults = len(vaults)
+
+	var seals []string
+	for id := range vaults {
+		seals = append(seals, id)
+	}
+	sort.Slice(seals, func(i, j int) bool {
+		return vaults[seals[i]][0].header.Sealed > vaults[seals[j]][0].header.Sealed
+	})
+
+	// Vaults sealed before chunk HMACs came from the master key use one
+	// derived from the password alone
+	legacyHMAC, err := deriveHMACKey(password.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(legacyHMAC)
+
+	vaultKeys := make(map[string]*VaultKeys)
+	defer func() {
+		for _, k := range vaultKeys {
+			k.Destroy()
+		}
+	}()
+	keysFor := func(salt []byte) (*VaultKeys, error) {
+		if k, ok := vaultKeys[string(salt)]; ok {
+			return k, nil
+		}
+		k, err := passwordKeys(password, salt)
+		if err != nil {
+			return nil, err
+		}
+		vaultKeys[string(salt)] = k
+		return k, nil
+	}
+
+	var keys *VaultKeys
+	var pieces []*foundChunk
+	var payloads [][]byte
+	keyed := false
+	for _, id := range seals {
+		chunks := vaults[id]
+		if chunks[0].salt == nil {
+			if pieces, payloads = assembleChunks(chunks, legacyHMAC); pieces != nil {
+				break
+			}
+		}
+
+		salt := chunks[0].salt
+		if salt == nil {
+			if salt = firstChunkSalt(chunks); salt == nil {
+				continue
+			}
+		}
+		if keys, err = keysFor(salt); err != nil {
+			return report, err
+		}
+		if pieces, payloads = assembleChunks(chunks, keys.HMAC); pieces != nil {
+			keyed = true
+			break
+		}
+	}
+	if pieces == nil {
+		return report, fmt.Errorf("no complete vault found")
+	}
+
+	if progress != nil {
+		progress(0, 1, T("decrypting"))
+	}
+
+	encrypted := bytes.Join(payloads, nil)
+	if len(encrypted) < 1+SaltSize {
+		return report, ErrInvalidData
+	}
+
+	// The rebuilt manifest is sealed with the salt of the payload, like
+	// everything else written with one set of keys
+	if keys, err = keysFor(encrypted[1 : 1+SaltSize]); err != nil {
+		return report, err
+	}
+	hmacKey := legacyHMAC
+	if keyed {
+		hmacKey = keys.HMAC
+	}
+
+	archive, err := keys.Open(encrypted)
+	if err != nil {
+		return report, ErrDecryptFailed
+	}
+	names, totalSize, err := listArchive(archive)
+	fileCount := len(names)
+	SecureZero(archive)
+	if err != nil {
+		return report, fmt.Errorf("archive is damaged: %w", err)
+	}
+
+	manifest := &VaultManifest{
+		Version:       AppVersion,
+		Created:       time.Unix(0, pieces[0].header.Sealed),
+		Modified:      time.Now(),
+		OriginalSize:  totalSize,
+		FileCount:     fileCount,
+		Files:         make(map[string]string),
+		DoubleEncrypt: encrypted[0] == 0x02,
+		UseChunks:     true,
+		TotalChunks:   len(pieces),
+		ChunkHeaders:  true,
+		KeyedHMAC:     keyed,
+	}
+	manifest.Salt, _ = GenerateSalt()
+
+	inPlace := false
+	if info.IsDir() {
+		a, _ := filepath.Abs(source)
+		b, _ := filepath.Abs(drivePath)
+		inPlace = filepath.Clean(a) == filepath.Clean(b)
+	}
+
+	// New files take their times from the chunks they were found in
+	var times []time.Time
+	for _, c := range pieces {
+		if info, err := os.Stat(c.path); err == nil {
+			times = append(times, info.ModTime())
+		}
+	}
+
+	var p *placer
+	if !inPlace {
+		p = newPlacer(drivePath, manifest, nil)
+	}
+
+	known := map[string]bool{ManifestFile: true, ExcludeFile: true}
+	for i, c := range pieces {
+		var info ChunkInfo
+		if inPlace {
+			rel, err := filepath.Rel(drivePath, c.path)
+			if err != nil {
+				return report, err
+			}
+			info, err = chunkInfoInPlace(c, payloads[i], hmacKey)
+			if err != nil {
+				return report, err
+			}
+			info.Name = filepath.ToSlash(rel)
+		} else {
+			name, format, err := uniqueChunkName(drivePath, manifest.Profile, chunkSlot{}, p)
+			if err != nil {
+				removeVaultData(drivePath, manifest)
+				return report, err
+			}
+			info, err = writeChunkFile(filepath.Join(drivePath, name), format, c.raw, payloads[i], hmacKey)
+			if err != nil {
+				removeVaultData(drivePath, manifest)
+				return report, err
+			}
+			info.Name = name
+		}
+		known[info.Name] = true
+		manifest.Chunks = append(manifest.Chunks, info)
+	}
+
+	for _, name := range decoyNames(drivePath, &VaultManifest{HasDecoy: true}) {
+		if !known[name] {
+			manifest.Decoys = append(manifest.Decoys, name)
+		}
+	}
+	manifest.HasDecoy = len(manifest.Decoys) > 0
+
+	if err := saveManifest(drivePath, manifest, keys); err != nil {
+		if !inPlace {
+			removeVaultData(drivePath, manifest)
+		}
+		return report, err
+	}
+	scrambleTimes(drivePath, manifest, times)
+
+	report.Chunks = len(pieces)
+	report.Files = fileCount
+	report.Size = totalSize
+	report.Sealed = manifest.Created
+
+	if progress != nil {
+		progress(1, 1, T("done"))
+	}
+
+	return report, nil
+}
+
+// assembleChunks orders the chunks of one seal and checks their data
+// against the HMAC in each header. Returns nil if the set is incomplete.
+func assembleChunks(chunks []foundChunk, hmacKey []byte) ([]*foundChunk, [][]byte) {
+	total := chunks[0].header.Total
+	pieces := make([]*foundChunk, total)
+	payloads := make([][]byte, total)
+
+	for i := range chunks {
+		c := &chunks[i]
+		if c.header.Total != total || pieces[c.header.Index] != nil {
+			continue
+		}
+
+		data, err := readChunkData(c)
+		if err != nil || !hmac.Equal(HMAC256(data, hmacKey), c.header.HMAC) {
+			continue
+		}
+
+		pieces[c.header.Index] = c
+		payloads[c.header.Index] = data
+	}
+
+	for _, p := range pieces {
+		if p == nil {
+			return nil, nil
+		}
+	}
+
+	return pieces, payloads
+}
+
+// chunkInfoInPlace describes a chunk file that stays where it was found
+func chunkInfoInPlace(c *foundChunk, payload, hmacKey []byte) (ChunkInfo, error) {
+	if !c.wrapped {
+		mac := hmac.New(sha256.New, hmacKey)
+		mac.Write(c.raw)
+		mac.Write(payload)
+		return ChunkInfo{Size: int64(len(c.raw) + len(payload)), HMAC: mac.Sum(nil)}, nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return ChunkInfo{}, err
+	}
+	return ChunkInfo{
+		Size: int64(len(data)),
+		HMAC: HMAC256(data, hmacKey),
+		Raw:  int64(len(c.raw) + len(payload)),
+	}, nil
+}
+
+// firstChunkSalt reads the vault salt from the start of the first chunk
+// of a seal
+func firstChunkSalt(chunks []foundChunk) []byte {
+	for i := range chunks {
+		if chunks[i].header.Index != 0 {
+			continue
+		}
+		data, err := readChunkData(&chunks[i])
+		if err == nil && len(data) >= 1+SaltSize {
+			return data[1 : 1+SaltSize]
+		}
+	}
+	return nil
+}
+
+// findKeyedChunks looks for headers sealed with the key of their own vault.
+// Every distinct salt a candidate payload starts with costs an Argon2id run.
+func findKeyedChunks(candidates []chunkCandidate, password *SecureBuffer, progress ProgressFunc) ([]foundChunk, error) {
+	var found []foundChunk
+	tried := make(map[string]bool)
+
+	for i := range candidates {
+		salt := candidates[i].salt()
+		if salt == nil || tried[string(salt)] {
+			continue
+		}
+		tried[string(salt)] = true
+
+		if progress != nil {
+			progress(int64(i), int64(len(candidates)), T("recover_scanning"))
+		}
+
+		keys, err := passwordKeys(password, salt)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := chunkHeaderAEAD(keys.Header)
+		keys.Destroy()
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, openCandidates(candidates, aead, append([]byte(nil), salt...))...)
+	}
+
+	return found, nil
+}
+
+// openCandidates returns the candidates whose header opens with aead
+func openCandidates(candidates []chunkCandidate, aead cipher.AEAD, salt []byte) []foundChunk {
+	var found []foundChunk
+	for _, c := range candidates {
+		h, ok := openChunkHeader(aead, c.raw)
+		if !ok || h.Size != c.length-ChunkHeaderSize {
+			continue
+		}
+		found = append(found, foundChunk{
+			header:  h,
+			raw:     c.raw,
+			path:    c.path,
+			offset:  c.start + ChunkHeaderSize,
+			wrapped: c.wrapped,
+			salt:    salt,
+		})
+	}
+	return found
+}
+
+// scanChunkFiles reads where a chunk header would be in every file below
+// root: at its start, or inside it when the file is a chunk wrapper
+func scanChunkFiles(root string, progress ProgressFunc) []chunkCandidate {
+	var paths []string
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		if info.Size() > ChunkHeaderSize && info.Name() != ManifestFile {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	var candidates []chunkCandidate
+	prefix := make([]byte, wrapPrefixSize)
+
+	for i, path := range paths {
+		if progress != nil {
+			progress(int64(i), int64(len(paths)), T("recover_scanning"))
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			continue
+		}
+		n, _ := io.ReadFull(f, prefix)
+
+		// A plain chunk fills the whole file after its header
+		start, length, wrapped := int64(0), info.Size(), false
+		if off, l, ok := chunkSpan(prefix[:n]); ok && off+l <= info.Size() {
+			start, length, wrapped = off, l, true
+		}
+		buf := make([]byte, ChunkHeaderSize+1+SaltSize)
+		n, err = f.ReadAt(buf, start)
+		f.Close()
+		if n < ChunkHeaderSize || (err != nil && err != io.EOF) {
+			continue
+		}
+		if int64(n) > length {
+			n = int(length)
+		}
+
+		candidates = append(candidates, chunkCandidate{
+			path:    path,
+			raw:     buf[:ChunkHeaderSize],
+			lead:    buf[ChunkHeaderSize:n],
+			start:   start,
+			length:  length,
+			wrapped: wrapped,
+		})
+	}
+
+	return candidates
+}
+
+// scanChunkImage looks for chunk headers at every sector of a disk image or
+// block device. Only chunks stored contiguously can be read back.
+func scanChunkImage(path string, aead cipher.AEAD, progress ProgressFunc) ([]foundChunk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []foundChunk
+	buf := make([]byte, imageBlockSize+ChunkHeaderSize)
+
+	for off := int64(0); off < size; off += imageBlockSize {
+		if progress != nil {
+			progress(off, size, T("recover_scanning"))
+		}
+
+		n, err := f.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		for i := 0; i < imageBlockSize && i+ChunkHeaderSize <= n; i += imageSectorSize {
+			raw := buf[i : i+ChunkHeaderSize]
+			h, ok := openChunkHeader(aead, raw)
+			if !ok {
+				continue
+			}
+
+			found = append(found, foundChunk{
+				header: h,
+				raw:    append([]byte(nil), raw...),
+				path:   path,
+				offset: off + int64(i) + ChunkHeaderSize,
+			})
+		}
+	}
+
+	return found, nil
+}
+
+func readChunkData(c *foundChunk) ([]byte, error) {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data := make([]byte, c.header.Size)
+	if _, err := f.ReadAt(data, c.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// listArchive returns the names and total size of the regular files in a
+// tar.gz archive
+func listArchive(archive []byte) ([]string, int64, error) {
+	gzReader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer gzReader.Close()
+
+	tarReader := tar.NewReader(gzReader)
+
+	var names []string
+	var size int64
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return names, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, header.Name)
+			size += header.Size
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Reports are signed with a per-install Ed25519 key kept next to the config
+const reportKeyFile = "report_signing.key"
+
+// WipeReport records how the originals on a drive were destroyed. It is
+// signed so it can be handed to an auditor as proof.
+type WipeReport struct {
+	Operation  string           `json:"operation"`
+	Drive      string           `json:"drive"`
+	DriveID    string           `json:"drive_id"`
+	Host       string           `json:"host"`
+	Method     string           `json:"method"`
+	Passes     int              `json:"passes"`
+	Verify     bool             `json:"verify"`
+	FlashAware bool             `json:"flash_aware"`
+	Started    time.Time        `json:"started"`
+	Finished   time.Time        `json:"finished"`
+	Files      []WipeReportFile `json:"files"`
+	PublicKey  string           `json:"public_key,omitempty"`
+	Signature  string           `json:"signature,omitempty"`
+}
+
+// WipeReportFile is one wiped file
+type WipeReportFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Passes   int       `json:"passes"`
+	Verified bool      `json:"verified"`
+	Wiped    time.Time `json:"wiped"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// newWipeReport starts a report for op, or returns nil when reports are
+// disabled. The other methods accept a nil report.
+func newWipeReport(op, drivePath, driveID string) *WipeReport {
+	if !AppConfig.WipeReport {
+		return nil
+	}
+
+	host, _ := os.Hostname()
+	r := &WipeReport{
+		Operation: op,
+		Drive:     drivePath,
+		DriveID:   driveID,
+		Host:      host,
+		Method:    "delete",
+		Started:   time.Now(),
+	}
+
+	if AppConfig.SecureWipe {
+		r.Method = AppConfig.WipeStrategy
+		r.Passes = len(wipePasses())
+		r.Verify = AppConfig.WipeVerify
+		r.FlashAware = AppConfig.WipeFlashAware
+	}
+
+	return r
+}
+
+func (r *WipeReport) add(drivePath string, res WipeResult) {
+	if r == nil {
+		return
+	}
+
+	name := res.Path
+	if rel, err := filepath.Rel(drivePath, res.Path); err == nil {
+		name = filepath.ToSlash(rel)
+	}
+
+	f := WipeReportFile{
+		Name:     name,
+		Size:     res.Size,
+		Passes:   res.Passes,
+		Verified: res.Verified,
+		Wiped:    res.Time,
+	}
+	if res.Err != nil {
+		f.Error = res.Err.Error()
+	}
+	r.Files = append(r.Files, f)
+}
+
+// Failed counts the files that could not be wiped
+func (r *WipeReport) Failed() int {
+	n := 0
+	for _, f := range r.Files {
+		if f.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// signedBytes is the JSON the signature covers
+func (r *WipeReport) signedBytes() ([]byte, error) {
+	c := *r
+	c.Signature = ""
+	return json.Marshal(&c)
+}
+
+func (r *WipeReport) sign() error {
+	key, err := reportSigningKey()
+	if err != nil {
+		return err
+	}
+
+	r.Finished = time.Now()
+	r.PublicKey = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+
+	data, err := r.signedBytes()
+	if err != nil {
+		return err
+	}
+	r.Signature = hex.EncodeToString(ed25519.Sign(key, data))
+	return nil
+}
+
+// VerifyWipeReport checks the report signature against its public key and
+// tells whether that key is this install's. Anyone can sign an edited
+// report with a key of their own, so a report signed elsewhere proves
+// nothing until its public key is compared with the signing machine's.
+func VerifyWipeReport(r *WipeReport) (local bool, err error) {
+	pub, err := hex.DecodeString(r.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false, errors.New("report has no valid public key")
+	}
+	sig, err := hex.DecodeString(r.Signature)
+	if err != nil {
+		return false, errors.New("report has no valid signature")
+	}
+
+	data, err := r.signedBytes()
+	if err != nil {
+		return false, err
+	}
+	if !ed25519.Verify(pub, data, sig) {
+		return false, errors.New("report signature does not match")
+	}
+
+	key, err := loadReportSigningKey()
+	if err != nil || key == nil {
+		return false, nil
+	}
+	return key.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(pub)), nil
+}
+
+// loadReportSigningKey reads the signing key, or returns nil if this
+// install has not signed anything yet
+func loadReportSigningKey() (ed25519.PrivateKey, error) {
+	path := filepath.Join(getConfigDir(), reportKeyFile)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid signing key in %s", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// reportSigningKey loads the signing key, creating it on first use
+func reportSigningKey() (ed25519.PrivateKey, error) {
+	if key, err := loadReportSigningKey(); key != nil || err != nil {
+		return key, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(getConfigDir(), reportKeyFile)
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// String renders the report as plain text
+func (r *WipeReport) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %s\n", T("report_operation"), r.Operation)
+	fmt.Fprintf(&b, "%s: %s (%s)\n", T("report_drive"), r.Drive, r.DriveID)
+	fmt.Fprintf(&b, "%s: %s\n", T("report_host"), r.Host)
+	fmt.Fprintf(&b, "%s: %s, %d\n", T("report_method"), r.Method, r.Passes)
+	fmt.Fprintf(&b, "%s: %v, %s: %v\n", T("wipe_verify"), r.Verify, T("wipe_flash_aware"), r.FlashAware)
+	fmt.Fprintf(&b, "%s: %s\n", T("report_started"), r.Started.Format(time.RFC3339))
+	fmt.Fprintf(&b, "%s: %s\n", T("report_finished"), r.Finished.Format(time.RFC3339))
+	fmt.Fprintf(&b, "%s: %d, %s: %d\n\n", T("report_files"), len(r.Files), T("report_failed"), r.Failed())
+
+	for _, f := range r.Files {
+		status := "ok"
+		if f.Verified {
+			status = "verified"
+		}
+		if f.Error != "" {
+			status = "FAILED: " + f.Error
+		}
+		fmt.Fprintf(&b, "%s  %12d  %d  %s  %s\n", f.Wiped.Format(time.RFC3339), f.Size, f.Passes, f.Name, status)
+	}
+
+	fmt.Fprintf(&b, "\n%s: %s\n", T("report_public_key"), r.PublicKey)
+	fmt.Fprintf(&b, "%s: %s\n", T("report_signature"), r.Signature)
+	return b.String()
+}
+
+// wipeReportDir is where reports are exported to
+func wipeReportDir() string {
+	if AppConfig.WipeReportDir != "" {
+		return AppConfig.WipeReportDir
+	}
+	return filepath.Join(getConfigDir(), "reports")
+}
+
+// ExportWipeReport writes the report as JSON and plain text into dir and
+// returns the JSON path
+func ExportWipeReport(r *WipeReport, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("wipe-%s-%s", r.Operation, r.Finished.Format("20060102-150405")))
+	if err := os.WriteFile(base+".json", data, 0600); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(base+".txt", []byte(r.String()), 0600); err != nil {
+		return "", err
+	}
+	return base + ".json", nil
+}
+
+// LoadWipeReport returns the report stored in an encrypted vault
+func LoadWipeReport(drivePath string, keys *VaultKeys) (*WipeReport, error) {
+	manifest, err := loadManifest(drivePath, keys)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.WipeReport == nil {
+		return nil, errors.New(T("report_none"))
+	}
+	return manifest.WipeReport, nil
+}
+
+// storeWipeReport signs the report, saves it in the vault manifest and
+// exports a copy when an export folder is set
+func storeWipeReport(r *WipeReport, drivePath string, manifest *VaultManifest, keys *VaultKeys) error {
+	if err := r.sign(); err != nil {
+		return err
+	}
+
+	manifest.WipeReport = r
+	if err := saveManifest(drivePath, manifest, keys); err != nil {
+		return err
+	}
+
+	if AppConfig.WipeReportDir != "" {
+		if _, err := ExportWipeReport(r, AppConfig.WipeReportDir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ReshuffleVault splits the vault ciphertext again into chunks with new
+// sizes, names and places, writes fresh decoys and removes the old layout.
+// Two images of the drive taken before and after share no chunk files, so
+// they no longer show which part of the vault changed.
+func ReshuffleVault(drivePath, driveID string, keys *VaultKeys, progress ProgressFunc) error {
+	if HasJournal(drivePath) {
+		return ErrInterrupted
+	}
+
+	manifest, err := loadManifest(drivePath, keys)
+	if err != nil {
+		return errWrongPassword
+	}
+
+	encrypted, err := readVaultData(drivePath, manifest, keys, progress)
+	if err != nil {
+		return err
+	}
+
+	if progress != nil {
+		progress(manifest.OriginalSize/4, manifest.OriginalSize, T("reshuffling"))
+	}
+
+	var old []string
+	for _, name := range vaultFileNames(drivePath, manifest) {
+		if name != ManifestFile && name != JournalFile {
+			old = append(old, name)
+		}
+	}
+	times := vaultTimes(drivePath, manifest)
+
+	j, err := beginJournal(drivePath, JournalReshuffle, PhaseSealing, keys)
+	if err != nil {
+		return fmt.Errorf("journal failed: %w", err)
+	}
+
+	// The old manifest stays in place until the new layout is complete
+	abort := func(err error) error {
+		j.removeCreated()
+		j.finish()
+		return err
+	}
+
+	fresh := *manifest
+	fresh.Files = make(map[string]string)
+	fresh.Chunks = nil
+	fresh.ChunkNames = nil
+	fresh.ChunkSizes = nil
+	fresh.TotalChunks = 0
+	fresh.ChunkHeaders = false
+	fresh.Decoys = nil
+	fresh.HasDecoy = AppConfig.GenerateDecoys
+	fresh.Profile = driveNameProfile(driveID)
+
+	var decoyFiles []string
+	if fresh.HasDecoy {
+		decoyFiles = generateDecoyFileNames(AppConfig.DecoyCount)
+	}
+
+	// Covers of the old layout keep their data until the new one is done
+	st := newChunkStore(drivePath, &fresh, append(old, coverNames(manifest)...))
+	if err := writeVaultWithDecoys(drivePath, encrypted, &fresh, keys, st, j, decoyFiles); err != nil {
+		return abort(err)
+	}
+
+	if progress != nil {
+		progress(manifest.OriginalSize/2, manifest.OriginalSize, T("verifying"))
+	}
+
+	check, err := readVaultData(drivePath, &fresh, keys, nil)
+	if err != nil {
+		return abort(err)
+	}
+	if !bytes.Equal(check, encrypted) {
+		return abort(fmt.Errorf("reshuffled vault does not match"))
+	}
+
+	// The journal carries the new manifest, so a crash between here and
+	// the last old file going away can always be finished
+	j.Manifest = &fresh
+	j.Files = old
+	if err := j.setPhase(PhaseWiping); err != nil {
+		return abort(err)
+	}
+	if err := saveManifest(drivePath, &fresh, keys); err != nil {
+		return err
+	}
+
+	if progress != nil {
+		progress(manifest.OriginalSize*3/4, manifest.OriginalSize, T("wiping"))
+	}
+
+	var failed []WipeResult
+	for _, name := range old {
+		path := filepath.Join(drivePath, filepath.FromSlash(name))
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
+		}
+		if res := removeOriginal(path, info.Size()); res.Err != nil {
+			failed = append(failed, res)
+		}
+	}
+	removePlacedDirs(drivePath, old)
+
+	scrambleTimes(drivePath, &fresh, times)
+	j.finish()
+
+	if progress != nil {
+		progress(manifest.OriginalSize, manifest.OriginalSize, T("done"))
+	}
+
+	if len(failed) > 0 {
+		return &WipeError{Failed: failed}
+	}
+	return nil
+}
+
+// finishReshuffle completes an interrupted reshuffle that already wrote its
+// new layout: the new manifest is saved again and the old files removed
+func (j *Journal) finishReshuffle(keys *VaultKeys) error {
+	if err := saveManifest(j.drivePath, j.Manifest, keys); err != nil {
+		j.close()
+		return err
+	}
+	for _, name := range j.Files {
+		path := filepath.Join(j.drivePath, filepath.FromSlash(name))
+		if AppConfig.SecureWipe {
+			SecureDelete(path)
+		} else {
+			os.Remove(path)
+		}
+	}
+	removePlacedDirs(j.drivePath, j.Files)
+	j.finish()
+	return nil
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+// SalvageReportFile is written into the destination folder after salvage
+const SalvageReportFile = "salvage-report.txt"
+
+// SalvageReport describes what salvage could and could not restore
+type SalvageReport struct {
+	Files         int
+	Chunks        int
+	DamagedChunks []string
+	LostBytes     int64
+	Segments      int
+	LostSegments  int // segments cut short by damage
+	Recovered     []string
+	Truncated     []string
+}
+
+// defaultSalvagePath suggests a fresh folder in the user's home directory,
+// never on the damaged drive itself
+func defaultSalvagePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.TempDir()
+	}
+	return filepath.Join(home, "UnFuckable-salvage-"+time.Now().Format("20060102-150405"))
+}
+
+// byteRange is a half-open [Start, End) range of the vault payload
+type byteRange struct {
+	Start, End int
+}
+
+// String formats the report for display
+func (r *SalvageReport) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %d/%d\n", T("salvage_recovered"), len(r.Recovered), r.Files)
+	fmt.Fprintf(&b, "%s: %d/%d\n", T("salvage_damaged_chunks"), len(r.DamagedChunks), r.Chunks)
+	fmt.Fprintf(&b, "%s: %s\n", T("salvage_lost_bytes"), FormatBytes(uint64(r.LostBytes)))
+	fmt.Fprintf(&b, "%s: %d\n", T("salvage_segments"), r.Segments)
+	fmt.Fprintf(&b, "%s: %d\n", T("salvage_lost_segments"), r.LostSegments)
+
+	if len(r.DamagedChunks) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", T("salvage_damaged_chunks"))
+		for _, name := range r.DamagedChunks {
+			fmt.Fprintf(&b, "  %s\n", name)
+		}
+	}
+
+	if len(r.Truncated) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", T("salvage_lost_files"))
+		for _, name := range r.Truncated {
+			fmt.Fprintf(&b, "  %s\n", name)
+		}
+	}
+
+	if len(r.Recovered) > 0 {
+		fmt.Fprintf(&b, "\n%s:\n", T("salvage_recovered"))
+		for _, name := range r.Recovered {
+			fmt.Fprintf(&b, "  %s\n", name)
+		}
+	}
+
+	return b.String()
+}
+
+// SalvageVault restores every readable file of a damaged vault into destPath.
+// Chunks that fail their HMAC are skipped, intact ranges are decrypted with
+// the raw stream ciphers and the archive is resynchronised on the next gzip
+// segment. The vault itself is left untouched.
+func SalvageVault(drivePath string, keys *VaultKeys, destPath string, progress ProgressFunc) (*SalvageReport, error) {
+	manifest, err := loadManifest(drivePath, keys)
+	if err != nil {
+		return nil, errWrongPassword
+	}
+
+	report := &SalvageReport{Files: manifest.FileCount}
+
+	if progress != nil {
+		progress(0, manifest.OriginalSize, T("reading_chunks"))
+	}
+
+	encrypted, damaged, err := readVaultDataSalvage(drivePath, manifest, keys, report)
+	if err != nil {
+		return nil, err
+	}
+
+	if progress != nil {
+		progress(manifest.OriginalSize/4, manifest.OriginalSize, T("decrypting"))
+	}
+
+	plaintext, offset, err := decryptKeystream(encrypted, keys, damaged)
+	if err != nil {
+		return nil, err
+	}
+	defer SecureZero(plaintext)
+
+	// Shift damaged ranges from payload offsets to plaintext offsets
+	var lost []byteRange
+	for _, r := range damaged {
+		start, end := r.Start-offset, r.End-offset
+		if start < 0 {
+			start = 0
+		}
+		if end > len(plaintext) {
+			end = len(plaintext)
+		}
+		if start < end {
+			lost = append(lost, byteRange{start, end})
+		}
+	}
+
+	if progress != nil {
+		progress(manifest.OriginalSize/2, manifest.OriginalSize, T("extracting"))
+	}
+
+	if err := os.MkdirAll(destPath, 0755); err != nil {
+		return nil, err
+	}
+
+	salvageArchive(plaintext, lost, destPath, report)
+
+	sort.Strings(report.Recovered)
+	sort.Strings(report.Truncated)
+
+	os.WriteFile(filepath.Join(destPath, SalvageReportFile), []byte(report.String()), 0644)
+
+	if progress != nil {
+		progress(manifest.OriginalSize, manifest.OriginalSize, T("done"))
+	}
+
+	return report, nil
+}
+
+// readVaultDataSalvage reassembles the payload like readVaultData, but fills
+// missing or corrupted chunks with zeros and returns their ranges instead
+// of failing
+func readVaultDataSalvage(drivePath string, manifest *VaultManifest, keys *VaultKeys, report *SalvageReport) ([]byte, []byteRange, error) {
+	if !manifest.UseChunks || (len(manifest.Chunks) == 0 && len(manifest.ChunkNames) == 0) {
+		vaultName, ok := manifest.Files["__vault__"]
+		if !ok {
+			return nil, nil, fmt.Errorf("vault file not found")
+		}
+
+		report.Chunks = 1
+		data, err := os.ReadFile(filepath.Join(drivePath, "."+vaultName))
+		if err != nil {
+			return nil, nil, fmt.Errorf("vault read failed: %w", err)
+		}
+		data, err = stripChunkHeader(data, manifest)
+		return data, nil, err
+	}
+
+	var hmacKey []byte
+	if len(manifest.Chunks) > 0 {
+		var err error
+		if hmacKey, err = keys.hmacFor(manifest); err != nil {
+			return nil, nil, err
+		}
+		defer SecureZero(hmacKey)
+	}
+
+	var parts []ChunkInfo
+	if len(manifest.Chunks) > 0 {
+		parts = manifest.Chunks
+	} else {
+		for i, name := range manifest.ChunkNames {
+			size := int64(-1)
+			if i < len(manifest.ChunkSizes) {
+				size = manifest.ChunkSizes[i]
+			}
+			parts = append(parts, ChunkInfo{Name: name, Size: size})
+		}
+	}
+
+	var encrypted []byte
+	var damaged []byteRange
+
+	for _, p := range parts {
+		report.Chunks++
+
+		data, err := readChunkFile(drivePath, p)
+		ok := err == nil
+		if ok && p.Size >= 0 && int64(len(data)) != p.Size {
+			ok = false
+		}
+		if ok && p.HMAC != nil && !hmac.Equal(HMAC256(data, hmacKey), p.HMAC) {
+			ok = false
+		}
+
+		if ok {
+			payload, err := chunkPayload(data, p, manifest)
+			if err != nil {
+				return nil, nil, fmt.Errorf("chunk read failed: %s: %w", p.Name, err)
+			}
+			encrypted = append(encrypted, payload...)
+			continue
+		}
+
+		if p.Size < 0 {
+			return nil, nil, fmt.Errorf("chunk read failed: %s: size unknown", p.Name)
+		}
+
+		size := p.Size
+		if p.Raw > 0 {
+			size = p.Raw
+		}
+		if manifest.ChunkHeaders {
+			size -= ChunkHeaderSize
+		}
+
+		report.DamagedChunks = append(report.DamagedChunks, p.Name)
+		report.LostBytes += size
+
+		start := len(encrypted)
+		encrypted = append(encrypted, make([]byte, size)...)
+		damaged = append(damaged, byteRange{start, len(encrypted)})
+	}
+
+	return encrypted, damaged, nil
+}
+
+// decryptKeystream undoes the encryption layers of Encrypt without checking
+// the authentication tags. It is only used by salvage, where intact ranges
+// have already been authenticated by their chunk HMACs. Returns the
+// plaintext and the payload offset at which it starts.
+func decryptKeystream(encrypted []byte, keys *VaultKeys, damaged []byteRange) ([]byte, int, error) {
+	if len(encrypted) < 1+SaltSize {
+		return nil, 0, ErrInvalidData
+	}
+
+	flag := encrypted[0]
+
+	headerLen := 1 + SaltSize + 12
+	if flag == 0x02 {
+		headerLen += XNonceSize
+	}
+	for _, r := range damaged {
+		if r.Start < headerLen {
+			return nil, 0, fmt.Errorf("vault header is damaged, nothing can be recovered")
+		}
+	}
+
+	tagLen := 16
+	if flag == 0x02 {
+		tagLen = 32
+	}
+	if len(encrypted) < headerLen+tagLen {
+		return nil, 0, ErrInvalidData
+	}
+
+	key, ok := keys.masterFor(encrypted[1 : 1+SaltSize])
+	if !ok {
+		return nil, 0, ErrDecryptFailed
+	}
+	defer SecureZero(key)
+
+	data := encrypted[1+SaltSize:]
+	offset := 1 + SaltSize
+
+	if flag == 0x02 {
+		key2 := DeriveSecondKey(key)
+		defer SecureZero(key2)
+
+		stream, err := chacha20.NewUnauthenticatedCipher(key2, data[:XNonceSize])
+		if err != nil {
+			return nil, 0, err
+		}
+		stream.SetCounter(1)
+
+		body := data[XNonceSize : len(data)-16]
+		layer1 := make([]byte, len(body))
+		stream.XORKeyStream(layer1, body)
+
+		data = layer1
+		offset += XNonceSize
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// GCM encrypts with CTR mode starting from counter block nonce||2
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, data[:NonceSize])
+	iv[aes.BlockSize-1] = 2
+
+	body := data[NonceSize : len(data)-16]
+	plaintext := make([]byte, len(body))
+	cipher.NewCTR(block, iv).XORKeyStream(plaintext, body)
+
+	if flag == 0x02 {
+		SecureZero(data)
+	}
+
+	return plaintext, offset + NonceSize, nil
+}
+
+// salvageArchive walks the gzip members of a damaged archive, skipping the
+// lost ranges, and extracts every complete tar entry into destPath
+func salvageArchive(archive []byte, lost []byteRange, destPath string, report *SalvageReport) {
+	gzipMagic := []byte{0x1f, 0x8b, 0x08}
+
+	pos := 0
+	for pos < len(archive) {
+		idx := bytes.Index(archive[pos:], gzipMagic)
+		if idx < 0 {
+			break
+		}
+		start := pos + idx
+
+		if r, inside := rangeAt(lost, start); inside {
+			pos = r.End
+			continue
+		}
+
+		limit := len(archive)
+		if r, ok := nextRange(lost, start); ok {
+			limit = r.Start
+		}
+
+		reader := bytes.NewReader(archive[start:limit])
+		zr, err := gzip.NewReader(reader)
+		if err != nil {
+			pos = start + 1
+			continue
+		}
+		zr.Multistream(false)
+
+		var out bytes.Buffer
+		_, err = io.Copy(&out, zr)
+		zr.Close()
+
+		extractSalvagedEntries(out.Bytes(), destPath, report)
+		SecureZero(out.Bytes())
+
+		if err == nil {
+			report.Segments++
+			pos = start + (limit - start - reader.Len())
+			continue
+		}
+
+		// The member runs into a damaged range or was a false match
+		if out.Len() > 0 || limit < len(archive) {
+			report.LostSegments++
+		}
+		if r, ok := nextRange(lost, start); ok && limit == r.Start {
+			pos = r.End
+		} else {
+			pos = start + 1
+		}
+	}
+}
+
+// extractSalvagedEntries writes every complete regular file found in a
+// decompressed segment. Entries cut short are reported as lost.
+func extractSalvagedEntries(data []byte, destPath string, report *SalvageReport) {
+	tr := tar.NewReader(bytes.NewReader(data))
+
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			return
+		}
+
+		name := path.Clean("/" + strings.ReplaceAll(header.Name, "\\", "/"))
+		if name == "/" {
+			continue
+		}
+		target := filepath.Join(destPath, filepath.FromSlash(name))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			os.MkdirAll(target, 0755)
+
+		case tar.TypeReg:
+			content, err := io.ReadAll(tr)
+			if err != nil || int64(len(content)) != header.Size {
+				report.Truncated = append(report.Truncated, strings.TrimPrefix(name, "/"))
+				SecureZero(content)
+				return
+			}
+
+			os.MkdirAll(filepath.Dir(target), 0755)
+			if err := os.WriteFile(target, content, 0644); err == nil {
+				os.Chtimes(target, time.Now(), header.ModTime)
+				report.Recovered = append(report.Recovered, strings.TrimPrefix(name, "/"))
+			}
+			SecureZero(content)
+		}
+	}
+}
+
+func rangeAt(ranges []byteRange, pos int) (byteRange, bool) {
+	for _, r := range ranges {
+		if pos >= r.Start && pos < r.End {
+			return r, true
+		}
+	}
+	return byteRange{}, false
+}
+
+func nextRange(ranges []byteRange, pos int) (byteRange, bool) {
+	for _, r := range ranges {
+		if r.Start >= pos {
+			return r, true
+		}
+	}
+	return byteRange{}, false
+}
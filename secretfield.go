@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/subtle"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// SecretField is a masked form field that keeps what is typed in a
+// SecureBuffer. Unlike tview's password field it never turns the text
+// into a string. Take hands the secret over; Destroy drops it when the
+// form is cancelled.
+type SecretField struct {
+	*tview.Box
+
+	label      string
+	labelWidth int
+	width      int
+	disabled   bool
+	finished   func(tcell.Key)
+
+	labelColor     tcell.Color
+	fieldTextColor tcell.Color
+	fieldBgColor   tcell.Color
+
+	buf *SecureBuffer // grows by doubling; the secret is buf[:n]
+	n   int
+}
+
+func NewSecretField(label string, width int) *SecretField {
+	return &SecretField{
+		Box:            tview.NewBox(),
+		label:          label,
+		width:          width,
+		labelColor:     tview.Styles.SecondaryTextColor,
+		fieldTextColor: tview.Styles.PrimaryTextColor,
+		fieldBgColor:   tview.Styles.ContrastBackgroundColor,
+	}
+}
+
+// addSecretField adds a new SecretField to form and returns it
+func addSecretField(form *tview.Form, label string, width int) *SecretField {
+	field := NewSecretField(label, width)
+	form.AddFormItem(field)
+	return field
+}
+
+// Len is the length of the secret in bytes
+func (f *SecretField) Len() int {
+	return f.n
+}
+
+// Equal compares the secrets of two fields in constant time
+func (f *SecretField) Equal(other *SecretField) bool {
+	return subtle.ConstantTimeCompare(f.bytes(), other.bytes()) == 1
+}
+
+func (f *SecretField) bytes() []byte {
+	if f.buf == nil {
+		return nil
+	}
+	return f.buf.Bytes()[:f.n]
+}
+
+// Take returns the secret in a buffer of its own, which the caller
+// destroys, and empties the field
+func (f *SecretField) Take() (*SecureBuffer, error) {
+	secret, err := concatSecure(f.bytes())
+	f.Destroy()
+	return secret, err
+}
+
+// Destroy zeroes and releases what was typed
+func (f *SecretField) Destroy() {
+	if f == nil {
+		return
+	}
+	f.buf.Destroy()
+	f.buf, f.n = nil, 0
+}
+
+func (f *SecretField) add(text []byte) {
+	if f.buf == nil || f.n+len(text) > f.buf.Len() {
+		size := 64
+		for size < f.n+len(text) {
+			size *= 2
+		}
+		grown, err := NewSecureBuffer(size)
+		if err != nil {
+			return
+		}
+		if f.buf != nil {
+			copy(grown.Bytes(), f.bytes())
+			f.buf.Destroy()
+		}
+		f.buf = grown
+	}
+	f.n += copy(f.buf.Bytes()[f.n:], text)
+}
+
+func (f *SecretField) backspace() {
+	if f.n == 0 {
+		return
+	}
+	data := f.bytes()
+	_, size := utf8.DecodeLastRune(data)
+	SecureZero(data[f.n-size:])
+	f.n -= size
+}
+
+func (f *SecretField) GetLabel() string {
+	return f.label
+}
+
+func (f *SecretField) SetFormAttributes(labelWidth int, labelColor, bgColor, fieldTextColor, fieldBgColor tcell.Color) tview.FormItem {
+	f.labelWidth = labelWidth
+	f.labelColor = labelColor
+	f.SetBackgroundColor(bgColor)
+	f.fieldTextColor = fieldTextColor
+	f.fieldBgColor = fieldBgColor
+	return f
+}
+
+func (f *SecretField) GetFieldWidth() int {
+	return f.width
+}
+
+func (f *SecretField) GetFieldHeight() int {
+	return 1
+}
+
+func (f *SecretField) SetFinishedFunc(handler func(key tcell.Key)) tview.FormItem {
+	f.finished = handler
+	return f
+}
+
+func (f *SecretField) SetDisabled(disabled bool) tview.FormItem {
+	f.disabled = disabled
+	return f
+}
+
+func (f *SecretField) Draw(screen tcell.Screen) {
+	f.Box.DrawForSubclass(screen, f)
+
+	x, y, width, height := f.GetInnerRect()
+	if height < 1 || width < 1 {
+		return
+	}
+	right := x + width
+
+	if f.labelWidth > 0 {
+		labelWidth := f.labelWidth
+		if labelWidth > right-x {
+			labelWidth = right - x
+		}
+		tview.Print(screen, f.label, x, y, labelWidth, tview.AlignLeft, f.labelColor)
+		x += labelWidth
+	} else {
+		_, drawn := tview.Print(screen, f.label, x, y, right-x, tview.AlignLeft, f.labelColor)
+		x += drawn
+	}
+
+	fieldWidth := f.width
+	if fieldWidth == 0 || fieldWidth > right-x {
+		fieldWidth = right - x
+	}
+	if fieldWidth < 1 {
+		return
+	}
+
+	style := tcell.StyleDefault.Background(f.fieldBgColor).Foreground(f.fieldTextColor)
+	for i := 0; i < fieldWidth; i++ {
+		screen.SetContent(x+i, y, ' ', nil, style)
+	}
+
+	masked := utf8.RuneCount(f.bytes())
+	if masked > fieldWidth-1 {
+		masked = fieldWidth - 1
+	}
+	for i := 0; i < masked; i++ {
+		screen.SetContent(x+i, y, '*', nil, style)
+	}
+
+	if f.HasFocus() {
+		screen.ShowCursor(x+masked, y)
+	}
+}
+
+func (f *SecretField) InputHandler() func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
+	return f.WrapInputHandler(func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
+		if f.disabled {
+			return
+		}
+
+		switch key := event.Key(); key {
+		case tcell.KeyRune:
+			var b [utf8.UTFMax]byte
+			f.add(b[:utf8.EncodeRune(b[:], event.Rune())])
+			SecureZero(b[:])
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			f.backspace()
+		case tcell.KeyCtrlU:
+			f.Destroy()
+		case tcell.KeyEnter, tcell.KeyTab, tcell.KeyBacktab, tcell.KeyEscape:
+			if f.finished != nil {
+				f.finished(key)
+			}
+		}
+	})
+}
+
+// PasteHandler accepts pasted passwords. The terminal hands them over as a
+// string, which is out of our hands.
+func (f *SecretField) PasteHandler() func(text string, setFocus func(p tview.Primitive)) {
+	return f.WrapPasteHandler(func(text string, setFocus func(p tview.Primitive)) {
+		if !f.disabled {
+			b := []byte(text)
+			f.add(b)
+			SecureZero(b)
+		}
+	})
+}
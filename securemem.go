@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/subtle"
+	"runtime"
+	"sync"
+)
+
+// SecureBuffer holds a secret outside the Go heap where the platform
+// allows it: locked into RAM so it is never swapped out, between guard
+// pages so an overrun faults instead of reading past it. Destroy zeroes
+// it; the garbage collector never copies it, and unmaps it once the buffer
+// is unreachable.
+type SecureBuffer struct {
+	mu     sync.Mutex
+	data   []byte // the secret, ending right before the upper guard page
+	mem    []byte // the whole mapping, nil where memory cannot be guarded
+	locked bool   // whether mlock succeeded
+}
+
+// NewSecureBuffer allocates a zeroed buffer of size bytes
+func NewSecureBuffer(size int) (*SecureBuffer, error) {
+	data, mem, locked, err := allocSecure(size)
+	if err != nil {
+		return nil, err
+	}
+	buf := &SecureBuffer{data: data, mem: mem, locked: locked}
+	if mem != nil {
+		runtime.SetFinalizer(buf, func(b *SecureBuffer) {
+			b.Destroy()
+			freeSecure(mem)
+		})
+	}
+	return buf, nil
+}
+
+// SecureBufferFrom moves b into a new buffer and zeroes b
+func SecureBufferFrom(b []byte) (*SecureBuffer, error) {
+	buf, err := NewSecureBuffer(len(b))
+	if err == nil {
+		copy(buf.data, b)
+	}
+	SecureZero(b)
+	return buf, err
+}
+
+// Bytes returns the secret itself, not a copy. The garbage collector does
+// not see the slice: it is unmapped with the buffer, so whoever keeps it
+// past their last use of the buffer, or of what owns it, calls
+// runtime.KeepAlive on that owner. After Destroy it reads zeros.
+func (s *SecureBuffer) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data
+}
+
+func (s *SecureBuffer) Len() int {
+	return len(s.Bytes())
+}
+
+// Locked reports whether the buffer is kept out of swap
+func (s *SecureBuffer) Locked() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locked
+}
+
+// Clone copies the secret into a buffer of its own
+func (s *SecureBuffer) Clone() (*SecureBuffer, error) {
+	src := s.Bytes()
+	buf, err := NewSecureBuffer(len(src))
+	if err != nil {
+		return nil, err
+	}
+	copy(buf.data, src)
+	runtime.KeepAlive(s)
+	return buf, nil
+}
+
+// Equal compares two secrets in constant time
+func (s *SecureBuffer) Equal(other *SecureBuffer) bool {
+	defer runtime.KeepAlive(other)
+	defer runtime.KeepAlive(s)
+	return subtle.ConstantTimeCompare(s.Bytes(), other.Bytes()) == 1
+}
+
+// Destroy zeroes and unlocks the buffer. Other goroutines may still hold
+// its bytes, so the mapping is left to the finalizer. It is safe to call
+// twice.
+func (s *SecureBuffer) Destroy() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data == nil {
+		return
+	}
+	SecureZero(s.data)
+	if s.locked {
+		unlockSecure(s.mem)
+	}
+	s.data, s.locked = nil, false
+}
+
+// concatSecure joins parts into a new buffer
+func concatSecure(parts ...[]byte) (*SecureBuffer, error) {
+	size := 0
+	for _, p := range parts {
+		size += len(p)
+	}
+	buf, err := NewSecureBuffer(size)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	for _, p := range parts {
+		n += copy(buf.data[n:], p)
+	}
+	return buf, nil
+}
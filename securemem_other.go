@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+// allocSecure falls back to the heap where pages cannot be guarded; the
+// buffer is still zeroed by Destroy
+func allocSecure(size int) (data, mem []byte, locked bool, err error) {
+	return make([]byte, size), nil, false, nil
+}
+
+func unlockSecure(mem []byte) {}
+
+func freeSecure(mem []byte) {}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// allocSecure maps the secret's pages between two inaccessible guard pages
+// and locks them into RAM. The secret ends at the upper guard page, so
+// writing past it faults at once. A failed mlock, usually RLIMIT_MEMLOCK,
+// leaves the buffer usable but swappable.
+func allocSecure(size int) (data, mem []byte, locked bool, err error) {
+	page := unix.Getpagesize()
+	inner := (size + page - 1) / page * page
+	if inner == 0 {
+		inner = page
+	}
+
+	mem, err = unix.Mmap(-1, 0, inner+2*page, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if err = unix.Mprotect(mem[:page], unix.PROT_NONE); err == nil {
+		err = unix.Mprotect(mem[page+inner:], unix.PROT_NONE)
+	}
+	if err != nil {
+		unix.Munmap(mem)
+		return nil, nil, false, err
+	}
+
+	locked = unix.Mlock(mem[page:page+inner]) == nil
+
+	end := page + inner
+	return mem[end-size : end : end], mem, locked, nil
+}
+
+func unlockSecure(mem []byte) {
+	page := unix.Getpagesize()
+	unix.Munlock(mem[page : len(mem)-page])
+}
+
+func freeSecure(mem []byte) {
+	unix.Munmap(mem)
+}
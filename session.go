@@ -1,144 +1,257 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
-	"encoding/json"
-	"os"
+	"encoding/binary"
 	"sync"
 	"time"
 )
 
+// Session keeps the keys of a drive for quick encryption. It never holds
+// the password: only keys derived for this one vault.
 type Session struct {
-	Password    []byte    `json:"-"`
-	DriveID     string    `json:"drive_id"`
-	DrivePath   string    `json:"drive_path"`
-	CreatedAt   time.Time `json:"created_at"`
-	LastUsed    time.Time `json:"last_used"`
-	EncryptedPw string    `json:"encrypted_pw"`
+	Keys      *VaultKeys `json:"-"`
+	DriveID   string     `json:"drive_id"`
+	DrivePath string     `json:"drive_path"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastUsed  time.Time  `json:"last_used"`
+
+	saved time.Time // LastUsed as the store last had it
+}
+
+// sessionRecordVersion tags what a store keeps per drive: the creation
+// and last use times, the drive path, then the marshalled keys
+const sessionRecordVersion = 3
+
+// SweepInterval is how often expired sessions are looked for
+const SweepInterval = time.Minute
+
+// sessionTouchInterval is how far LastUsed must move before it is written
+// back to the store, so a busy session does not rewrite it on every use
+const sessionTouchInterval = 5 * time.Minute
+
+// sessionLimits returns how long a session may live in total and how long
+// it may go unused, from the settings
+func sessionLimits() (lifetime, idle time.Duration) {
+	hours := AppConfig.SessionLifetimeHours
+	if hours <= 0 {
+		hours = SessionExpiryHours
+	}
+	idleHours := AppConfig.SessionIdleHours
+	if idleHours <= 0 {
+		idleHours = DefaultSessionIdleHours
+	}
+	return time.Duration(hours) * time.Hour, time.Duration(idleHours) * time.Hour
+}
+
+// ExpiresAt is when the session ends: at its absolute lifetime or after
+// going unused too long, whichever comes first
+func (s *Session) ExpiresAt() time.Time {
+	lifetime, idle := sessionLimits()
+	end := s.CreatedAt.Add(lifetime)
+	if idleEnd := s.LastUsed.Add(idle); idleEnd.Before(end) {
+		end = idleEnd
+	}
+	return end
+}
+
+func (s *Session) expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt())
+}
+
+// marshal encodes the session for a store
+func (s *Session) marshal() []byte {
+	keys, _ := s.Keys.MarshalBinary()
+	b := make([]byte, 19, 19+len(s.DrivePath)+len(keys))
+	b[0] = sessionRecordVersion
+	binary.BigEndian.PutUint64(b[1:], uint64(s.CreatedAt.Unix()))
+	binary.BigEndian.PutUint64(b[9:], uint64(s.LastUsed.Unix()))
+	binary.BigEndian.PutUint16(b[17:], uint16(len(s.DrivePath)))
+	b = append(b, s.DrivePath...)
+	b = append(b, keys...)
+	SecureZero(keys)
+	return b
+}
+
+// unmarshalSession decodes marshal. Records of earlier versions are
+// rejected: the bare keys of the first carry no age, the second no path.
+func unmarshalSession(driveID string, b []byte) (*Session, error) {
+	if len(b) < 19 || b[0] != sessionRecordVersion {
+		return nil, ErrInvalidData
+	}
+	pathEnd := 19 + int(binary.BigEndian.Uint16(b[17:]))
+	if pathEnd > len(b) {
+		return nil, ErrInvalidData
+	}
+	keys, err := unmarshalVaultKeys(b[pathEnd:])
+	if err != nil {
+		return nil, err
+	}
+	lastUsed := time.Unix(int64(binary.BigEndian.Uint64(b[9:])), 0)
+	return &Session{
+		Keys:      keys,
+		DriveID:   driveID,
+		DrivePath: string(b[19:pathEnd]),
+		CreatedAt: time.Unix(int64(binary.BigEndian.Uint64(b[1:])), 0),
+		LastUsed:  lastUsed,
+		saved:     lastUsed,
+	}, nil
 }
 
 type SessionManager struct {
 	sessions map[string]*Session
+	store    SessionStore
+	storeErr error
 	mu       sync.RWMutex
+	stop     chan struct{}
 }
 
 var Sessions = &SessionManager{
 	sessions: make(map[string]*Session),
+	store:    memoryStore{},
 }
 
-// FIX: Кэширование machineKey
-var (
-	cachedMachineKey []byte
-	machineKeyOnce   sync.Once
-)
-
-func machineKey() []byte {
-	machineKeyOnce.Do(func() {
-		hostname, _ := os.Hostname()
-		if hostname == "" {
-			hostname = "local"
-		}
-		
-		entropy := hostname + getConfigDir()
-		
-		h := HMAC256([]byte(entropy), []byte("unfuckable-machine-v1"))
-		cachedMachineKey = make([]byte, 32)
-		copy(cachedMachineKey, h)
-	})
-	
-	return cachedMachineKey
-}
-
-func (sm *SessionManager) Set(driveID, drivePath, password string) error {
+// Set keeps a copy of keys as the session of driveID
+func (sm *SessionManager) Set(driveID, drivePath string, keys *VaultKeys) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	encPw, err := encryptSessionPassword(password)
+	own, err := keys.Clone()
 	if err != nil {
 		return err
 	}
+	if old, ok := sm.sessions[driveID]; ok {
+		old.Keys.Destroy()
+	}
 
+	now := time.Now()
 	session := &Session{
-		Password:    []byte(password),
-		DriveID:     driveID,
-		DrivePath:   drivePath,
-		CreatedAt:   time.Now(),
-		LastUsed:    time.Now(),
-		EncryptedPw: encPw,
+		Keys:      own,
+		DriveID:   driveID,
+		DrivePath: drivePath,
+		CreatedAt: now,
+		LastUsed:  now,
 	}
-
 	sm.sessions[driveID] = session
 
-	AppConfig.Sessions[driveID] = encPw
-	SaveConfig()
+	// The session stays in memory even if the store cannot keep it
+	return sm.save(session)
+}
 
+// save writes session to the store; the caller holds mu
+func (sm *SessionManager) save(s *Session) error {
+	secret := s.marshal()
+	defer SecureZero(secret)
+	if err := sm.store.Save(s.DriveID, secret); err != nil {
+		return err
+	}
+	s.saved = s.LastUsed
 	return nil
 }
 
-// FIX: Исправлена race condition с LastUsed
-func (sm *SessionManager) Get(driveID string) (string, bool) {
-	// Сначала проверяем с read lock
+// Get returns a copy of the session keys of driveID, which the caller
+// destroys when done. Using a session restarts its idle timeout.
+func (sm *SessionManager) Get(driveID string) (*VaultKeys, bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	s, ok := sm.sessions[driveID]
+	if !ok {
+		return nil, false
+	}
+	now := time.Now()
+	if s.expired(now) {
+		sm.end(driveID)
+		return nil, false
+	}
+	keys, err := s.Keys.Clone()
+	if err != nil {
+		return nil, false
+	}
+	s.LastUsed = now
+	if now.Sub(s.saved) >= sessionTouchInterval {
+		sm.save(s)
+	}
+	return keys, true
+}
+
+func (sm *SessionManager) Has(driveID string) bool {
 	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	s, ok := sm.sessions[driveID]
+	return ok && !s.expired(time.Now())
+}
+
+// end zeroes the keys of driveID and forgets its session; the caller
+// holds mu
+func (sm *SessionManager) end(driveID string) {
 	if s, ok := sm.sessions[driveID]; ok {
-		sm.mu.RUnlock()
-		
-		// Обновляем LastUsed с write lock
-		sm.mu.Lock()
-		s.LastUsed = time.Now()
-		sm.mu.Unlock()
-		
-		return string(s.Password), true
+		s.Keys.Destroy()
 	}
-	sm.mu.RUnlock()
+	delete(sm.sessions, driveID)
+	sm.store.Delete(driveID)
+}
 
-	// Нужно создать новую сессию - получаем write lock
+// Sweep ends every expired session and returns how many it ended
+func (sm *SessionManager) Sweep() int {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
-	
-	// Double-check после получения write lock
-	if s, ok := sm.sessions[driveID]; ok {
-		s.LastUsed = time.Now()
-		return string(s.Password), true
-	}
 
-	// Проверяем в AppConfig
-	if encPw, ok := AppConfig.Sessions[driveID]; ok {
-		password, err := decryptSessionPassword(encPw)
-		if err != nil {
-			return "", false
+	now := time.Now()
+	ended := 0
+	for id, s := range sm.sessions {
+		if s.expired(now) {
+			sm.end(id)
+			ended++
 		}
+	}
+	return ended
+}
 
-		// Создаем новую сессию в памяти
-		sm.sessions[driveID] = &Session{
-			Password:    []byte(password),
-			DriveID:     driveID,
-			LastUsed:    time.Now(),
-			EncryptedPw: encPw,
-		}
+// StartSweeper sweeps expired sessions every SweepInterval until
+// StopSweeper. onExpire, if set, runs after a sweep that ended any.
+func (sm *SessionManager) StartSweeper(onExpire func()) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-		return password, true
+	if sm.stop != nil {
+		return
 	}
-
-	return "", false
+	stop := make(chan struct{})
+	sm.stop = stop
+
+	go func() {
+		ticker := time.NewTicker(SweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if sm.Sweep() > 0 && onExpire != nil {
+					onExpire()
+				}
+			}
+		}
+	}()
 }
 
-func (sm *SessionManager) Has(driveID string) bool {
-	_, ok := sm.Get(driveID)
-	return ok
+func (sm *SessionManager) StopSweeper() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.stop != nil {
+		close(sm.stop)
+		sm.stop = nil
+	}
 }
 
 func (sm *SessionManager) Clear(driveID string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	if s, ok := sm.sessions[driveID]; ok {
-		SecureZero(s.Password)
-	}
-
-	delete(sm.sessions, driveID)
-	delete(AppConfig.Sessions, driveID)
-	SaveConfig()
+	sm.end(driveID)
 }
 
 func (sm *SessionManager) ClearAll() {
@@ -146,100 +259,154 @@ func (sm *SessionManager) ClearAll() {
 	defer sm.mu.Unlock()
 
 	for _, s := range sm.sessions {
-		SecureZero(s.Password)
+		s.Keys.Destroy()
 	}
 
 	sm.sessions = make(map[string]*Session)
-	AppConfig.Sessions = make(map[string]string)
-	SaveConfig()
+	sm.store.Clear()
 }
 
-func (sm *SessionManager) GetAll() map[string]*Session {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
+// DestroyAll zeroes the keys of every session and forgets them, leaving
+// the store as it is so the sessions come back on the next start
+func (sm *SessionManager) DestroyAll() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	result := make(map[string]*Session)
-	for k, v := range sm.sessions {
-		result[k] = v
+	for _, s := range sm.sessions {
+		s.Keys.Destroy()
 	}
-	return result
+	sm.sessions = make(map[string]*Session)
 }
 
+// LoadFromConfig opens the configured session store and loads its sessions.
+// A keyring that cannot be reached leaves sessions in memory only.
 func (sm *SessionManager) LoadFromConfig() {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	for driveID, encPw := range AppConfig.Sessions {
-		password, err := decryptSessionPassword(encPw)
+	store, err := openSessionStore(sessionStoreName())
+	if err != nil {
+		store = memoryStore{}
+	}
+	sm.store = store
+	sm.storeErr = err
+
+	sm.load()
+}
+
+// load reads the store into memory. Expired sessions and entries that are
+// not sessions, such as the passwords older versions kept, are dropped
+// from the store and the config: that drive asks for its password again.
+func (sm *SessionManager) load() {
+	// A locked store yields nothing until it is unlocked
+	secrets, _ := sm.store.Load()
+	now := time.Now()
+	for driveID, secret := range secrets {
+		session, err := unmarshalSession(driveID, secret)
+		SecureZero(secret)
 		if err != nil {
+			sm.store.Delete(driveID)
 			continue
 		}
-
-		sm.sessions[driveID] = &Session{
-			Password:    []byte(password),
-			DriveID:     driveID,
-			EncryptedPw: encPw,
-			LastUsed:    time.Now(),
+		if _, ok := sm.sessions[driveID]; ok || session.expired(now) {
+			if !ok {
+				sm.store.Delete(driveID)
+			}
+			session.Keys.Destroy()
+			continue
 		}
+		sm.sessions[driveID] = session
 	}
-}
 
-func encryptSessionPassword(password string) (string, error) {
-	key := deriveSessionKey()
-	
-	salt := make([]byte, 16)
-	rand.Read(salt)
-	
-	data := append(salt, []byte(password)...)
-	
-	encrypted, err := EncryptAESGCM(data, key)
-	if err != nil {
-		SecureZero(key)
-		return "", err
+	if len(AppConfig.Sessions) > 0 {
+		AppConfig.Sessions = make(map[string]string)
+		SaveConfig()
 	}
-	
-	SecureZero(key)
-	return base64.StdEncoding.EncodeToString(encrypted), nil
 }
 
-func decryptSessionPassword(encrypted string) (string, error) {
-	data, err := base64.StdEncoding.DecodeString(encrypted)
-	if err != nil {
-		return "", err
+// StoreLocked reports whether the session store waits for the app PIN
+func (sm *SessionManager) StoreLocked() bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ps, ok := sm.store.(pinStore)
+	return ok && ps.Locked()
+}
+
+// StoreExists reports whether a PIN store already has a file, so unlocking
+// it asks for the existing PIN rather than a new one
+func (sm *SessionManager) StoreExists() bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	ps, ok := sm.store.(pinStore)
+	return ok && ps.Exists()
+}
+
+// UnlockStore opens a PIN store, loads its sessions and saves the ones
+// created while it was locked
+func (sm *SessionManager) UnlockStore(pin *SecureBuffer) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	ps, ok := sm.store.(pinStore)
+	if !ok {
+		return nil
+	}
+	if err := ps.Unlock(pin); err != nil {
+		return err
 	}
 
-	key := deriveSessionKey()
-	decrypted, err := DecryptAESGCM(data, key)
-	if err != nil {
-		SecureZero(key)
-		return "", err
+	pending := make(map[string]*Session)
+	for id, s := range sm.sessions {
+		pending[id] = s
 	}
-	
-	SecureZero(key)
-	
-	if len(decrypted) < 16 {
-		SecureZero(decrypted)
-		return "", ErrInvalidData
+	sm.load()
+	for _, s := range pending {
+		sm.save(s)
 	}
-	
-	password := string(decrypted[16:])
-	SecureZero(decrypted)
-	
-	return password, nil
+	return nil
 }
 
-func deriveSessionKey() []byte {
-	mKey := machineKey()
-	// FIX: machineKey теперь кэшируется, безопасно использовать
-	// НЕ вызываем SecureZero на cached ключ!
-	derived := DeriveKeyFast("session_unfuckable_v2", mKey)
-	return derived
+// SwitchStore moves every session into store and empties the old one, so
+// secrets do not linger in a backend the user turned away from
+func (sm *SessionManager) SwitchStore(name string, store SessionStore) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for id, s := range sm.sessions {
+		secret := s.marshal()
+		err := store.Save(id, secret)
+		SecureZero(secret)
+		if err != nil {
+			return err
+		}
+	}
+	sm.store.Clear()
+
+	sm.store = store
+	sm.storeErr = nil
+	AppConfig.SessionStore = name
+	return nil
+}
+
+// StoreStatus returns the active backend and why the configured one could
+// not be used, if it could not
+func (sm *SessionManager) StoreStatus() (string, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if sm.storeErr != nil {
+		return StoreNone, sm.storeErr
+	}
+	return sessionStoreName(), nil
 }
 
 type SessionInfo struct {
 	DriveID   string
 	DrivePath string
 	LastUsed  time.Time
+	ExpiresAt time.Time
 	Active    bool
 }
 
@@ -253,20 +420,9 @@ func (sm *SessionManager) GetSessionsInfo() []SessionInfo {
 			DriveID:   id,
 			DrivePath: s.DrivePath,
 			LastUsed:  s.LastUsed,
-			Active:    true,
+			ExpiresAt: s.ExpiresAt(),
+			Active:    !s.expired(time.Now()),
 		})
 	}
 	return result
 }
-
-func (sm *SessionManager) Export() ([]byte, error) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-
-	export := make(map[string]string)
-	for id, s := range sm.sessions {
-		export[id] = s.EncryptedPw
-	}
-	
-	return json.Marshal(export)
-}
\ No newline at end of file
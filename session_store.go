@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Session store backends
+const (
+	StoreKeyring = "keyring" // system keyring (Secret Service on Linux)
+	StoreFile    = "file"    // file in the config dir locked with an app PIN
+	StoreNone    = "none"    // memory only, sessions end with the process
+)
+
+var SessionStores = []string{StoreKeyring, StoreFile, StoreNone}
+
+const (
+	SessionFile  = "sessions.dat"
+	MinPINLength = 4
+)
+
+var (
+	ErrStoreLocked = errors.New("session store is locked")
+	ErrWrongPIN    = errors.New("wrong PIN")
+)
+
+// SessionStore keeps session secrets between runs of the program
+type SessionStore interface {
+	Load() (map[string][]byte, error)
+	Save(driveID string, secret []byte) error
+	Delete(driveID string) error
+	Clear() error
+}
+
+// pinStore is a SessionStore that has to be unlocked with the app PIN
+type pinStore interface {
+	SessionStore
+	Locked() bool
+	Exists() bool
+	Unlock(pin *SecureBuffer) error
+}
+
+// sessionStoreName returns the configured backend, keyring if it is unknown
+func sessionStoreName() string {
+	if slices.Contains(SessionStores, AppConfig.SessionStore) {
+		return AppConfig.SessionStore
+	}
+	return StoreKeyring
+}
+
+// openSessionStore opens the backend called name. A file store starts locked.
+func openSessionStore(name string) (SessionStore, error) {
+	switch name {
+	case StoreKeyring:
+		return newKeyringStore()
+	case StoreFile:
+		return newFileStore(filepath.Join(getConfigDir(), SessionFile)), nil
+	}
+	return memoryStore{}, nil
+}
+
+// memoryStore persists nothing
+type memoryStore struct{}
+
+func (memoryStore) Load() (map[string][]byte, error)         { return nil, nil }
+func (memoryStore) Save(driveID string, secret []byte) error { return nil }
+func (memoryStore) Delete(driveID string) error              { return nil }
+func (memoryStore) Clear() error                             { return nil }
+
+// fileStore keeps secrets in one file: salt followed by the AES-GCM sealed
+// JSON map, with the key derived from the PIN by Argon2id
+type fileStore struct {
+	path    string
+	mu      sync.Mutex
+	key     *SecureBuffer
+	salt    []byte
+	secrets map[string][]byte
+}
+
+func newFileStore(path string) *fileStore {
+	return &fileStore{path: path}
+}
+
+func (f *fileStore) Locked() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.key == nil
+}
+
+func (f *fileStore) Exists() bool {
+	_, err := os.Stat(f.path)
+	return err == nil
+}
+
+// Unlock opens the file with pin, or creates it if there is none yet
+func (f *fileStore) Unlock(pin *SecureBuffer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		salt, err := GenerateSalt()
+		if err != nil {
+			return err
+		}
+		key, err := SecureBufferFrom(DeriveKey(pin.Bytes(), salt))
+		if err != nil {
+			return err
+		}
+		f.key.Destroy()
+		f.salt = salt
+		f.key = key
+		f.secrets = make(map[string][]byte)
+		return f.write()
+	}
+	if err != nil {
+		return err
+	}
+	if len(data) < SaltSize {
+		return ErrInvalidData
+	}
+
+	salt := data[:SaltSize]
+	key, err := SecureBufferFrom(DeriveKey(pin.Bytes(), salt))
+	if err != nil {
+		return err
+	}
+	plain, err := DecryptAESGCM(data[SaltSize:], key.Bytes())
+	if err != nil {
+		key.Destroy()
+		return ErrWrongPIN
+	}
+	defer SecureZero(plain)
+
+	secrets := make(map[string][]byte)
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		key.Destroy()
+		return err
+	}
+
+	f.key.Destroy()
+	f.salt = append([]byte(nil), salt...)
+	f.key = key
+	f.secrets = secrets
+	return nil
+}
+
+func (f *fileStore) write() error {
+	plain, err := json.Marshal(f.secrets)
+	if err != nil {
+		return err
+	}
+	sealed, err := EncryptAESGCM(plain, f.key.Bytes())
+	SecureZero(plain)
+	if err != nil {
+		return err
+	}
+
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, append(append([]byte(nil), f.salt...), sealed...), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+func (f *fileStore) Load() (map[string][]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.key == nil {
+		return nil, ErrStoreLocked
+	}
+	result := make(map[string][]byte, len(f.secrets))
+	for id, secret := range f.secrets {
+		result[id] = append([]byte(nil), secret...)
+	}
+	return result, nil
+}
+
+func (f *fileStore) Save(driveID string, secret []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.key == nil {
+		return ErrStoreLocked
+	}
+	if old, ok := f.secrets[driveID]; ok {
+		SecureZero(old)
+	}
+	f.secrets[driveID] = append([]byte(nil), secret...)
+	return f.write()
+}
+
+func (f *fileStore) Delete(driveID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.key == nil {
+		return ErrStoreLocked
+	}
+	if old, ok := f.secrets[driveID]; ok {
+		SecureZero(old)
+		delete(f.secrets, driveID)
+		return f.write()
+	}
+	return nil
+}
+
+// Clear removes the file; it works even while the store is locked
+func (f *fileStore) Clear() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, secret := range f.secrets {
+		SecureZero(secret)
+	}
+	if f.key != nil {
+		f.secrets = make(map[string][]byte)
+	}
+	if err := SecureDelete(f.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if f.key != nil {
+		return f.write()
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"io/fs"
+	"math"
+	mrand "math/rand"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Size models for chunks and decoys
+const (
+	SizeUniform   = "uniform"   // evenly spread, ChunkVariance around ChunkSizeMB
+	SizeLogNormal = "lognormal" // long tail like real files
+	SizeExtension = "extension" // typical sizes for each extension
+	SizeDrive     = "drive"     // drawn from the files already on the drive
+)
+
+var SizeModels = []string{SizeUniform, SizeLogNormal, SizeExtension, SizeDrive}
+
+const (
+	sizeMB = 1024 * 1024
+
+	// Fewer drive files than this in a size range fall back to log-normal
+	minDriveSamples = 8
+
+	// Stop sampling huge drives after this many files
+	maxDriveSamples = 20000
+)
+
+// sizeDist is a log-normal distribution given by its median and the
+// standard deviation of the log size
+type sizeDist struct {
+	median int
+	sigma  float64
+}
+
+// chunkExtSizes are typical sizes of large temp, cache and partial files
+var chunkExtSizes = map[string]sizeDist{
+	".tmp":        {3 * sizeMB, 0.9},
+	".temp":       {3 * sizeMB, 0.9},
+	"~":           {2 * sizeMB, 0.8},
+	".bak":        {8 * sizeMB, 1.0},
+	".old":        {4 * sizeMB, 1.0},
+	".log":        {2 * sizeMB, 0.6},
+	".dat":        {6 * sizeMB, 1.1},
+	".bin":        {10 * sizeMB, 1.0},
+	".cache":      {2 * sizeMB, 0.7},
+	".db":         {5 * sizeMB, 1.0},
+	".idx":        {2 * sizeMB, 0.7},
+	".sqlite":     {4 * sizeMB, 1.0},
+	".swp":        {sizeMB + sizeMB/2, 0.4},
+	".part":       {20 * sizeMB, 0.8},
+	".partial":    {20 * sizeMB, 0.8},
+	".download":   {20 * sizeMB, 0.8},
+	".crdownload": {25 * sizeMB, 0.7},
+	".!ut":        {30 * sizeMB, 0.6},
+	".bc!":        {30 * sizeMB, 0.6},
+	".aria2":      {16 * sizeMB, 0.8},
+	".zip":        {12 * sizeMB, 1.0},
+	".png":        {2 * sizeMB, 0.6},
+}
+
+// decoyExtSizes are typical sizes of small config, log and cache files
+var decoyExtSizes = map[string]sizeDist{
+	"log":    {48 << 10, 1.2},
+	"0":      {256 << 10, 0.8},
+	"1":      {256 << 10, 0.8},
+	"2":      {256 << 10, 0.8},
+	"":       {2 << 10, 0.8},
+	"cfg":    {3 << 10, 0.8},
+	"ini":    {3 << 10, 0.8},
+	"inf":    {4 << 10, 0.8},
+	"json":   {12 << 10, 1.2},
+	"new":    {24 << 10, 1.2},
+	"old":    {24 << 10, 1.2},
+	"bak":    {24 << 10, 1.2},
+	"db":     {128 << 10, 1.2},
+	"sqlite": {128 << 10, 1.2},
+	"idx":    {32 << 10, 1.0},
+	"cache":  {24 << 10, 1.5},
+	"tmp":    {8 << 10, 1.8},
+	"dat":    {64 << 10, 1.5},
+}
+
+var defaultDecoySizes = sizeDist{32 << 10, 1.4}
+
+// sample draws a size between lo and hi. Draws outside are retried rather
+// than clamped so no size piles up at the bounds.
+func (d sizeDist) sample(r *mrand.Rand, lo, hi int) int {
+	for try := 0; try < 32; try++ {
+		size := int(float64(d.median) * math.Exp(d.sigma*r.NormFloat64()))
+		if size >= lo && size <= hi {
+			return size
+		}
+	}
+	return lo + r.Intn(hi-lo+1)
+}
+
+// sizer draws chunk and decoy sizes with the configured model
+type sizer struct {
+	model string
+	r     *mrand.Rand
+	drive []int
+}
+
+// newSizer prepares a sizer for drivePath. skip lists vault files that must
+// not be sampled by the drive model.
+func newSizer(drivePath string, skip []string) *sizer {
+	s := &sizer{model: sizeModel(), r: decoyRand()}
+	if s.model == SizeDrive {
+		s.drive = driveFileSizes(drivePath, skip)
+	}
+	return s
+}
+
+// sizeModel returns the configured size model, uniform if it is unknown
+func sizeModel() string {
+	if slices.Contains(SizeModels, AppConfig.SizeModel) {
+		return AppConfig.SizeModel
+	}
+	return SizeUniform
+}
+
+// driveFileSizes returns the sorted sizes of the user's files on the drive
+func driveFileSizes(drivePath string, skip []string) []int {
+	skipped := map[string]bool{ManifestFile: true, JournalFile: true}
+	for _, name := range skip {
+		skipped[name] = true
+	}
+
+	var sizes []int
+	filepath.WalkDir(drivePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if len(sizes) >= maxDriveSamples {
+			return filepath.SkipAll
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(drivePath, p)
+		if err != nil || skipped[filepath.ToSlash(rel)] {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Size() > 0 {
+			sizes = append(sizes, int(info.Size()))
+		}
+		return nil
+	})
+
+	sort.Ints(sizes)
+	return sizes
+}
+
+// chunkSize returns how much data a chunk carries. g is the grammar of a
+// profile chunk and ext the extension planned for a mixed one, if any.
+func (s *sizer) chunkSize(g *nameGrammar, ext string) int {
+	if g == nil && s.model == SizeUniform {
+		chunkSize, variance := chunkSettings()
+		varianceRange := chunkSize * variance / 100
+		if varianceRange == 0 {
+			return chunkSize
+		}
+		return chunkSize - varianceRange + s.r.Intn(varianceRange*2)
+	}
+
+	lo, hi := MinChunkSize, MaxChunkSize
+	if g != nil {
+		lo, hi = g.minMB*sizeMB, g.maxMB*sizeMB
+	}
+
+	var size int
+	switch s.model {
+	case SizeUniform:
+		size = int(float64(lo) * math.Pow(float64(hi)/float64(lo), s.r.Float64()))
+	case SizeDrive:
+		size = s.fromDrive(lo, hi, s.chunkDist(g, ext))
+	default:
+		size = s.chunkDist(g, ext).sample(s.r, lo, hi)
+	}
+
+	// The file on disk, header included, gets the drawn size
+	return max(MinChunkSize-ChunkHeaderSize, min(size-ChunkHeaderSize, MaxChunkSize))
+}
+
+func (s *sizer) chunkDist(g *nameGrammar, ext string) sizeDist {
+	if g != nil {
+		// A grammar already stands for one kind of file
+		lo, hi := float64(g.minMB), float64(g.maxMB)
+		return sizeDist{int(math.Sqrt(lo*hi) * sizeMB), math.Log(hi/lo)/4 + 0.1}
+	}
+	if d, ok := chunkExtSizes[ext]; ok && s.model == SizeExtension {
+		return d
+	}
+	chunkSize, variance := chunkSettings()
+	return sizeDist{chunkSize, 0.2 + float64(variance)/50}
+}
+
+// chunkExt picks the extension of a mixed chunk up front when its size
+// depends on it
+func (s *sizer) chunkExt() string {
+	if s.model != SizeExtension {
+		return ""
+	}
+	if !AppConfig.WrapChunks {
+		return pick(s.r, chunkExtensions)
+	}
+	exts := wrapExtensions[pick(s.r, wrapFormats)]
+	return pick(s.r, exts)
+}
+
+// decoySize returns the size of the decoy called name
+func (s *sizer) decoySize(name string) int {
+	switch s.model {
+	case SizeUniform:
+		return MinDecoySize + s.r.Intn(MaxDecoySize-MinDecoySize)
+	case SizeDrive:
+		return s.fromDrive(MinDecoySize, MaxDecoySize, s.decoyDist(name))
+	}
+	return s.decoyDist(name).sample(s.r, MinDecoySize, MaxDecoySize)
+}
+
+func (s *sizer) decoyDist(name string) sizeDist {
+	if s.model == SizeExtension {
+		ext := strings.TrimPrefix(path.Ext(name), ".")
+		if d, ok := decoyExtSizes[ext]; ok {
+			return d
+		}
+	}
+	return defaultDecoySizes
+}
+
+// fromDrive picks the size of a random drive file between lo and hi, with a
+// little jitter so no size repeats exactly
+func (s *sizer) fromDrive(lo, hi int, fallback sizeDist) int {
+	i, j := sort.SearchInts(s.drive, lo), sort.SearchInts(s.drive, hi+1)
+	if j-i < minDriveSamples {
+		return fallback.sample(s.r, lo, hi)
+	}
+	return sizeDist{s.drive[i+s.r.Intn(j-i)], 0.05}.sample(s.r, lo, hi)
+}
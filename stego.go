@@ -0,0 +1,631 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cover formats vault chunks can hide in. Chunks are embedded in the low
+// bits of pixels or audio samples of files the user keeps on the drive, so
+// a stego vault writes no chunk files at all.
+const (
+	coverPNG = "png"
+	coverBMP = "bmp"
+	coverWAV = "wav"
+)
+
+const (
+	// Only one in coverFill low bits carries data, so the statistics of a
+	// cover stay close to the original
+	coverFill = 2
+
+	// Covers that hold less than this are not worth a chunk header
+	minCoverCapacity = 4096
+)
+
+// Cover is a file on the drive that can hide vault data
+type Cover struct {
+	Name     string
+	Format   string
+	Capacity int64
+}
+
+// carrier is a decoded cover: count samples whose lowest bit can carry
+// data, stored little-endian at offset(i) in data, and a way to write the
+// file back
+type carrier struct {
+	data   []byte
+	count  int
+	width  int
+	signed bool
+	offset func(i int) int
+	encode func() ([]byte, error)
+}
+
+// capacity is how many bytes the carrier can hide
+func (c *carrier) capacity() int64 {
+	return int64(c.count / 8 / coverFill)
+}
+
+func (c *carrier) get(i int) int {
+	off := c.offset(i)
+	v := 0
+	for b := c.width - 1; b >= 0; b-- {
+		v = v<<8 | int(c.data[off+b])
+	}
+	if c.signed && v >= 1<<(8*c.width-1) {
+		v -= 1 << (8 * c.width)
+	}
+	return v
+}
+
+func (c *carrier) set(i, v int) {
+	off := c.offset(i)
+	for b := 0; b < c.width; b++ {
+		c.data[off+b] = byte(v >> (8 * b))
+	}
+}
+
+func (c *carrier) limits() (int, int) {
+	if c.signed {
+		return -1 << (8*c.width - 1), 1<<(8*c.width-1) - 1
+	}
+	return 0, 1<<(8*c.width) - 1
+}
+
+// embed hides payload in the samples picked by seed. Samples are moved up
+// or down by one at random instead of having their low bit replaced, which
+// keeps the value histogram free of the pairs LSB replacement leaves.
+func (c *carrier) embed(payload []byte, seed int64) error {
+	if int64(len(payload)) > c.capacity() {
+		return fmt.Errorf("cover too small")
+	}
+
+	r := decoyRand()
+	lo, hi := c.limits()
+	sp := newSpread(c.count, seed)
+
+	for k := 0; k < len(payload)*8; k++ {
+		bit := int(payload[k/8]>>(7-k%8)) & 1
+		i := sp.at(k)
+		v := c.get(i)
+		if v&1 == bit {
+			continue
+		}
+		switch {
+		case v == lo:
+			v++
+		case v == hi:
+			v--
+		case r.Intn(2) == 0:
+			v++
+		default:
+			v--
+		}
+		c.set(i, v)
+	}
+	return nil
+}
+
+// extract reads back n bytes hidden with seed
+func (c *carrier) extract(n int, seed int64) ([]byte, error) {
+	if int64(n) > c.capacity() {
+		return nil, fmt.Errorf("cover too small")
+	}
+
+	sp := newSpread(c.count, seed)
+	out := make([]byte, n)
+	for k := 0; k < n*8; k++ {
+		out[k/8] |= byte(c.get(sp.at(k))&1) << (7 - k%8)
+	}
+	return out, nil
+}
+
+// spread is a keyed permutation of [0,n): a Feistel network over the next
+// power of four, walked until it lands inside the range. It scatters the
+// used samples over the whole cover without listing them all.
+type spread struct {
+	n    uint64
+	half uint
+	keys [4]uint64
+}
+
+func newSpread(n int, seed int64) spread {
+	s := spread{n: uint64(n)}
+	for uint64(1)<<(2*s.half) < s.n {
+		s.half++
+	}
+	x := uint64(seed)
+	for i := range s.keys {
+		x = splitmix64(x)
+		s.keys[i] = x
+	}
+	return s
+}
+
+func (s spread) at(k int) int {
+	mask := uint64(1)<<s.half - 1
+	x := uint64(k)
+	for {
+		l, r := x>>s.half, x&mask
+		for _, key := range s.keys {
+			l, r = r, l^(splitmix64(r^key)&mask)
+		}
+		x = l<<s.half | r
+		if x < s.n {
+			return int(x)
+		}
+	}
+}
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9E3779B97F4A7C15
+	x = (x ^ x>>30) * 0xBF58476D1CE4E5B9
+	x = (x ^ x>>27) * 0x94D049BB133111EB
+	return x ^ x>>31
+}
+
+// coverFormat returns the cover format for a file name, "" if it has none
+func coverFormat(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".png":
+		return coverPNG
+	case ".bmp":
+		return coverBMP
+	case ".wav":
+		return coverWAV
+	}
+	return ""
+}
+
+// openCover reads and decodes a cover file
+func openCover(path string) (*carrier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch coverFormat(path) {
+	case coverPNG:
+		return pngCarrier(data)
+	case coverBMP:
+		return bmpCarrier(data)
+	case coverWAV:
+		return wavCarrier(data)
+	}
+	return nil, fmt.Errorf("not a cover: %s", path)
+}
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrInvalidData
+	}
+
+	var chunks []pngChunk
+	for p := len(pngSignature); p+12 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[p:]))
+		if n < 0 || p+12+n > len(data) {
+			return nil, ErrInvalidData
+		}
+		chunks = append(chunks, pngChunk{string(data[p+4 : p+8]), data[p+8 : p+8+n]})
+		p += 12 + n
+	}
+	return chunks, nil
+}
+
+// pngCarrier uses the colour channels of 8-bit grey, RGB and RGBA images.
+// Only the pixel data is re-encoded; every other chunk of the original is
+// kept in place.
+func pngCarrier(data []byte) (*carrier, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil || len(chunks) == 0 || chunks[0].typ != "IHDR" || len(chunks[0].data) != 13 {
+		return nil, ErrInvalidData
+	}
+	ihdr := chunks[0].data
+	if ihdr[8] != 8 || ihdr[12] != 0 || (ihdr[9] != 0 && ihdr[9] != 2 && ihdr[9] != 6) {
+		return nil, fmt.Errorf("unsupported png")
+	}
+	for _, ch := range chunks {
+		if ch.typ == "tRNS" || ch.typ == "PLTE" {
+			return nil, fmt.Errorf("unsupported png")
+		}
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &carrier{width: 1}
+	var w int
+	switch m := img.(type) {
+	case *image.Gray:
+		c.data, w = m.Pix, m.Rect.Dx()
+		c.count = w * m.Rect.Dy()
+		c.offset = func(i int) int { return i/w*m.Stride + i%w }
+	case *image.RGBA:
+		c.data, w = m.Pix, m.Rect.Dx()
+		c.count = 3 * w * m.Rect.Dy()
+		c.offset = func(i int) int { return i/3/w*m.Stride + i/3%w*4 + i%3 }
+	case *image.NRGBA:
+		c.data, w = m.Pix, m.Rect.Dx()
+		c.count = 3 * w * m.Rect.Dy()
+		c.offset = func(i int) int { return i/3/w*m.Stride + i/3%w*4 + i%3 }
+	default:
+		return nil, fmt.Errorf("unsupported png")
+	}
+
+	c.encode = func() ([]byte, error) {
+		var enc bytes.Buffer
+		if err := png.Encode(&enc, img); err != nil {
+			return nil, err
+		}
+		fresh, err := readPNGChunks(enc.Bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		// Chunks whose layout depends on the colour type go when the
+		// encoder picked another one
+		changed := fresh[0].data[9] != ihdr[9]
+
+		out := bytes.NewBuffer(append([]byte(nil), pngSignature...))
+		wroteIDAT := false
+		for _, ch := range chunks {
+			switch ch.typ {
+			case "IHDR":
+				pngAppend(out, fresh[0].typ, fresh[0].data)
+			case "IDAT":
+				if !wroteIDAT {
+					for _, f := range fresh {
+						if f.typ == "IDAT" {
+							pngAppend(out, f.typ, f.data)
+						}
+					}
+					wroteIDAT = true
+				}
+			case "sBIT", "bKGD", "hIST":
+				if !changed {
+					pngAppend(out, ch.typ, ch.data)
+				}
+			default:
+				pngAppend(out, ch.typ, ch.data)
+			}
+		}
+		return out.Bytes(), nil
+	}
+	return c, nil
+}
+
+// bmpCarrier uses the colour bytes of uncompressed 24 and 32-bit bitmaps
+func bmpCarrier(data []byte) (*carrier, error) {
+	if len(data) < 54 || string(data[:2]) != "BM" {
+		return nil, ErrInvalidData
+	}
+
+	pixels := int(binary.LittleEndian.Uint32(data[10:]))
+	width := int(int32(binary.LittleEndian.Uint32(data[18:])))
+	height := int(int32(binary.LittleEndian.Uint32(data[22:])))
+	bpp := int(binary.LittleEndian.Uint16(data[28:]))
+	compression := binary.LittleEndian.Uint32(data[30:])
+
+	if height < 0 {
+		height = -height
+	}
+	if width <= 0 || height == 0 || compression != 0 || (bpp != 24 && bpp != 32) {
+		return nil, fmt.Errorf("unsupported bmp")
+	}
+
+	stride := (bpp*width + 31) / 32 * 4
+	if pixels+stride*height > len(data) {
+		return nil, ErrInvalidData
+	}
+
+	pixel := bpp / 8
+	return &carrier{
+		data:  data,
+		count: 3 * width * height,
+		width: 1,
+		offset: func(i int) int {
+			p := i / 3
+			return pixels + p/width*stride + p%width*pixel + i%3
+		},
+		encode: func() ([]byte, error) { return data, nil },
+	}, nil
+}
+
+// wavCarrier uses the samples of 8, 16 and 24-bit PCM audio
+func wavCarrier(data []byte) (*carrier, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, ErrInvalidData
+	}
+
+	bits, start, size := 0, 0, 0
+	for p := 12; p+8 <= len(data); {
+		id := string(data[p : p+4])
+		n := int(binary.LittleEndian.Uint32(data[p+4:]))
+		if n < 0 || p+8+n > len(data) {
+			n = len(data) - p - 8
+		}
+
+		switch id {
+		case "fmt ":
+			if n < 16 || binary.LittleEndian.Uint16(data[p+8:]) != 1 {
+				return nil, fmt.Errorf("unsupported wav")
+			}
+			bits = int(binary.LittleEndian.Uint16(data[p+22:]))
+		case "data":
+			start, size = p+8, n
+		}
+		p += 8 + n + n%2
+	}
+
+	if (bits != 8 && bits != 16 && bits != 24) || size == 0 {
+		return nil, fmt.Errorf("unsupported wav")
+	}
+
+	width := bits / 8
+	return &carrier{
+		data:   data,
+		count:  size / width,
+		width:  width,
+		signed: width > 1,
+		offset: func(i int) int { return start + i*width },
+		encode: func() ([]byte, error) { return data, nil },
+	}, nil
+}
+
+// FindCovers lists the files on the drive that can hide vault data. Files
+// that would go into the vault on encryption and the vault files in inUse
+// are skipped, so a cover is never wiped and never overwritten while the
+// data it holds is still needed.
+func FindCovers(drivePath string, inUse []string) []Cover {
+	skip := map[string]bool{ManifestFile: true, JournalFile: true}
+	for _, name := range inUse {
+		skip[name] = true
+	}
+	if files, err := scanFiles(drivePath, loadExclusions(drivePath)); err == nil {
+		for _, f := range files {
+			skip[filepath.ToSlash(f.Name())] = true
+		}
+	}
+
+	var covers []Cover
+	filepath.Walk(drivePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		format := coverFormat(path)
+		if format == "" {
+			return nil
+		}
+		rel, err := filepath.Rel(drivePath, path)
+		if err != nil || skip[filepath.ToSlash(rel)] {
+			return nil
+		}
+
+		c, err := openCover(path)
+		if err != nil || c.capacity() < minCoverCapacity {
+			return nil
+		}
+		covers = append(covers, Cover{Name: filepath.ToSlash(rel), Format: format, Capacity: c.capacity()})
+		return nil
+	})
+
+	return covers
+}
+
+// coverNames lists the covers the vault described by manifest hides in
+func coverNames(manifest *VaultManifest) []string {
+	var names []string
+	for _, chunk := range manifest.Chunks {
+		if chunk.Cover != "" {
+			names = append(names, chunk.Name)
+		}
+	}
+	return names
+}
+
+// writeCovers hides data in as few covers as hold it, largest first, and
+// spreads it over them in proportion to their capacity so each is filled to
+// the same low density. Covers left over stay free for the next rewrite.
+func writeCovers(drivePath string, data []byte, manifest *VaultManifest, keys *VaultKeys, headerKey []byte, covers []Cover, j *Journal, interleave func() error) error {
+	sort.Slice(covers, func(a, b int) bool { return covers[a].Capacity > covers[b].Capacity })
+
+	var room int64
+	n := 0
+	for n < len(covers) && room < int64(len(data)) {
+		room += covers[n].Capacity - ChunkHeaderSize
+		n++
+	}
+	if room < int64(len(data)) {
+		return fmt.Errorf("%s (%s / %s)", T("stego_no_capacity"),
+			FormatBytes(uint64(room)), FormatBytes(uint64(len(data))))
+	}
+	covers = covers[:n]
+
+	sizes := make([]int, len(covers))
+	left := len(data)
+	for i, c := range covers {
+		sizes[i] = int(int64(len(data)) * (c.Capacity - ChunkHeaderSize) / room)
+		left -= sizes[i]
+	}
+	for i := 0; left > 0; i = (i + 1) % len(covers) {
+		if int64(sizes[i]) < covers[i].Capacity-ChunkHeaderSize {
+			sizes[i]++
+			left--
+		}
+	}
+
+	var used []Cover
+	var shares []int
+	for i, size := range sizes {
+		if size > 0 {
+			used = append(used, covers[i])
+			shares = append(shares, size)
+		}
+	}
+
+	vaultID := newVaultID()
+	sealed := time.Now().UnixNano()
+	chunks := make([]ChunkInfo, len(used))
+
+	offsets := make([]int, len(used))
+	for i := 1; i < len(used); i++ {
+		offsets[i] = offsets[i-1] + shares[i-1]
+	}
+
+	r := decoyRand()
+	for _, idx := range r.Perm(len(used)) {
+		if interleave != nil {
+			if err := interleave(); err != nil {
+				return err
+			}
+		}
+
+		chunkData := data[offsets[idx] : offsets[idx]+shares[idx]]
+		header, err := sealChunkHeader(headerKey, chunkHeader{
+			VaultID: vaultID,
+			Index:   uint32(idx),
+			Total:   uint32(len(used)),
+			Size:    int64(len(chunkData)),
+			Sealed:  sealed,
+			HMAC:    HMAC256(chunkData, keys.HMAC),
+		})
+		if err != nil {
+			return err
+		}
+
+		raw := append(header, chunkData...)
+		seed := r.Int63()
+		if err := writeCover(drivePath, used[idx].Name, raw, seed, j); err != nil {
+			return fmt.Errorf("%s: %w", used[idx].Name, err)
+		}
+
+		chunks[idx] = ChunkInfo{
+			Name:  used[idx].Name,
+			Size:  int64(len(raw)),
+			HMAC:  HMAC256(raw, keys.HMAC),
+			Cover: used[idx].Format,
+			Seed:  seed,
+		}
+	}
+
+	manifest.Chunks = chunks
+	manifest.TotalChunks = len(used)
+	return nil
+}
+
+// writeCover hides raw in the cover called name. The file is replaced
+// through a temporary copy and keeps its timestamps.
+func writeCover(drivePath, name string, raw []byte, seed int64, j *Journal) error {
+	path := filepath.Join(drivePath, filepath.FromSlash(name))
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	c, err := openCover(path)
+	if err != nil {
+		return err
+	}
+	if err := c.embed(raw, seed); err != nil {
+		return err
+	}
+	out, err := c.encode()
+	if err != nil {
+		return err
+	}
+
+	tmp := name + "~"
+	if err := j.addCreated(tmp); err != nil {
+		return err
+	}
+	tmpPath := filepath.Join(drivePath, filepath.FromSlash(tmp))
+	if err := os.WriteFile(tmpPath, out, info.Mode().Perm()); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Chtimes(path, info.ModTime(), info.ModTime())
+}
+
+// readCover extracts the chunk hidden in a cover
+func readCover(drivePath string, chunk ChunkInfo) ([]byte, error) {
+	c, err := openCover(filepath.Join(drivePath, filepath.FromSlash(chunk.Name)))
+	if err != nil {
+		return nil, err
+	}
+	return c.extract(int(chunk.Size), chunk.Seed)
+}
+
+// CoverReport is how much vault data the covers on a drive can hide
+type CoverReport struct {
+	Drive    string
+	Covers   []Cover
+	Capacity int64
+	Needed   int64
+}
+
+// EstimateCovers finds the covers on a drive and, for a drive that is not
+// encrypted yet, compares their capacity with the size of its files. The
+// vault is compressed, so Needed is an upper bound.
+func EstimateCovers(drivePath string) *CoverReport {
+	report := &CoverReport{Drive: drivePath}
+
+	if !checkEncrypted(drivePath) {
+		if files, err := scanFiles(drivePath, loadExclusions(drivePath)); err == nil {
+			for _, f := range files {
+				report.Needed += f.Size()
+			}
+		}
+	}
+
+	report.Covers = FindCovers(drivePath, nil)
+	for _, c := range report.Covers {
+		report.Capacity += c.Capacity - ChunkHeaderSize
+	}
+	if report.Needed > 0 {
+		report.Needed += vaultOverhead
+	}
+	return report
+}
+
+func (r *CoverReport) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %d\n", T("stego_covers"), len(r.Covers))
+	fmt.Fprintf(&b, "%s: %s\n", T("stego_capacity"), FormatBytes(uint64(max(r.Capacity, 0))))
+	if r.Needed > 0 {
+		fmt.Fprintf(&b, "%s: %s\n", T("stego_needed"), FormatBytes(uint64(r.Needed)))
+		if r.Needed > r.Capacity {
+			fmt.Fprintf(&b, "%s\n", T("stego_short"))
+		}
+	}
+
+	if len(r.Covers) > 0 {
+		b.WriteString("\n")
+	}
+	for _, c := range r.Covers {
+		fmt.Fprintf(&b, "  %-4s %10s  %s\n", c.Format, FormatBytes(uint64(c.Capacity)), c.Name)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// timeJitter is how far a backdated time may stray from the sample it is
+// based on
+const timeJitter = 5 * 24 * time.Hour
+
+// vaultTimes returns the modification times of the chunks and decoys on the
+// drive. The manifest and journal are rewritten too often to be useful.
+func vaultTimes(drivePath string, manifest *VaultManifest) []time.Time {
+	var times []time.Time
+	for _, name := range vaultFileNames(drivePath, manifest) {
+		if name == ManifestFile || name == JournalFile {
+			continue
+		}
+		if info, err := os.Lstat(filepath.Join(drivePath, name)); err == nil {
+			times = append(times, info.ModTime())
+		}
+	}
+	return times
+}
+
+// scrambleTimes backdates every vault file, decoy and placement directory
+// to a time drawn from samples, usually the times of the files that were
+// on the drive, so timestamps neither cluster nor show the write order.
+// Failures are ignored; the vault is valid either way.
+func scrambleTimes(drivePath string, manifest *VaultManifest, samples []time.Time) {
+	r := decoyRand()
+	now := time.Now()
+
+	// Without samples times are spread over the past year
+	if len(samples) == 0 {
+		samples = []time.Time{now.Add(-183 * 24 * time.Hour)}
+	}
+	oldest := samples[0]
+	for _, t := range samples {
+		if t.Before(oldest) {
+			oldest = t
+		}
+	}
+	if now.Sub(oldest) < timeJitter {
+		oldest = now.Add(-timeJitter)
+	}
+
+	plausible := func() time.Time {
+		t := samples[r.Intn(len(samples))].Add(time.Duration(r.Int63n(int64(2*timeJitter))) - timeJitter)
+		if t.Before(oldest) {
+			t = oldest.Add(time.Duration(r.Int63n(int64(timeJitter))))
+		}
+		if t.After(now) {
+			t = now.Add(-time.Duration(r.Int63n(int64(timeJitter))))
+		}
+		return t
+	}
+
+	touch := func(name string) {
+		mtime := plausible()
+		atime := mtime.Add(time.Duration(r.Int63n(int64(30 * 24 * time.Hour))))
+		if atime.After(now) {
+			atime = now
+		}
+		os.Chtimes(filepath.Join(drivePath, name), atime, mtime)
+	}
+
+	names := vaultFileNames(drivePath, manifest)
+	for _, name := range names {
+		touch(name)
+	}
+
+	// Directories last, since writing into them updates their times
+	for _, dir := range placedDirs(names) {
+		touch(dir)
+	}
+}
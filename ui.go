@@ -57,6 +57,20 @@ func (a *App) Run() error {
 		Panic.Start()
 	}
 
+	if Sessions.StoreLocked() && Sessions.StoreExists() {
+		a.showSessionPIN(false, Sessions.UnlockStore, func() {
+			a.updateStatusBar(T("success"))
+		})
+	}
+
+	Sessions.StartSweeper(func() {
+		a.app.QueueUpdateDraw(func() {
+			a.lastScan = time.Time{}
+			a.updateHeader()
+			a.updateStatusBar(T("session_expired"))
+		})
+	})
+
 	return a.app.SetRoot(a.mainFlex, true).EnableMouse(true).Run()
 }
 
@@ -74,14 +88,13 @@ func (a *App) Shutdown() {
 	
 	// Остановить autolock
 	AutoLocker.Stop()
+	Sessions.StopSweeper()
 	
 	// Сохранить конфиг
 	SaveConfig()
 	
 	// Очистить sensitive data из памяти
-	for _, s := range Sessions.GetAll() {
-		SecureZero(s.Password)
-	}
+	Sessions.DestroyAll()
 	
 	a.app.Stop()
 }
@@ -146,7 +159,7 @@ func (a *App) updateStatusBar(msg string) {
 		}
 	}
 
-	sessCount := len(Sessions.GetAll())
+	sessCount := len(Sessions.GetSessionsInfo())
 	sessInfo := fmt.Sprintf("[blue]Sessions:%d[-]", sessCount)
 
 	if msg != "" {
@@ -277,6 +290,9 @@ func (a *App) displayDeviceList() {
 		if device.IsEncrypted {
 			icon = "🔒"
 		}
+		if device.Interrupted {
+			icon = "⚠"
+		}
 
 		sessionMark := ""
 		if device.HasSession && !device.IsEncrypted {
@@ -341,6 +357,10 @@ func (a *App) showDeviceMenu() {
 		icon = "🔒"
 		status = T("encrypted")
 	}
+	if dev.Interrupted {
+		icon = "⚠"
+		status = T("interrupted")
+	}
 
 	list := tview.NewList()
 
@@ -359,7 +379,15 @@ func (a *App) showDeviceMenu() {
 
 	list.AddItem(info, "", 0, nil)
 
-	if dev.IsEncrypted {
+	if dev.Interrupted {
+		list.AddItem(T("journal_resume"), "", 'r', func() {
+			a.handleJournal(true)
+		})
+
+		list.AddItem(T("journal_rollback"), "", 'u', func() {
+			a.handleJournal(false)
+		})
+	} else if dev.IsEncrypted {
 		list.AddItem(T("decrypt"), "", 'd', func() {
 			a.handleDecrypt()
 		})
@@ -368,6 +396,28 @@ func (a *App) showDeviceMenu() {
 			a.showVaultInfo()
 		})
 
+		list.AddItem(T("verify_vault"), "", 'v', func() {
+			a.handleVerify()
+		})
+
+		list.AddItem(T("salvage"), "", 's', func() {
+			a.handleSalvage()
+		})
+
+		list.AddItem(T("wipe_report_view"), "", 'w', func() {
+			a.handleWipeReport()
+		})
+
+		list.AddItem(T("reshuffle"), "", 'h', func() {
+			a.handleReshuffle()
+		})
+
+		if dev.HasSession && AppConfig.Reshuffle {
+			list.AddItem(T("quick_reshuffle"), "", 'q', func() {
+				a.handleQuickEncrypt()
+			})
+		}
+
 		list.AddItem(T("erase_vault"), "", 'e', func() {
 			a.handleErase()
 		})
@@ -385,6 +435,24 @@ func (a *App) showDeviceMenu() {
 				a.handleEncrypt()
 			})
 		}
+
+		list.AddItem(T("recover_vault"), "", 'r', func() {
+			a.handleRecover()
+		})
+
+		list.AddItem(T("name_profile")+": "+T("name_profile_"+driveNameProfile(dev.DriveID)), "", 'n', func() {
+			a.showNameProfile()
+		})
+	}
+
+	if !dev.Interrupted {
+		list.AddItem(T("stealth_analyze"), "", 'a', func() {
+			a.handleAnalyze()
+		})
+
+		list.AddItem(T("stego_estimate"), "", 'k', func() {
+			a.handleCovers()
+		})
 	}
 
 	list.AddItem(T("back"), "", 'b', func() {
@@ -395,7 +463,7 @@ func (a *App) showDeviceMenu() {
 		SetTitle(" " + path + " ").
 		SetBorderColor(tcell.ColorGreen)
 
-	a.pages.AddAndSwitchToPage("device_menu", a.centerBox(list, 70, 11), true)
+	a.pages.AddAndSwitchToPage("device_menu", a.centerBox(list, 70, 22), true)
 }
 
 // FIX: Исправлена смена языка
@@ -434,6 +502,10 @@ func (a *App) showSettings() {
 		AppConfig.SecureWipe = checked
 	})
 
+	form.AddCheckbox(T("wipe_free_space"), AppConfig.WipeFreeSpace, func(checked bool) {
+		AppConfig.WipeFreeSpace = checked
+	})
+
 	form.AddCheckbox(T("double_encrypt"), AppConfig.DoubleEncrypt, func(checked bool) {
 		AppConfig.DoubleEncrypt = checked
 	})
@@ -446,6 +518,74 @@ func (a *App) showSettings() {
 		AppConfig.UseChunks = checked
 	})
 
+	form.AddCheckbox(T("wrap_chunks"), AppConfig.WrapChunks, func(checked bool) {
+		AppConfig.WrapChunks = checked
+	})
+
+	form.AddCheckbox(T("stego"), AppConfig.Stego, func(checked bool) {
+		AppConfig.Stego = checked
+	})
+
+	placements := make([]string, len(PlacementStrategies))
+	currentPlacement := 0
+	for i, s := range PlacementStrategies {
+		placements[i] = T("placement_" + s)
+		if s == AppConfig.Placement {
+			currentPlacement = i
+		}
+	}
+
+	form.AddDropDown(T("placement"), placements, currentPlacement, func(option string, index int) {
+		AppConfig.Placement = PlacementStrategies[index]
+	})
+
+	sizeModels := make([]string, len(SizeModels))
+	currentSizeModel := 0
+	for i, m := range SizeModels {
+		sizeModels[i] = T("size_model_" + m)
+		if m == sizeModel() {
+			currentSizeModel = i
+		}
+	}
+
+	form.AddDropDown(T("size_model"), sizeModels, currentSizeModel, func(option string, index int) {
+		AppConfig.SizeModel = SizeModels[index]
+	})
+
+	form.AddCheckbox(T("reshuffle_on_quick"), AppConfig.Reshuffle, func(checked bool) {
+		AppConfig.Reshuffle = checked
+	})
+
+	stores := make([]string, len(SessionStores))
+	currentStore := 0
+	for i, st := range SessionStores {
+		stores[i] = T("session_store_" + st)
+		if st == sessionStoreName() {
+			currentStore = i
+		}
+	}
+
+	selectedStore := SessionStores[currentStore]
+	form.AddDropDown(T("session_store"), stores, currentStore, func(option string, index int) {
+		selectedStore = SessionStores[index]
+	})
+
+	form.AddInputField(T("session_lifetime"), fmt.Sprintf("%d", AppConfig.SessionLifetimeHours), 10, nil, func(text string) {
+		var val int
+		fmt.Sscanf(text, "%d", &val)
+		if val > 0 {
+			AppConfig.SessionLifetimeHours = val
+		}
+	})
+
+	form.AddInputField(T("session_idle"), fmt.Sprintf("%d", AppConfig.SessionIdleHours), 10, nil, func(text string) {
+		var val int
+		fmt.Sscanf(text, "%d", &val)
+		if val > 0 {
+			AppConfig.SessionIdleHours = val
+		}
+	})
+
 	form.AddInputField(T("chunk_size_mb"), fmt.Sprintf("%d", AppConfig.ChunkSizeMB), 10, nil, func(text string) {
 		var val int
 		fmt.Sscanf(text, "%d", &val)
@@ -462,40 +602,20 @@ func (a *App) showSettings() {
 		}
 	})
 
+	form.AddButton(T("wipe_settings"), func() {
+		a.showWipeSettings()
+	})
+
 	form.AddButton(T("confirm"), func() {
-		// FIX: Применяем язык ТОЛЬКО здесь
-		languageChanged := selectedLang != originalLang
-		
-		if languageChanged {
-			AppConfig.Language = selectedLang
-		}
-		
-		SaveConfig()
-		
-		if languageChanged {
-			// FIX: Показываем индикатор и пересоздаем UI
-			a.showMessage(T("loading"), T("please_wait"))
-			
-			safeGo(func() {
-				time.Sleep(100 * time.Millisecond)
-				
-				a.app.QueueUpdateDraw(func() {
-					// Пересоздаем все страницы с новым языком
-					a.pages.RemovePage("main")
-					a.pages.RemovePage("settings")
-					a.pages.RemovePage("message")
-					
-					a.pages.AddPage("main", a.createMainMenu(), true, true)
-					a.pages.SwitchToPage("main")
-					
-					a.updateHeader()
-					a.updateStatusBar(T("success"))
-				})
+		if selectedStore != sessionStoreName() {
+			// The new store may ask for a PIN first; the rest of the
+			// settings are applied once it is in use
+			a.switchSessionStore(selectedStore, func() {
+				a.applySettings(selectedLang, originalLang)
 			})
-		} else {
-			a.updateStatusBar(T("success"))
-			a.pages.SwitchToPage("main")
+			return
 		}
+		a.applySettings(selectedLang, originalLang)
 	})
 
 	form.AddButton(T("back"), func() {
@@ -512,7 +632,99 @@ func (a *App) showSettings() {
 		SetTitle(" " + T("settings") + " ").
 		SetBorderColor(tcell.ColorYellow)
 
-	a.pages.AddAndSwitchToPage("settings", a.centerBox(flex, 65, 21), true)
+	a.pages.AddAndSwitchToPage("settings", a.centerBox(flex, 65, 39), true)
+}
+
+// applySettings saves the settings form and rebuilds the UI if the
+// language changed
+func (a *App) applySettings(selectedLang, originalLang string) {
+	// FIX: Применяем язык ТОЛЬКО здесь
+	languageChanged := selectedLang != originalLang
+	
+	if languageChanged {
+		AppConfig.Language = selectedLang
+	}
+	
+	SaveConfig()
+	
+	if languageChanged {
+		// FIX: Показываем индикатор и пересоздаем UI
+		a.showMessage(T("loading"), T("please_wait"))
+		
+		safeGo(func() {
+			time.Sleep(100 * time.Millisecond)
+			
+			a.app.QueueUpdateDraw(func() {
+				// Пересоздаем все страницы с новым языком
+				a.pages.RemovePage("main")
+				a.pages.RemovePage("settings")
+				a.pages.RemovePage("message")
+				
+				a.pages.AddPage("main", a.createMainMenu(), true, true)
+				a.pages.SwitchToPage("main")
+				
+				a.updateHeader()
+				a.updateStatusBar(T("success"))
+			})
+		})
+	} else {
+		a.updateStatusBar(T("success"))
+		a.pages.SwitchToPage("main")
+	}
+}
+
+// showWipeSettings edits how SecureDelete wipes files. Changes are kept in
+// AppConfig and saved or discarded with the rest of the settings.
+func (a *App) showWipeSettings() {
+	form := tview.NewForm()
+
+	options := make([]string, len(WipeStrategies))
+	current := len(WipeStrategies) - 1
+	for i, s := range WipeStrategies {
+		options[i] = T("wipe_strategy_" + s)
+		if s == AppConfig.WipeStrategy {
+			current = i
+		}
+	}
+
+	form.AddDropDown(T("wipe_strategy"), options, current, func(option string, index int) {
+		AppConfig.WipeStrategy = WipeStrategies[index]
+	})
+
+	form.AddInputField(T("wipe_passes"), fmt.Sprintf("%d", AppConfig.WipePassCount), 10, nil, func(text string) {
+		var val int
+		fmt.Sscanf(text, "%d", &val)
+		if val >= 1 && val <= 35 {
+			AppConfig.WipePassCount = val
+		}
+	})
+
+	form.AddCheckbox(T("wipe_verify"), AppConfig.WipeVerify, func(checked bool) {
+		AppConfig.WipeVerify = checked
+	})
+
+	form.AddCheckbox(T("wipe_flash_aware"), AppConfig.WipeFlashAware, func(checked bool) {
+		AppConfig.WipeFlashAware = checked
+	})
+
+	form.AddCheckbox(T("wipe_report"), AppConfig.WipeReport, func(checked bool) {
+		AppConfig.WipeReport = checked
+	})
+
+	form.AddInputField(T("wipe_report_dir"), AppConfig.WipeReportDir, 40, nil, func(text string) {
+		AppConfig.WipeReportDir = strings.TrimSpace(text)
+	})
+
+	form.AddButton("OK", func() {
+		a.pages.RemovePage("wipe_settings")
+		a.pages.SwitchToPage("settings")
+	})
+
+	form.SetBorder(true).
+		SetTitle(" " + T("wipe_settings") + " ").
+		SetBorderColor(tcell.ColorYellow)
+
+	a.pages.AddAndSwitchToPage("wipe_settings", a.centerBox(form, 70, 17), true)
 }
 
 // FIX: Добавлен throttling для progress updates
@@ -647,10 +859,28 @@ func (a *App) showSessions() {
 
 	sessions := Sessions.GetSessionsInfo()
 
+	store, storeErr := Sessions.StoreStatus()
+	storeText := T("session_store_" + store)
+	if storeErr != nil {
+		storeText = "[yellow]" + storeText + "[-] (" + storeErr.Error() + ")"
+	} else if Sessions.StoreLocked() {
+		storeText += " [yellow](" + T("session_store_locked") + ")[-]"
+	}
+	form.AddTextView(T("session_store"), storeText, 60, 2, true, false)
+
+	if Sessions.StoreLocked() && Sessions.StoreExists() {
+		form.AddButton(T("session_unlock"), func() {
+			a.showSessionPIN(false, Sessions.UnlockStore, func() {
+				a.showSessions()
+			})
+		})
+	}
+
 	if len(sessions) > 0 {
 		listText := ""
 		for _, sess := range sessions {
-			listText += fmt.Sprintf("%s - %s\n", sess.DriveID[:8], sess.LastUsed.Format("2006-01-02 15:04"))
+			listText += fmt.Sprintf("%s - %s - %s %s\n", sess.DriveID[:8], sess.LastUsed.Format("2006-01-02 15:04"),
+				T("session_expires_in"), formatRemaining(time.Until(sess.ExpiresAt)))
 		}
 		form.AddTextView(T("sessions"), listText, 60, 6, true, true)
 
@@ -670,7 +900,16 @@ func (a *App) showSessions() {
 		SetTitle(fmt.Sprintf(" %s (%d) ", T("sessions"), len(sessions))).
 		SetBorderColor(tcell.ColorGreen)
 
-	a.pages.AddAndSwitchToPage("sessions", a.centerBox(form, 70, 13), true)
+	a.pages.AddAndSwitchToPage("sessions", a.centerBox(form, 70, 16), true)
+}
+
+// formatRemaining renders how long a session has left in hours and minutes
+func formatRemaining(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%d%s %02d%s", int(d.Hours()), T("unit_hours"), int(d.Minutes())%60, T("unit_minutes"))
 }
 
 func (a *App) showPanicMenu() {
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
@@ -15,34 +19,32 @@ func (a *App) handleEncrypt() {
 
 	form := tview.NewForm()
 
-	var password1, password2 string
-
-	form.AddPasswordField(T("enter_password"), "", 35, '*', func(text string) {
-		password1 = text
-	})
-
-	form.AddPasswordField(T("confirm_password"), "", 35, '*', func(text string) {
-		password2 = text
-	})
+	passField := addSecretField(form, T("enter_password"), 35)
+	confirmField := addSecretField(form, T("confirm_password"), 35)
 
 	form.AddTextView("", T("password_min"), 30, 1, true, false)
 
 	form.AddButton(T("encrypt"), func() {
-		if len(password1) < 8 {
+		if passField.Len() < 8 {
 			a.showError(T("password_min"))
 			return
 		}
 
-		if password1 != password2 {
+		if !passField.Equal(confirmField) {
 			a.showError(T("password_mismatch"))
 			return
 		}
 
 		a.pages.RemovePage("encrypt_form")
-		a.performEncrypt(password1)
+		confirmField.Destroy()
+		if password, ok := a.takeSecret(passField); ok {
+			a.performEncrypt(password)
+		}
 	})
 
 	form.AddButton(T("cancel"), func() {
+		passField.Destroy()
+		confirmField.Destroy()
 		a.pages.RemovePage("encrypt_form")
 		a.showDeviceMenu()
 	})
@@ -65,8 +67,12 @@ func (a *App) handleQuickEncrypt() {
 	}
 
 	if AppConfig.ConfirmActions {
+		question := T("confirm_encrypt")
+		if a.selected.IsEncrypted {
+			question = T("confirm_reshuffle")
+		}
 		modal := tview.NewModal().
-			SetText(T("confirm_encrypt")).
+			SetText(question).
 			AddButtons([]string{T("yes"), T("no")}).
 			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 				a.pages.RemovePage("confirm_encrypt")
@@ -89,23 +95,22 @@ func (a *App) handleDecrypt() {
 	// ALWAYS ask for password - session is only for encryption!
 	form := tview.NewForm()
 
-	var password string
-
-	form.AddPasswordField(T("enter_password"), "", 40, '*', func(text string) {
-		password = text
-	})
+	passField := addSecretField(form, T("enter_password"), 40)
 
 	form.AddButton(T("decrypt"), func() {
-		if len(password) < 8 {
+		if passField.Len() < 8 {
 			a.showError(T("password_min"))
 			return
 		}
 
 		a.pages.RemovePage("decrypt_form")
-		a.performDecrypt(password)
+		if password, ok := a.takeSecret(passField); ok {
+			a.performDecrypt(password)
+		}
 	})
 
 	form.AddButton(T("cancel"), func() {
+		passField.Destroy()
 		a.pages.RemovePage("decrypt_form")
 		a.showDeviceMenu()
 	})
@@ -124,38 +129,35 @@ func (a *App) handleChangePassword() {
 
 	form := tview.NewForm()
 
-	var newPass1, newPass2 string
-
-	form.AddPasswordField(T("new_password"), "", 40, '*', func(text string) {
-		newPass1 = text
-	})
-
-	form.AddPasswordField(T("confirm_password"), "", 40, '*', func(text string) {
-		newPass2 = text
-	})
+	passField := addSecretField(form, T("new_password"), 40)
+	confirmField := addSecretField(form, T("confirm_password"), 40)
 
 	form.AddButton(T("confirm"), func() {
-		if len(newPass1) < 8 {
+		if passField.Len() < 8 {
 			a.showError(T("password_min"))
 			return
 		}
 
-		if newPass1 != newPass2 {
+		if !passField.Equal(confirmField) {
 			a.showError(T("password_mismatch"))
 			return
 		}
 
-		oldPass, ok := Sessions.Get(a.selected.DriveID)
-		if !ok {
+		if !Sessions.Has(a.selected.DriveID) {
 			a.showError(T("no_session"))
 			return
 		}
 
 		a.pages.RemovePage("change_pass_form")
-		a.performChangePassword(oldPass, newPass1)
+		confirmField.Destroy()
+		if password, ok := a.takeSecret(passField); ok {
+			a.performChangePassword(password)
+		}
 	})
 
 	form.AddButton(T("cancel"), func() {
+		passField.Destroy()
+		confirmField.Destroy()
 		a.pages.RemovePage("change_pass_form")
 		a.showDeviceMenu()
 	})
@@ -168,17 +170,103 @@ func (a *App) handleChangePassword() {
 }
 
 func (a *App) handleErase() {
-	modal := tview.NewModal().
-		SetText("[red]" + T("warning") + "[-]\n\n" + T("confirm_erase")).
-		AddButtons([]string{T("yes"), T("no")}).
-		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
-			a.pages.RemovePage("confirm_erase")
-			if buttonIndex == 0 {
-				a.performErase()
+	if a.isOperationRunning() {
+		return
+	}
+
+	if keys, ok := Sessions.Get(a.selected.DriveID); ok {
+		a.planErase(keys)
+		return
+	}
+
+	form := tview.NewForm()
+
+	passField := addSecretField(form, T("enter_password"), 40)
+
+	form.AddButton(T("confirm"), func() {
+		a.pages.RemovePage("erase_pass_form")
+		if password, ok := a.takeSecret(passField); ok {
+			a.unlockWith(password, a.planErase)
+		}
+	})
+
+	form.AddButton(T("cancel"), func() {
+		passField.Destroy()
+		a.pages.RemovePage("erase_pass_form")
+		a.showDeviceMenu()
+	})
+
+	form.SetBorder(true).SetTitle(" " + T("erase_vault") + " ")
+	a.pages.AddAndSwitchToPage("erase_pass_form", a.centerBox(form, 60, 10), true)
+}
+
+// planErase lists what the erase would delete before asking to go ahead
+func (a *App) planErase(keys *VaultKeys) {
+	a.setOperationRunning(true)
+
+	progress := a.createProgressView(T("please_wait"))
+	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
+
+	go func() {
+		plan, err := PlanErase(a.selected.Path, keys)
+		keys.Destroy()
+
+		a.app.QueueUpdateDraw(func() {
+			a.setOperationRunning(false)
+			a.pages.RemovePage("progress")
+
+			if err != nil {
+				a.showError(T("wrong_password"))
+				return
 			}
+			a.confirmErase(plan)
 		})
+	}()
+}
+
+func (a *App) confirmErase(plan []string) {
+	list := tview.NewTextView().SetDynamicColors(true).SetScrollable(true)
+
+	fmt.Fprintf(list, "[red]%s[-]\n\n", T("confirm_erase"))
+	fmt.Fprintf(list, "[yellow]%s[-] %d\n\n", T("erase_plan"), len(plan))
+	for _, name := range plan {
+		fmt.Fprintf(list, " %s\n", tview.Escape(name))
+	}
+	fmt.Fprintf(list, "\n[grey]%s[-]", T("erase_plan_kept"))
+
+	buttons := tview.NewForm().
+		AddButton(T("erase_vault"), func() {
+			a.pages.RemovePage("confirm_erase")
+			a.performErase(plan)
+		}).
+		AddButton(T("cancel"), func() {
+			a.pages.RemovePage("confirm_erase")
+			a.showDeviceMenu()
+		}).
+		SetButtonsAlign(tview.AlignCenter)
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(list, 0, 1, false).
+		AddItem(buttons, 3, 0, true)
+
+	layout.SetBorder(true).
+		SetTitle(" " + T("warning") + " ").
+		SetBorderColor(tcell.ColorRed)
 
-	a.pages.AddAndSwitchToPage("confirm_erase", modal, true)
+	layout.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyUp, tcell.KeyDown, tcell.KeyPgUp, tcell.KeyPgDn:
+			list.InputHandler()(event, nil)
+			return nil
+		case tcell.KeyEscape:
+			a.pages.RemovePage("confirm_erase")
+			a.showDeviceMenu()
+			return nil
+		}
+		return event
+	})
+
+	a.pages.AddAndSwitchToPage("confirm_erase", a.centerBox(layout, 70, 20), true)
 }
 
 func (a *App) confirmPanic() {
@@ -225,30 +313,33 @@ func (a *App) handlePanicTrigger() {
 	}()
 }
 
-func (a *App) performEncrypt(password string) {
+func (a *App) performEncrypt(password *SecureBuffer) {
 	a.setOperationRunning(true)
 
 	progress := a.createProgressView(T("encrypting"))
 	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
 
 	go func() {
-		err := EncryptDrive(a.selected.Path, a.selected.DriveID, password, func(current, total int64, stage string) {
-			percent := float64(current) / float64(total) * 100
-			a.app.QueueUpdateDraw(func() {
-				a.updateProgress(progress, stage, int(percent), current, total)
+		keys, err := NewVaultKeys(password)
+		password.Destroy()
+		if err == nil {
+			err = EncryptDrive(a.selected.Path, a.selected.DriveID, keys, func(current, total int64, stage string) {
+				percent := float64(current) / float64(total) * 100
+				a.app.QueueUpdateDraw(func() {
+					a.updateProgress(progress, stage, int(percent), current, total)
+				})
 			})
-		})
+			keys.Destroy()
+		}
 
 		a.app.QueueUpdateDraw(func() {
 			a.setOperationRunning(false)
 			a.pages.RemovePage("progress")
 
 			if err != nil {
-				a.showError(fmt.Sprintf("%v", err))
+				a.showEncryptError(err)
 			} else {
-				a.lastScan = time.Time{}
-				a.updateStatusBar(T("success"))
-				a.showDeviceList()
+				a.afterEncrypt(a.selected.Path)
 			}
 		})
 	}()
@@ -257,7 +348,11 @@ func (a *App) performEncrypt(password string) {
 func (a *App) performQuickEncrypt() {
 	a.setOperationRunning(true)
 
-	progress := a.createProgressView(T("encrypting"))
+	title := T("encrypting")
+	if a.selected.IsEncrypted {
+		title = T("reshuffling")
+	}
+	progress := a.createProgressView(title)
 	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
 
 	go func() {
@@ -273,30 +368,199 @@ func (a *App) performQuickEncrypt() {
 			a.pages.RemovePage("progress")
 
 			if err != nil {
-				a.showError(fmt.Sprintf("%v", err))
+				a.showEncryptError(err)
 			} else {
-				a.lastScan = time.Time{}
-				a.updateStatusBar(T("success"))
-				a.showDeviceList()
+				a.afterEncrypt(a.selected.Path)
 			}
 		})
 	}()
 }
 
-// FIX: Исправлен крэш после дешифрования
-func (a *App) performDecrypt(password string) {
+func (a *App) handleReshuffle() {
+	if a.isOperationRunning() {
+		return
+	}
+
+	if keys, ok := Sessions.Get(a.selected.DriveID); ok {
+		a.performReshuffle(keys)
+		return
+	}
+
+	form := tview.NewForm()
+
+	passField := addSecretField(form, T("enter_password"), 40)
+
+	form.AddButton(T("reshuffle"), func() {
+		a.pages.RemovePage("reshuffle_pass_form")
+		if password, ok := a.takeSecret(passField); ok {
+			a.unlockWith(password, a.performReshuffle)
+		}
+	})
+
+	form.AddButton(T("cancel"), func() {
+		passField.Destroy()
+		a.pages.RemovePage("reshuffle_pass_form")
+		a.showDeviceMenu()
+	})
+
+	form.SetBorder(true).SetTitle(" " + T("reshuffle") + " ")
+	a.pages.AddAndSwitchToPage("reshuffle_pass_form", a.centerBox(form, 60, 10), true)
+}
+
+func (a *App) performReshuffle(keys *VaultKeys) {
 	a.setOperationRunning(true)
 
-	progress := a.createProgressView(T("decrypting"))
+	progress := a.createProgressView(T("reshuffling"))
 	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
 
 	go func() {
-		err := DecryptDrive(a.selected.Path, a.selected.DriveID, password, func(current, total int64, stage string) {
-			percent := float64(current) / float64(total) * 100
+		err := ReshuffleVault(a.selected.Path, a.selected.DriveID, keys, func(current, total int64, stage string) {
+			percent := 100
+			if total > 0 {
+				percent = int(float64(current) / float64(total) * 100)
+			}
 			a.app.QueueUpdateDraw(func() {
-				a.updateProgress(progress, stage, int(percent), current, total)
+				a.updateProgress(progress, stage, percent, current, total)
 			})
 		})
+		keys.Destroy()
+
+		a.app.QueueUpdateDraw(func() {
+			a.setOperationRunning(false)
+			a.pages.RemovePage("progress")
+
+			if err != nil {
+				a.showEncryptError(err)
+			} else {
+				a.afterEncrypt(a.selected.Path)
+			}
+		})
+	}()
+}
+
+// afterEncrypt runs the optional free-space wipe, then returns to the
+// device list
+func (a *App) afterEncrypt(drivePath string) {
+	done := func() {
+		a.lastScan = time.Time{}
+		a.updateStatusBar(T("success"))
+		a.showDeviceList()
+	}
+
+	if !AppConfig.WipeFreeSpace {
+		done()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a.setOperationRunning(true)
+
+	progress := a.createProgressView(T("wiping_free_space") + " — " + T("esc_cancel"))
+	progress.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape {
+			cancel()
+			return nil
+		}
+		return event
+	})
+	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
+
+	go func() {
+		err := WipeFreeSpace(ctx, drivePath, func(current, total int64, stage string) {
+			percent := 100
+			if total > 0 {
+				percent = int(float64(current) / float64(total) * 100)
+			}
+			a.updateProgressThrottled(progress, stage, percent, current, total)
+		})
+		cancel()
+
+		a.app.QueueUpdateDraw(func() {
+			a.setOperationRunning(false)
+			a.pages.RemovePage("progress")
+
+			if err != nil && !errors.Is(err, context.Canceled) {
+				a.showError(fmt.Sprintf("%v", err))
+				return
+			}
+			done()
+		})
+	}()
+}
+
+// showEncryptError shows a failed round trip or wipe as a scrollable
+// per-file report, anything else as a plain error
+func (a *App) showEncryptError(err error) {
+	var rt *RoundTripError
+	var we *WipeError
+
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+
+	// A failed wipe still leaves a complete vault behind
+	next := a.showDeviceMenu
+
+	switch {
+	case errors.As(err, &rt):
+		fmt.Fprintf(view, "\n[red]%s[-]\n", tview.Escape(T("roundtrip_failed")))
+		for _, p := range rt.Problems {
+			fmt.Fprintf(view, "\n  %s: [yellow]%s[-]", tview.Escape(p.Name), tview.Escape(p.Reason))
+		}
+		view.SetTitle(" " + T("error") + " ").SetBorderColor(tcell.ColorRed)
+
+	case errors.As(err, &we):
+		drivePath := a.selected.Path
+		fmt.Fprintf(view, "\n[yellow]%s[-]\n", tview.Escape(T("wipe_failed")))
+		for _, r := range we.Failed {
+			name := r.Path
+			if rel, err := filepath.Rel(drivePath, r.Path); err == nil {
+				name = rel
+			}
+			fmt.Fprintf(view, "\n  %s: [red]%s[-]", tview.Escape(name), tview.Escape(r.Err.Error()))
+		}
+		view.SetTitle(" " + T("warning") + " ").SetBorderColor(tcell.ColorYellow)
+		next = func() { a.afterEncrypt(drivePath) }
+
+	default:
+		a.showError(fmt.Sprintf("%v", err))
+		return
+	}
+
+	view.SetBorder(true)
+
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Key() == tcell.KeyEnter || event.Rune() == 'q' || event.Rune() == 'b' {
+			a.pages.RemovePage("encrypt_report")
+			next()
+			return nil
+		}
+		return event
+	})
+
+	a.pages.AddAndSwitchToPage("encrypt_report", a.centerBox(view, 70, 18), true)
+}
+
+// FIX: Исправлен крэш после дешифрования
+func (a *App) performDecrypt(password *SecureBuffer) {
+	a.setOperationRunning(true)
+
+	progress := a.createProgressView(T("decrypting"))
+	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
+
+	go func() {
+		keys, err := OpenVaultKeys(a.selected.Path, password)
+		password.Destroy()
+		if err == nil {
+			err = DecryptDrive(a.selected.Path, a.selected.DriveID, keys, func(current, total int64, stage string) {
+				percent := float64(current) / float64(total) * 100
+				a.app.QueueUpdateDraw(func() {
+					a.updateProgress(progress, stage, int(percent), current, total)
+				})
+			})
+			keys.Destroy()
+		}
 
 		a.app.QueueUpdateDraw(func() {
 			a.setOperationRunning(false)
@@ -321,14 +585,15 @@ func (a *App) performDecrypt(password string) {
 	}()
 }
 
-func (a *App) performChangePassword(oldPassword, newPassword string) {
+func (a *App) performChangePassword(newPassword *SecureBuffer) {
 	a.setOperationRunning(true)
 
 	progress := a.createProgressView(T("processing"))
 	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
 
 	go func() {
-		err := ChangePassword(a.selected.Path, a.selected.DriveID, oldPassword, newPassword)
+		err := ChangePassword(a.selected.Path, a.selected.DriveID, newPassword)
+		newPassword.Destroy()
 
 		a.app.QueueUpdateDraw(func() {
 			a.setOperationRunning(false)
@@ -344,7 +609,7 @@ func (a *App) performChangePassword(oldPassword, newPassword string) {
 	}()
 }
 
-func (a *App) performErase() {
+func (a *App) performErase(plan []string) {
 	a.setOperationRunning(true)
 
 	progress := tview.NewTextView().
@@ -361,7 +626,7 @@ func (a *App) performErase() {
 	a.pages.AddAndSwitchToPage("erase_progress", a.centerBox(progress, 50, 10), true)
 
 	go func() {
-		err := EraseVault(a.selected.Path, a.selected.DriveID)
+		err := EraseVault(a.selected.Path, a.selected.DriveID, plan)
 
 		a.app.QueueUpdateDraw(func() {
 			a.setOperationRunning(false)
@@ -383,22 +648,23 @@ func (a *App) performErase() {
 }
 
 func (a *App) showVaultInfo() {
-	// Need password to read vault info
-	password, ok := Sessions.Get(a.selected.DriveID)
+	// Need the keys to read vault info
+	keys, ok := Sessions.Get(a.selected.DriveID)
 	if !ok {
 		// Ask for password
 		form := tview.NewForm()
 
-		form.AddPasswordField(T("enter_password"), "", 40, '*', func(text string) {
-			password = text
-		})
+		passField := addSecretField(form, T("enter_password"), 40)
 
 		form.AddButton(T("confirm"), func() {
 			a.pages.RemovePage("vault_pass_form")
-			a.displayVaultInfo(password)
+			if password, ok := a.takeSecret(passField); ok {
+				a.unlockWith(password, a.displayVaultInfo)
+			}
 		})
 
 		form.AddButton(T("cancel"), func() {
+			passField.Destroy()
 			a.pages.RemovePage("vault_pass_form")
 			a.showDeviceMenu()
 		})
@@ -408,11 +674,12 @@ func (a *App) showVaultInfo() {
 		return
 	}
 
-	a.displayVaultInfo(password)
+	a.displayVaultInfo(keys)
 }
 
-func (a *App) displayVaultInfo(password string) {
-	manifest, err := GetVaultInfo(a.selected.Path, password)
+func (a *App) displayVaultInfo(keys *VaultKeys) {
+	manifest, err := GetVaultInfo(a.selected.Path, keys)
+	keys.Destroy()
 	if err != nil {
 		a.showError(T("wrong_password"))
 		return
@@ -428,7 +695,7 @@ func (a *App) displayVaultInfo(password string) {
 	fmt.Fprintf(info, " [grey]%s:[-] %s\n", T("vault_size"), FormatBytes(uint64(manifest.OriginalSize)))
 
 	if manifest.HasDecoy {
-		decoyCount := CountDecoyFiles(a.selected.Path)
+		decoyCount := CountDecoyFiles(a.selected.Path, manifest)
 		fmt.Fprintf(info, " [grey]%s:[-] %d\n", T("vault_decoys"), decoyCount)
 	}
 
@@ -443,14 +710,730 @@ func (a *App) displayVaultInfo(password string) {
 	a.pages.AddAndSwitchToPage("vault_info", a.centerBox(info, 60, 14), true)
 }
 
-func (a *App) createProgressView(title string) *tview.TextView {
-	progress := tview.NewTextView().
+func (a *App) handleVerify() {
+	if a.isOperationRunning() {
+		return
+	}
+
+	if keys, ok := Sessions.Get(a.selected.DriveID); ok {
+		a.performVerify(keys)
+		return
+	}
+
+	form := tview.NewForm()
+
+	passField := addSecretField(form, T("enter_password"), 40)
+
+	form.AddButton(T("verify_vault"), func() {
+		a.pages.RemovePage("verify_pass_form")
+		if password, ok := a.takeSecret(passField); ok {
+			a.unlockWith(password, a.performVerify)
+		}
+	})
+
+	form.AddButton(T("cancel"), func() {
+		passField.Destroy()
+		a.pages.RemovePage("verify_pass_form")
+		a.showDeviceMenu()
+	})
+
+	form.SetBorder(true).SetTitle(" " + T("verify_vault") + " ")
+	a.pages.AddAndSwitchToPage("verify_pass_form", a.centerBox(form, 60, 10), true)
+}
+
+func (a *App) performVerify(keys *VaultKeys) {
+	a.setOperationRunning(true)
+
+	progress := a.createProgressView(T("verifying"))
+	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
+
+	go func() {
+		report, err := VerifyVault(a.selected.Path, keys, func(current, total int64, stage string) {
+			percent := 100
+			if total > 0 {
+				percent = int(float64(current) / float64(total) * 100)
+			}
+			a.updateProgressThrottled(progress, stage, percent, current, total)
+		})
+		keys.Destroy()
+
+		a.app.QueueUpdateDraw(func() {
+			a.setOperationRunning(false)
+			a.pages.RemovePage("progress")
+
+			if err != nil {
+				a.showError(T("wrong_password"))
+				return
+			}
+
+			a.displayVerifyReport(report)
+		})
+	}()
+}
+
+func (a *App) displayVerifyReport(report *VerifyReport) {
+	view := tview.NewTextView().
 		SetDynamicColors(true).
-		SetTextAlign(tview.AlignCenter)
+		SetScrollable(true)
 
-	progress.SetBorder(true).
-		SetTitle(" " + title + " ").
-		SetBorderColor(tcell.ColorYellow)
+	color := "green"
+	if !report.OK() {
+		color = "red"
+	}
 
-	return progress
-}
\ No newline at end of file
+	fmt.Fprintf(view, "\n[%s]%s[-]", color, tview.Escape(report.String()))
+
+	view.SetBorder(true).SetTitle(" " + T("verify_vault") + " ")
+
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Key() == tcell.KeyEnter || event.Rune() == 'q' || event.Rune() == 'b' {
+			a.pages.RemovePage("verify_report")
+			a.showDeviceMenu()
+			return nil
+		}
+		return event
+	})
+
+	a.pages.AddAndSwitchToPage("verify_report", a.centerBox(view, 70, 18), true)
+}
+
+func (a *App) handleSalvage() {
+	if a.isOperationRunning() {
+		return
+	}
+
+	hasSession := Sessions.Has(a.selected.DriveID)
+	destPath := defaultSalvagePath()
+
+	form := tview.NewForm()
+
+	var passField *SecretField
+	if !hasSession {
+		passField = addSecretField(form, T("enter_password"), 40)
+	}
+
+	form.AddInputField(T("salvage_destination"), destPath, 50, nil, func(text string) {
+		destPath = text
+	})
+
+	form.AddButton(T("salvage"), func() {
+		if strings.TrimSpace(destPath) == "" {
+			return
+		}
+		a.pages.RemovePage("salvage_form")
+		if keys, ok := Sessions.Get(a.selected.DriveID); ok {
+			passField.Destroy()
+			a.performSalvage(keys, destPath)
+			return
+		}
+		if password, ok := a.takeSecret(passField); ok {
+			a.unlockWith(password, func(keys *VaultKeys) {
+				a.performSalvage(keys, destPath)
+			})
+		}
+	})
+
+	form.AddButton(T("cancel"), func() {
+		passField.Destroy()
+		a.pages.RemovePage("salvage_form")
+		a.showDeviceMenu()
+	})
+
+	form.SetBorder(true).SetTitle(" " + T("salvage") + " ")
+	a.pages.AddAndSwitchToPage("salvage_form", a.centerBox(form, 70, 11), true)
+}
+
+func (a *App) performSalvage(keys *VaultKeys, destPath string) {
+	a.setOperationRunning(true)
+
+	progress := a.createProgressView(T("salvaging"))
+	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
+
+	go func() {
+		report, err := SalvageVault(a.selected.Path, keys, destPath, func(current, total int64, stage string) {
+			percent := 100
+			if total > 0 {
+				percent = int(float64(current) / float64(total) * 100)
+			}
+			a.updateProgressThrottled(progress, stage, percent, current, total)
+		})
+		keys.Destroy()
+
+		a.app.QueueUpdateDraw(func() {
+			a.setOperationRunning(false)
+			a.pages.RemovePage("progress")
+
+			if err != nil {
+				a.showError(err.Error())
+				return
+			}
+
+			a.displaySalvageReport(report, destPath)
+		})
+	}()
+}
+
+func (a *App) displaySalvageReport(report *SalvageReport, destPath string) {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+
+	color := "green"
+	if len(report.DamagedChunks) > 0 || len(report.Truncated) > 0 {
+		color = "yellow"
+	}
+
+	fmt.Fprintf(view, "\n%s: %s\n\n", T("salvage_destination"), tview.Escape(destPath))
+	fmt.Fprintf(view, "[%s]%s[-]", color, tview.Escape(report.String()))
+
+	view.SetBorder(true).SetTitle(" " + T("salvage") + " ")
+
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Key() == tcell.KeyEnter || event.Rune() == 'q' || event.Rune() == 'b' {
+			a.pages.RemovePage("salvage_report")
+			a.showDeviceMenu()
+			return nil
+		}
+		return event
+	})
+
+	a.pages.AddAndSwitchToPage("salvage_report", a.centerBox(view, 70, 20), true)
+}
+
+func (a *App) handleRecover() {
+	if a.isOperationRunning() {
+		return
+	}
+
+	form := tview.NewForm()
+
+	passField := addSecretField(form, T("enter_password"), 40)
+
+	form.AddButton(T("recover_vault"), func() {
+		a.pages.RemovePage("recover_form")
+		if password, ok := a.takeSecret(passField); ok {
+			a.performRecover(password)
+		}
+	})
+
+	form.AddButton(T("cancel"), func() {
+		passField.Destroy()
+		a.pages.RemovePage("recover_form")
+		a.showDeviceMenu()
+	})
+
+	form.SetBorder(true).SetTitle(" " + T("recover_vault") + " ")
+	a.pages.AddAndSwitchToPage("recover_form", a.centerBox(form, 60, 10), true)
+}
+
+func (a *App) performRecover(password *SecureBuffer) {
+	a.setOperationRunning(true)
+
+	progress := a.createProgressView(T("recover_scanning"))
+	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
+
+	go func() {
+		report, err := RecoverVault(a.selected.Path, a.selected.Path, password, func(current, total int64, stage string) {
+			percent := 100
+			if total > 0 {
+				percent = int(float64(current) / float64(total) * 100)
+			}
+			a.updateProgressThrottled(progress, stage, percent, current, total)
+		})
+		password.Destroy()
+
+		a.app.QueueUpdateDraw(func() {
+			a.setOperationRunning(false)
+			a.pages.RemovePage("progress")
+
+			if err != nil {
+				a.showError(fmt.Sprintf("%v", err))
+				return
+			}
+
+			a.lastScan = time.Time{}
+			a.displayRecoverReport(report)
+		})
+	}()
+}
+
+func (a *App) displayRecoverReport(report *RecoverReport) {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+
+	fmt.Fprintf(view, "\n[green]%s[-]", tview.Escape(report.String()))
+
+	view.SetBorder(true).SetTitle(" " + T("recover_vault") + " ")
+
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Key() == tcell.KeyEnter || event.Rune() == 'q' || event.Rune() == 'b' {
+			a.pages.RemovePage("recover_report")
+			a.updateStatusBar(T("success"))
+			a.showDeviceList()
+			return nil
+		}
+		return event
+	})
+
+	a.pages.AddAndSwitchToPage("recover_report", a.centerBox(view, 60, 12), true)
+}
+
+func (a *App) handleJournal(resume bool) {
+	if a.isOperationRunning() {
+		return
+	}
+
+	title := T("journal_rollback")
+	if resume {
+		title = T("journal_resume")
+	}
+
+	form := tview.NewForm()
+
+	form.AddTextView("", T("journal_hint"), 50, 2, true, false)
+
+	passField := addSecretField(form, T("enter_password"), 40)
+
+	form.AddButton(title, func() {
+		a.pages.RemovePage("journal_form")
+		if password, ok := a.takeSecret(passField); ok {
+			a.unlockWith(password, func(keys *VaultKeys) {
+				a.performJournal(resume, keys)
+			})
+		}
+	})
+
+	form.AddButton(T("cancel"), func() {
+		passField.Destroy()
+		a.pages.RemovePage("journal_form")
+		a.showDeviceMenu()
+	})
+
+	form.SetBorder(true).
+		SetTitle(" " + title + " ").
+		SetBorderColor(tcell.ColorYellow)
+
+	a.pages.AddAndSwitchToPage("journal_form", a.centerBox(form, 60, 12), true)
+}
+
+func (a *App) performJournal(resume bool, keys *VaultKeys) {
+	a.setOperationRunning(true)
+
+	progress := a.createProgressView(T("processing"))
+	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
+
+	run := RollbackOperation
+	if resume {
+		run = ResumeOperation
+	}
+
+	go func() {
+		err := run(a.selected.Path, a.selected.DriveID, keys, func(current, total int64, stage string) {
+			percent := 100
+			if total > 0 {
+				percent = int(float64(current) / float64(total) * 100)
+			}
+			a.updateProgressThrottled(progress, stage, percent, current, total)
+		})
+		keys.Destroy()
+
+		a.app.QueueUpdateDraw(func() {
+			a.setOperationRunning(false)
+			a.pages.RemovePage("progress")
+
+			if err != nil {
+				a.showError(fmt.Sprintf("%v", err))
+				return
+			}
+
+			a.lastScan = time.Time{}
+			a.updateStatusBar(T("success"))
+			a.selected = nil
+			a.showDeviceList()
+		})
+	}()
+}
+
+// takeSecret moves what was typed into field out of the form, or shows
+// why no secure memory could be had for it
+func (a *App) takeSecret(field *SecretField) (*SecureBuffer, bool) {
+	secret, err := field.Take()
+	if err != nil {
+		a.showError(err.Error())
+		return nil, false
+	}
+	return secret, true
+}
+
+// unlockWith derives the keys of the selected vault from password in the
+// background and hands them to next, which destroys them
+func (a *App) unlockWith(password *SecureBuffer, next func(keys *VaultKeys)) {
+	a.setOperationRunning(true)
+
+	progress := a.createProgressView(T("please_wait"))
+	fmt.Fprintf(progress, "\n\n[yellow]%s[-]", T("deriving_keys"))
+	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
+
+	go func() {
+		keys, err := OpenVaultKeys(a.selected.Path, password)
+		password.Destroy()
+
+		a.app.QueueUpdateDraw(func() {
+			a.setOperationRunning(false)
+			a.pages.RemovePage("progress")
+
+			if err != nil {
+				a.showError(T("wrong_password"))
+				return
+			}
+			next(keys)
+		})
+	}()
+}
+
+func (a *App) createProgressView(title string) *tview.TextView {
+	progress := tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextAlign(tview.AlignCenter)
+
+	progress.SetBorder(true).
+		SetTitle(" " + title + " ").
+		SetBorderColor(tcell.ColorYellow)
+
+	return progress
+}
+
+func (a *App) handleWipeReport() {
+	if a.isOperationRunning() {
+		return
+	}
+
+	if keys, ok := Sessions.Get(a.selected.DriveID); ok {
+		a.performWipeReport(keys)
+		return
+	}
+
+	form := tview.NewForm()
+
+	passField := addSecretField(form, T("enter_password"), 40)
+
+	form.AddButton(T("wipe_report_view"), func() {
+		a.pages.RemovePage("report_pass_form")
+		if password, ok := a.takeSecret(passField); ok {
+			a.unlockWith(password, a.performWipeReport)
+		}
+	})
+
+	form.AddButton(T("cancel"), func() {
+		passField.Destroy()
+		a.pages.RemovePage("report_pass_form")
+		a.showDeviceMenu()
+	})
+
+	form.SetBorder(true).SetTitle(" " + T("wipe_report_view") + " ")
+	a.pages.AddAndSwitchToPage("report_pass_form", a.centerBox(form, 60, 10), true)
+}
+
+func (a *App) performWipeReport(keys *VaultKeys) {
+	a.setOperationRunning(true)
+
+	progress := a.createProgressView(T("please_wait"))
+	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
+
+	go func() {
+		report, err := LoadWipeReport(a.selected.Path, keys)
+		keys.Destroy()
+
+		a.app.QueueUpdateDraw(func() {
+			a.setOperationRunning(false)
+			a.pages.RemovePage("progress")
+
+			if err != nil {
+				a.showError(fmt.Sprintf("%v", err))
+				return
+			}
+
+			a.displayWipeReport(report)
+		})
+	}()
+}
+
+// displayWipeReport shows a stored report; x exports it to the report folder
+func (a *App) displayWipeReport(report *WipeReport) {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+
+	render := func(note string) {
+		view.Clear()
+		if local, err := VerifyWipeReport(report); err != nil {
+			fmt.Fprintf(view, "\n[red]%s[-]\n", tview.Escape(err.Error()))
+		} else if local {
+			fmt.Fprintf(view, "\n[green]%s[-]\n", T("report_signed"))
+		} else {
+			fmt.Fprintf(view, "\n[yellow]%s[-]\n", T("report_unpinned"))
+		}
+		if note != "" {
+			fmt.Fprintf(view, "[yellow]%s[-]\n", tview.Escape(note))
+		}
+		fmt.Fprintf(view, "\n%s", tview.Escape(report.String()))
+	}
+	render("")
+
+	view.SetBorder(true).SetTitle(" " + T("wipe_report_view") + " — " + T("report_export_key") + " ")
+
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Rune() == 'x' {
+			path, err := ExportWipeReport(report, wipeReportDir())
+			if err != nil {
+				render(err.Error())
+			} else {
+				render(T("report_exported") + ": " + path)
+			}
+			view.ScrollToBeginning()
+			return nil
+		}
+		if event.Key() == tcell.KeyEscape || event.Key() == tcell.KeyEnter || event.Rune() == 'q' || event.Rune() == 'b' {
+			a.pages.RemovePage("wipe_report")
+			a.showDeviceMenu()
+			return nil
+		}
+		return event
+	})
+
+	a.pages.AddAndSwitchToPage("wipe_report", a.centerBox(view, 90, 22), true)
+}
+
+func (a *App) handleAnalyze() {
+	if a.isOperationRunning() {
+		return
+	}
+	a.setOperationRunning(true)
+
+	progress := a.createProgressView(T("stealth_analyzing"))
+	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
+
+	go func() {
+		report, err := AnalyzeDrive(*a.selected, func(current, total int64, stage string) {
+			percent := 100
+			if total > 0 {
+				percent = int(float64(current) / float64(total) * 100)
+			}
+			a.updateProgressThrottled(progress, stage, percent, current, total)
+		})
+
+		a.app.QueueUpdateDraw(func() {
+			a.setOperationRunning(false)
+			a.pages.RemovePage("progress")
+
+			if err != nil {
+				a.showError(fmt.Sprintf("%v", err))
+				return
+			}
+			a.displayAnalysis(report)
+		})
+	}()
+}
+
+func (a *App) displayAnalysis(report *StealthReport) {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+
+	fmt.Fprintf(view, "\n%s", tview.Escape(report.String()))
+
+	view.SetBorder(true).SetTitle(" " + T("stealth_analyze") + " ")
+
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Key() == tcell.KeyEnter || event.Rune() == 'q' || event.Rune() == 'b' {
+			a.pages.RemovePage("stealth_report")
+			a.showDeviceMenu()
+			return nil
+		}
+		return event
+	})
+
+	a.pages.AddAndSwitchToPage("stealth_report", a.centerBox(view, 100, 24), true)
+}
+
+func (a *App) handleCovers() {
+	if a.isOperationRunning() {
+		return
+	}
+	a.setOperationRunning(true)
+
+	progress := a.createProgressView(T("stego_scanning"))
+	a.pages.AddAndSwitchToPage("progress", a.centerBox(progress, 70, 10), true)
+
+	go func() {
+		report := EstimateCovers(a.selected.Path)
+
+		a.app.QueueUpdateDraw(func() {
+			a.setOperationRunning(false)
+			a.pages.RemovePage("progress")
+			a.displayCovers(report)
+		})
+	}()
+}
+
+func (a *App) displayCovers(report *CoverReport) {
+	view := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+
+	fmt.Fprintf(view, "\n%s", tview.Escape(report.String()))
+
+	view.SetBorder(true).SetTitle(" " + T("stego_estimate") + " ")
+
+	view.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Key() == tcell.KeyEnter || event.Rune() == 'q' || event.Rune() == 'b' {
+			a.pages.RemovePage("cover_report")
+			a.showDeviceMenu()
+			return nil
+		}
+		return event
+	})
+
+	a.pages.AddAndSwitchToPage("cover_report", a.centerBox(view, 100, 24), true)
+}
+
+// showNameProfile picks how chunks on the selected drive are named
+func (a *App) showNameProfile() {
+	form := tview.NewForm()
+
+	options := make([]string, len(NameProfiles))
+	current := 0
+	for i, p := range NameProfiles {
+		options[i] = T("name_profile_" + p)
+		if p == driveNameProfile(a.selected.DriveID) {
+			current = i
+		}
+	}
+
+	selected := NameProfiles[current]
+	form.AddDropDown(T("name_profile"), options, current, func(option string, index int) {
+		selected = NameProfiles[index]
+	})
+
+	form.AddButton(T("confirm"), func() {
+		if selected == ProfileMixed {
+			delete(AppConfig.NameProfiles, a.selected.DriveID)
+		} else {
+			AppConfig.NameProfiles[a.selected.DriveID] = selected
+		}
+		SaveConfig()
+		a.pages.RemovePage("name_profile")
+		a.showDeviceMenu()
+	})
+
+	form.AddButton(T("cancel"), func() {
+		a.pages.RemovePage("name_profile")
+		a.showDeviceMenu()
+	})
+
+	form.SetBorder(true).SetTitle(" " + T("name_profile") + " ")
+	a.pages.AddAndSwitchToPage("name_profile", a.centerBox(form, 70, 9), true)
+}
+
+// showSessionPIN asks for the PIN of the file session store. A store that
+// has no file yet gets a new PIN, typed twice. done runs once unlock works.
+func (a *App) showSessionPIN(create bool, unlock func(pin *SecureBuffer) error, done func()) {
+	form := tview.NewForm()
+
+	pinField := addSecretField(form, T("session_pin"), 30)
+	var confirmField *SecretField
+	if create {
+		confirmField = addSecretField(form, T("session_pin_confirm"), 30)
+		form.AddTextView("", T("session_pin_min"), 40, 1, true, false)
+	}
+
+	form.AddButton(T("confirm"), func() {
+		if create {
+			if pinField.Len() < MinPINLength {
+				a.showError(T("session_pin_min"))
+				return
+			}
+			if !pinField.Equal(confirmField) {
+				a.showError(T("password_mismatch"))
+				return
+			}
+		}
+
+		a.pages.RemovePage("session_pin")
+		confirmField.Destroy()
+		pin, ok := a.takeSecret(pinField)
+		if !ok {
+			return
+		}
+		a.updateStatusBar(T("session_pin_checking"))
+		safeGo(func() {
+			err := unlock(pin)
+			pin.Destroy()
+
+			a.app.QueueUpdateDraw(func() {
+				if err != nil {
+					a.updateStatusBar("")
+					a.showError(err.Error())
+					return
+				}
+				done()
+			})
+		})
+	})
+
+	form.AddButton(T("cancel"), func() {
+		pinField.Destroy()
+		confirmField.Destroy()
+		a.pages.RemovePage("session_pin")
+	})
+
+	form.SetBorder(true).
+		SetTitle(" " + T("session_store_file") + " ").
+		SetBorderColor(tcell.ColorYellow)
+
+	height := 9
+	if create {
+		height = 13
+	}
+	a.pages.AddAndSwitchToPage("session_pin", a.centerBox(form, 60, height), true)
+}
+
+// switchSessionStore moves the sessions into the backend called name and
+// then runs done. Opening the keyring can block on D-Bus, so it runs in the
+// background.
+func (a *App) switchSessionStore(name string, done func()) {
+	a.updateStatusBar(T("please_wait"))
+	safeGo(func() {
+		store, err := openSessionStore(name)
+
+		a.app.QueueUpdateDraw(func() {
+			if err != nil {
+				a.updateStatusBar("")
+				a.showError(err.Error())
+				return
+			}
+
+			apply := func() {
+				safeGo(func() {
+					err := Sessions.SwitchStore(name, store)
+					a.app.QueueUpdateDraw(func() {
+						if err != nil {
+							a.updateStatusBar("")
+							a.showError(err.Error())
+							return
+						}
+						SaveConfig()
+						done()
+					})
+				})
+			}
+
+			if ps, ok := store.(pinStore); ok && ps.Locked() {
+				a.showSessionPIN(!ps.Exists(), ps.Unlock, apply)
+				return
+			}
+			apply()
+		})
+	})
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/webdav"
+)
+
+// UnlockedVault keeps a decrypted vault in memory so it can be browsed
+// without writing plaintext to the drive
+type UnlockedVault struct {
+	drivePath string
+	driveID   string
+	keys      *VaultKeys
+	manifest  *VaultManifest
+
+	fs       webdav.FileSystem
+	dirty    bool
+	closed   bool
+	onChange func()
+
+	// mu guards the in-memory tree: file operations hold it shared,
+	// Flush holds it exclusively while taking a snapshot
+	mu      sync.RWMutex
+	flushMu sync.Mutex
+}
+
+var errVaultLocked = errors.New("vault is locked")
+
+// UnlockVault decrypts the vault on drivePath into memory
+func UnlockVault(drivePath, driveID string, keys *VaultKeys, progress ProgressFunc) (*UnlockedVault, error) {
+	manifest, err := loadManifest(drivePath, keys)
+	if err != nil {
+		return nil, errWrongPassword
+	}
+
+	encrypted, err := readVaultData(drivePath, manifest, keys, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	if progress != nil {
+		progress(0, manifest.OriginalSize, T("decrypting"))
+	}
+
+	decrypted, err := keys.Open(encrypted)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	defer SecureZero(decrypted)
+
+	memFS := webdav.NewMemFS()
+	if err := loadArchiveFS(memFS, decrypted); err != nil {
+		return nil, fmt.Errorf("extract failed: %w", err)
+	}
+
+	own, err := keys.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	if progress != nil {
+		progress(manifest.OriginalSize, manifest.OriginalSize, T("done"))
+	}
+
+	return &UnlockedVault{
+		drivePath: drivePath,
+		driveID:   driveID,
+		keys:      own,
+		manifest:  manifest,
+		fs:        memFS,
+	}, nil
+}
+
+// FileSystem returns a view of the vault that records modifications
+func (v *UnlockedVault) FileSystem() webdav.FileSystem {
+	return &trackingFS{vault: v}
+}
+
+// SetChangeCallback registers fn to be called after every modification
+func (v *UnlockedVault) SetChangeCallback(fn func()) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.onChange = fn
+}
+
+// IsDirty reports whether there are changes not yet written to the drive
+func (v *UnlockedVault) IsDirty() bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.dirty
+}
+
+func (v *UnlockedVault) markDirty() {
+	v.dirty = true
+	if v.onChange != nil {
+		go v.onChange()
+	}
+}
+
+// Flush re-encrypts the in-memory tree and writes it back as new chunks
+func (v *UnlockedVault) Flush() error {
+	v.flushMu.Lock()
+	defer v.flushMu.Unlock()
+
+	v.mu.Lock()
+	if v.closed {
+		v.mu.Unlock()
+		return errVaultLocked
+	}
+	if !v.dirty {
+		v.mu.Unlock()
+		return nil
+	}
+
+	var buf bytes.Buffer
+	fileCount, totalSize, err := writeArchiveFS(v.fs, &buf)
+	if err == nil {
+		v.dirty = false
+	}
+	v.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("archive failed: %w", err)
+	}
+
+	archiveData := buf.Bytes()
+	defer SecureZero(archiveData)
+
+	if err := resealVault(v.drivePath, v.manifest, archiveData, fileCount, totalSize, v.keys); err != nil {
+		v.mu.Lock()
+		v.dirty = true
+		v.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// Close flushes pending changes, drops the in-memory tree and zeroes the
+// key. If the changes cannot be written the vault stays open, tree and
+// keys intact, so Close can be called again.
+func (v *UnlockedVault) Close() error {
+	for {
+		if err := v.Flush(); err != nil && !errors.Is(err, errVaultLocked) {
+			return err
+		}
+
+		v.flushMu.Lock()
+		v.mu.Lock()
+		// A write that slipped in after the flush is flushed too
+		if !v.dirty || v.closed {
+			break
+		}
+		v.mu.Unlock()
+		v.flushMu.Unlock()
+	}
+	defer v.flushMu.Unlock()
+	defer v.mu.Unlock()
+
+	if v.closed {
+		return nil
+	}
+
+	v.closed = true
+	v.fs = webdav.NewMemFS()
+	v.keys.Destroy()
+
+	return nil
+}
+
+// trackingFS forwards to the vault tree and marks it dirty on writes
+type trackingFS struct {
+	vault *UnlockedVault
+}
+
+func (t *trackingFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	t.vault.mu.Lock()
+	defer t.vault.mu.Unlock()
+
+	if t.vault.closed {
+		return os.ErrClosed
+	}
+
+	err := t.vault.fs.Mkdir(ctx, name, perm)
+	if err == nil {
+		t.vault.markDirty()
+	}
+	return err
+}
+
+func (t *trackingFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	t.vault.mu.Lock()
+	defer t.vault.mu.Unlock()
+
+	if t.vault.closed {
+		return nil, os.ErrClosed
+	}
+
+	// Opening for writing changes nothing by itself; creating a file or
+	// truncating one does
+	created := false
+	if flag&os.O_CREATE != 0 {
+		_, err := t.vault.fs.Stat(ctx, name)
+		created = os.IsNotExist(err)
+	}
+
+	f, err := t.vault.fs.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	if created || flag&os.O_TRUNC != 0 {
+		t.vault.markDirty()
+	}
+
+	return &trackingFile{File: f, vault: t.vault}, nil
+}
+
+func (t *trackingFS) RemoveAll(ctx context.Context, name string) error {
+	t.vault.mu.Lock()
+	defer t.vault.mu.Unlock()
+
+	if t.vault.closed {
+		return os.ErrClosed
+	}
+
+	err := t.vault.fs.RemoveAll(ctx, name)
+	if err == nil {
+		t.vault.markDirty()
+	}
+	return err
+}
+
+func (t *trackingFS) Rename(ctx context.Context, oldName, newName string) error {
+	t.vault.mu.Lock()
+	defer t.vault.mu.Unlock()
+
+	if t.vault.closed {
+		return os.ErrClosed
+	}
+
+	err := t.vault.fs.Rename(ctx, oldName, newName)
+	if err == nil {
+		t.vault.markDirty()
+	}
+	return err
+}
+
+func (t *trackingFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	t.vault.mu.RLock()
+	defer t.vault.mu.RUnlock()
+
+	if t.vault.closed {
+		return nil, os.ErrClosed
+	}
+
+	return t.vault.fs.Stat(ctx, name)
+}
+
+type trackingFile struct {
+	webdav.File
+	vault *UnlockedVault
+}
+
+func (f *trackingFile) Read(p []byte) (int, error) {
+	f.vault.mu.RLock()
+	defer f.vault.mu.RUnlock()
+
+	if f.vault.closed {
+		return 0, os.ErrClosed
+	}
+
+	return f.File.Read(p)
+}
+
+func (f *trackingFile) Write(p []byte) (int, error) {
+	f.vault.mu.Lock()
+	defer f.vault.mu.Unlock()
+
+	if f.vault.closed {
+		return 0, os.ErrClosed
+	}
+
+	n, err := f.File.Write(p)
+	if n > 0 {
+		f.vault.markDirty()
+	}
+	return n, err
+}
+
+// loadArchiveFS unpacks a tar.gz archive into an in-memory file system
+func loadArchiveFS(memFS webdav.FileSystem, archiveData []byte) error {
+	ctx := context.Background()
+
+	gzReader, err := gzip.NewReader(bytes.NewReader(archiveData))
+	if err != nil {
+		return err
+	}
+	defer gzReader.Close()
+
+	tarReader := tar.NewReader(gzReader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean("/" + strings.ReplaceAll(header.Name, "\\", "/"))
+		if name == "/" {
+			continue
+		}
+
+		if err := mkdirAllFS(ctx, memFS, path.Dir(name)); err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := mkdirAllFS(ctx, memFS, name); err != nil {
+				return err
+			}
+
+		case tar.TypeReg:
+			f, err := memFS.OpenFile(ctx, name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+			if err != nil {
+				return err
+			}
+
+			_, err = io.Copy(f, tarReader)
+			f.Close()
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeArchiveFS packs an in-memory file system into a tar.gz stream
+func writeArchiveFS(memFS webdav.FileSystem, w io.Writer) (int, int64, error) {
+	ctx := context.Background()
+
+	segWriter := newSegmentWriter(w)
+	tarWriter := tar.NewWriter(segWriter)
+
+	var fileCount int
+	var totalSize int64
+
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		d, err := memFS.OpenFile(ctx, dir, os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		entries, err := d.Readdir(-1)
+		d.Close()
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name() < entries[j].Name()
+		})
+
+		for _, e := range entries {
+			full := path.Join(dir, e.Name())
+			rel := strings.TrimPrefix(full, "/")
+
+			header, err := tar.FileInfoHeader(e, "")
+			if err != nil {
+				return err
+			}
+			header.Name = rel
+
+			if e.IsDir() {
+				header.Name = rel + "/"
+				if err := tarWriter.WriteHeader(header); err != nil {
+					return err
+				}
+				if err := walk(full); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if !e.Mode().IsRegular() {
+				continue
+			}
+
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+
+			f, err := memFS.OpenFile(ctx, full, os.O_RDONLY, 0)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(tarWriter, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+
+			fileCount++
+			totalSize += e.Size()
+
+			if err := tarWriter.Flush(); err != nil {
+				return err
+			}
+			if err := segWriter.Cut(); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk("/"); err != nil {
+		return 0, 0, err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return 0, 0, err
+	}
+	if err := segWriter.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	return fileCount, totalSize, nil
+}
+
+func mkdirAllFS(ctx context.Context, memFS webdav.FileSystem, dir string) error {
+	if dir == "/" || dir == "." {
+		return nil
+	}
+
+	if info, err := memFS.Stat(ctx, dir); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s: %w", dir, fs.ErrExist)
+		}
+		return nil
+	}
+
+	if err := mkdirAllFS(ctx, memFS, path.Dir(dir)); err != nil {
+		return err
+	}
+
+	return memFS.Mkdir(ctx, dir, 0755)
+}
@@ -2,15 +2,19 @@ package main
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"os"
 	"path/filepath"
-	"sort"
+	"runtime"
 	"strings"
 	"time"
 )
@@ -19,6 +23,15 @@ type ChunkInfo struct {
 	Name string `json:"n"`
 	Size int64  `json:"s"`
 	HMAC []byte `json:"h"`
+
+	// Raw is the size of a wrapped chunk inside its container, 0 when the
+	// chunk is stored as is
+	Raw int64 `json:"r,omitempty"`
+
+	// Cover is the format of the cover file a stego chunk hides in, and
+	// Seed picks the samples that carry it
+	Cover string `json:"cv,omitempty"`
+	Seed  int64  `json:"sd,omitempty"`
 }
 
 type VaultManifest struct {
@@ -38,6 +51,28 @@ type VaultManifest struct {
 	
 	ChunkNames  []string `json:"cn,omitempty"`
 	ChunkSizes  []int64  `json:"cs,omitempty"`
+
+	// ChunkHeaders is set when every chunk starts with a chunk header
+	ChunkHeaders bool `json:"ch,omitempty"`
+
+	// KeyedHMAC is set when chunk HMACs use the key derived from the
+	// master key. Older vaults derive it from the password alone.
+	KeyedHMAC bool `json:"kh,omitempty"`
+
+	// Profile is the chunk naming profile, kept so resealing names new
+	// chunks the same way
+	Profile string `json:"np,omitempty"`
+
+	// Decoys lists the decoy files so only they are removed later. Older
+	// vaults only set HasDecoy.
+	Decoys []string `json:"dc,omitempty"`
+
+	// Stego vaults hide their chunks in cover files instead of writing
+	// chunk files
+	Stego bool `json:"sg,omitempty"`
+
+	// WipeReport describes how the originals were destroyed
+	WipeReport *WipeReport `json:"wr,omitempty"`
 }
 
 type ProgressFunc func(current, total int64, stage string)
@@ -48,7 +83,11 @@ var chunkExtensions = []string{
 	".crdownload", ".partial", ".!ut", ".bc!", ".aria2",
 }
 
-func EncryptDrive(drivePath, driveID, password string, progress ProgressFunc) error {
+func EncryptDrive(drivePath, driveID string, keys *VaultKeys, progress ProgressFunc) error {
+	if HasJournal(drivePath) {
+		return ErrInterrupted
+	}
+
 	exclusions := loadExclusions(drivePath)
 
 	files, err := scanFiles(drivePath, exclusions)
@@ -69,24 +108,40 @@ func EncryptDrive(drivePath, driveID, password string, progress ProgressFunc) er
 		progress(0, totalSize, T("compressing"))
 	}
 
-	archivePath := filepath.Join(drivePath, ".tmp_"+RandomHex(8))
-	if err := createArchive(files, drivePath, archivePath, progress, totalSize); err != nil {
-		return fmt.Errorf("archive failed: %w", err)
+	j, err := beginJournal(drivePath, JournalEncrypt, PhaseSealing, keys)
+	if err != nil {
+		return fmt.Errorf("journal failed: %w", err)
+	}
+
+	// Until the manifest is written the originals are untouched, so any
+	// failure simply removes what was created
+	abort := func(err error) error {
+		j.removeCreated()
+		os.Remove(filepath.Join(drivePath, ManifestFile))
+		j.finish()
+		return err
+	}
+
+	// The archive is built in memory, so the drive only needs room for the
+	// vault itself
+	var archive bytes.Buffer
+	if err := createArchive(files, drivePath, &archive, progress, totalSize); err != nil {
+		return abort(fmt.Errorf("archive failed: %w", err))
 	}
-	defer os.Remove(archivePath)
+	archiveData := archive.Bytes()
+	defer SecureZero(archiveData)
 
-	archiveData, err := os.ReadFile(archivePath)
-	if err != nil {
-		return fmt.Errorf("read archive failed: %w", err)
+	if err := preflightEncrypt(drivePath, driveNameProfile(driveID), int64(len(archiveData))); err != nil {
+		return abort(err)
 	}
 
 	if progress != nil {
 		progress(totalSize/2, totalSize, T("encrypting"))
 	}
 
-	encrypted, err := Encrypt(archiveData, password)
+	encrypted, err := keys.Seal(archiveData)
 	if err != nil {
-		return fmt.Errorf("encryption failed: %w", err)
+		return abort(fmt.Errorf("encryption failed: %w", err))
 	}
 
 	manifest := &VaultManifest{
@@ -97,7 +152,9 @@ func EncryptDrive(drivePath, driveID, password string, progress ProgressFunc) er
 		FileCount:     len(files),
 		Files:         make(map[string]string),
 		DoubleEncrypt: AppConfig.DoubleEncrypt,
-		UseChunks:     AppConfig.UseChunks,
+		UseChunks:     AppConfig.UseChunks || AppConfig.Stego,
+		Stego:         AppConfig.Stego,
+		Profile:       driveNameProfile(driveID),
 	}
 
 	manifest.Salt, _ = GenerateSalt()
@@ -108,58 +165,269 @@ func EncryptDrive(drivePath, driveID, password string, progress ProgressFunc) er
 		manifest.HasDecoy = true
 	}
 
-	if AppConfig.UseChunks {
-		if err := writeChunks(drivePath, encrypted, manifest, password); err != nil {
-			return fmt.Errorf("write chunks failed: %w", err)
+	st := newChunkStore(drivePath, manifest, nil)
+	if err := writeVaultWithDecoys(drivePath, encrypted, manifest, keys, st, j, decoyFiles); err != nil {
+		return abort(err)
+	}
+
+	if err := saveManifest(drivePath, manifest, keys); err != nil {
+		return abort(err)
+	}
+
+	if progress != nil {
+		progress(totalSize*5/8, totalSize, T("verifying"))
+	}
+
+	// Nothing is wiped unless every original can be read back from the vault
+	if err := verifyRoundTrip(drivePath, manifest, keys, files); err != nil {
+		return abort(err)
+	}
+
+	for _, f := range files {
+		j.Files = append(j.Files, filepath.ToSlash(f.Name()))
+	}
+	if err := j.setPhase(PhaseWiping); err != nil {
+		return abort(err)
+	}
+
+	if progress != nil {
+		progress(totalSize*3/4, totalSize, T("wiping"))
+	}
+
+	err = wipeOriginals(drivePath, driveID, j.Files, manifest, keys)
+
+	j.finish()
+	Sessions.Clear(driveID)
+
+	if progress != nil {
+		progress(totalSize, totalSize, T("done"))
+	}
+
+	return err
+}
+
+// wipeOriginals removes the encrypted originals, given as slash-separated
+// drive-relative names, and the directories they leave empty. Names that
+// are already gone are skipped, so a resumed run can call it again.
+func wipeOriginals(drivePath, driveID string, names []string, manifest *VaultManifest, keys *VaultKeys) error {
+	report := newWipeReport(JournalEncrypt, drivePath, driveID)
+	var failed []WipeResult
+	var times []time.Time
+	for _, name := range names {
+		path := filepath.Join(drivePath, filepath.FromSlash(name))
+		info, err := os.Lstat(path)
+		if err != nil {
+			continue
 		}
-	} else {
-		vaultName := RandomHex(16)
-		vaultPath := filepath.Join(drivePath, "."+vaultName)
-		if err := os.WriteFile(vaultPath, encrypted, 0644); err != nil {
-			return err
+		times = append(times, info.ModTime())
+
+		res := removeOriginal(path, info.Size())
+		report.add(drivePath, res)
+		if res.Err != nil {
+			failed = append(failed, res)
 		}
-		manifest.Files["__vault__"] = vaultName
 	}
 
-	for _, name := range decoyFiles {
-		decoyPath := filepath.Join(drivePath, "."+name)
-		decoyData := generateDecoyData()
-		os.WriteFile(decoyPath, decoyData, 0644)
+	removePlacedDirs(drivePath, names)
+
+	// The report goes into the manifest before the journal is dropped
+	var reportErr error
+	if report != nil {
+		reportErr = storeWipeReport(report, drivePath, manifest, keys)
 	}
 
-	manifestData, _ := json.Marshal(manifest)
-	encManifest, err := Encrypt(manifestData, password)
-	if err != nil {
+	scrambleTimes(drivePath, manifest, times)
+
+	if len(failed) > 0 {
+		return &WipeError{Failed: failed}
+	}
+	return reportErr
+}
+
+// chunkStore is what writing vault pieces needs besides the manifest: how
+// to size chunks and, for stego vaults, the covers to hide them in
+type chunkStore struct {
+	sizes  *sizer
+	covers []Cover
+}
+
+// newChunkStore prepares a store for manifest. inUse lists the files of the
+// vault currently on the drive, which are neither sampled nor reused.
+func newChunkStore(drivePath string, manifest *VaultManifest, inUse []string) *chunkStore {
+	st := &chunkStore{sizes: newSizer(drivePath, inUse)}
+	if manifest.Stego {
+		st.covers = FindCovers(drivePath, inUse)
+	}
+	return st
+}
+
+// writeVaultWithDecoys writes the vault pieces and the named decoys mixed
+// together, recording the decoys in the manifest
+func writeVaultWithDecoys(drivePath string, encrypted []byte, manifest *VaultManifest, keys *VaultKeys, st *chunkStore, j *Journal, decoyFiles []string) error {
+	p := newPlacer(drivePath, manifest, j)
+	writeDecoys := func(n int) error {
+		for ; n > 0 && len(decoyFiles) > 0; n-- {
+			name := decoyFiles[0]
+			decoyFiles = decoyFiles[1:]
+
+			decoyName, err := p.place("." + name)
+			if err != nil {
+				return err
+			}
+			if err := j.addCreated(decoyName); err != nil {
+				return err
+			}
+			manifest.Decoys = append(manifest.Decoys, decoyName)
+			decoyPath := filepath.Join(drivePath, decoyName)
+			decoyData := generateDecoyData(name, st.sizes.decoySize(name))
+			os.WriteFile(decoyPath, decoyData, 0644)
+		}
+		return nil
+	}
+
+	// Decoys are written between chunks so the creation order does not
+	// show where the vault is
+	perChunk := len(decoyFiles)
+	if manifest.UseChunks {
+		smallest, largest := chunkSizeRange(manifest.Profile)
+		typical := int(math.Sqrt(float64(smallest) * float64(largest)))
+		perChunk /= len(encrypted)/typical + 1
+	}
+	interleave := func() error {
+		return writeDecoys(randomIntN(2*perChunk + 1))
+	}
+
+	if err := writeVaultData(drivePath, encrypted, manifest, keys, st, j, interleave); err != nil {
 		return err
 	}
-	if err := os.WriteFile(filepath.Join(drivePath, ManifestFile), encManifest, 0644); err != nil {
+	return writeDecoys(len(decoyFiles))
+}
+
+// writeVaultData stores the encrypted payload as chunks or a single vault
+// file, depending on manifest.UseChunks. Every piece starts with a chunk
+// header so the vault can be recovered without its manifest. interleave,
+// if set, runs before each piece is written.
+func writeVaultData(drivePath string, encrypted []byte, manifest *VaultManifest, keys *VaultKeys, st *chunkStore, j *Journal, interleave func() error) error {
+	manifest.ChunkHeaders = true
+	manifest.KeyedHMAC = true
+	defer runtime.KeepAlive(keys)
+
+	headerKey, err := keys.sealKey()
+	if err != nil {
 		return err
 	}
+	defer SecureZero(headerKey)
 
-	if progress != nil {
-		progress(totalSize*3/4, totalSize, T("wiping"))
+	if manifest.Stego {
+		if err := writeCovers(drivePath, encrypted, manifest, keys, headerKey, st.covers, j, interleave); err != nil {
+			return fmt.Errorf("write covers failed: %w", err)
+		}
+		return nil
 	}
 
-	for _, f := range files {
-		path := filepath.Join(drivePath, f.Name())
-		if AppConfig.SecureWipe {
-			SecureDelete(path)
-		} else {
-			os.Remove(path)
+	if manifest.UseChunks {
+		if err := writeChunks(drivePath, encrypted, manifest, keys, headerKey, st.sizes, j, interleave); err != nil {
+			return fmt.Errorf("write chunks failed: %w", err)
 		}
+		return nil
 	}
 
-	removeEmptyDirs(drivePath)
-	Sessions.Clear(driveID)
+	header, err := sealChunkHeader(headerKey, chunkHeader{
+		VaultID: newVaultID(),
+		Index:   0,
+		Total:   1,
+		Size:    int64(len(encrypted)),
+		Sealed:  time.Now().UnixNano(),
+		HMAC:    HMAC256(encrypted, keys.HMAC),
+	})
+	if err != nil {
+		return err
+	}
 
-	if progress != nil {
-		progress(totalSize, totalSize, T("done"))
+	if interleave != nil {
+		if err := interleave(); err != nil {
+			return err
+		}
 	}
 
+	vaultName := RandomHex(16)
+	vaultPath := filepath.Join(drivePath, "."+vaultName)
+	if err := j.addCreated("." + vaultName); err != nil {
+		return err
+	}
+	if _, err := writeChunkFile(vaultPath, "", header, encrypted, keys.HMAC); err != nil {
+		return err
+	}
+	manifest.Files["__vault__"] = vaultName
 	return nil
 }
 
-func writeChunks(drivePath string, data []byte, manifest *VaultManifest, password string) error {
+func writeChunks(drivePath string, data []byte, manifest *VaultManifest, keys *VaultKeys, headerKey []byte, sz *sizer, j *Journal, interleave func() error) error {
+	// Sizes are picked up front so every header can carry the total
+	slots := planChunks(sz, manifest.Profile, len(data))
+
+	vaultID := newVaultID()
+	sealed := time.Now().UnixNano()
+
+	offsets := make([]int, len(slots))
+	for i := 1; i < len(slots); i++ {
+		offsets[i] = offsets[i-1] + slots[i-1].size
+	}
+
+	p := newPlacer(drivePath, manifest, j)
+	chunks := make([]ChunkInfo, len(slots))
+
+	// Chunks are written in random order so creation order and timestamps
+	// do not give the sequence away
+	for _, chunkIndex := range decoyRand().Perm(len(slots)) {
+		if interleave != nil {
+			if err := interleave(); err != nil {
+				return err
+			}
+		}
+
+		thisChunkSize := slots[chunkIndex].size
+		offset := offsets[chunkIndex]
+
+		chunkName, format, err := uniqueChunkName(drivePath, manifest.Profile, slots[chunkIndex], p)
+		if err != nil {
+			return err
+		}
+		chunkPath := filepath.Join(drivePath, chunkName)
+
+		chunkData := data[offset : offset+thisChunkSize]
+
+		header, err := sealChunkHeader(headerKey, chunkHeader{
+			VaultID: vaultID,
+			Index:   uint32(chunkIndex),
+			Total:   uint32(len(slots)),
+			Size:    int64(thisChunkSize),
+			Sealed:  sealed,
+			HMAC:    HMAC256(chunkData, keys.HMAC),
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := j.addCreated(chunkName); err != nil {
+			return err
+		}
+		info, err := writeChunkFile(chunkPath, format, header, chunkData, keys.HMAC)
+		if err != nil {
+			return err
+		}
+		info.Name = chunkName
+		chunks[chunkIndex] = info
+	}
+
+	manifest.Chunks = chunks
+	manifest.TotalChunks = len(slots)
+	return nil
+}
+
+// chunkSettings returns the configured chunk size and variance, clamped to
+// the supported range
+func chunkSettings() (int, int) {
 	chunkSize := AppConfig.ChunkSizeMB * 1024 * 1024
 	if chunkSize < MinChunkSize {
 		chunkSize = MinChunkSize
@@ -176,52 +444,47 @@ func writeChunks(drivePath string, data []byte, manifest *VaultManifest, passwor
 		variance = 100
 	}
 
-	hmacKey := DeriveKeyFast(password+"_hmac", []byte("chunk_integrity"))
-	defer SecureZero(hmacKey)
-
-	offset := 0
-	chunkIndex := 0
-	dataLen := len(data)
-
-	for offset < dataLen {
-		thisChunkSize := chunkSize
-		if variance > 0 {
-			varianceRange := int64(chunkSize * variance / 100)
-			if varianceRange > 0 {
-				randVariance, _ := rand.Int(rand.Reader, big.NewInt(varianceRange*2))
-				thisChunkSize = chunkSize - int(varianceRange) + int(randVariance.Int64())
-			}
-		}
+	return chunkSize, variance
+}
 
-		if offset+thisChunkSize > dataLen {
-			thisChunkSize = dataLen - offset
-		}
+// writeChunkFile writes a chunk header followed by its data, wrapped in a
+// container when format is set, and returns its size and HMAC on disk
+func writeChunkFile(path, format string, header, data, hmacKey []byte) (ChunkInfo, error) {
+	var info ChunkInfo
+
+	parts := [][]byte{header, data}
+	if format != "" {
+		raw := make([]byte, 0, len(header)+len(data))
+		raw = append(append(raw, header...), data...)
+		parts = [][]byte{wrapChunk(format, raw)}
+		info.Raw = int64(len(raw))
+	}
 
-		chunkName := generateRandomChunkName()
-		chunkPath := filepath.Join(drivePath, chunkName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return info, err
+	}
 
-		chunkData := data[offset : offset+thisChunkSize]
-		if err := os.WriteFile(chunkPath, chunkData, 0644); err != nil {
-			return err
+	mac := hmac.New(sha256.New, hmacKey)
+	for _, p := range parts {
+		if _, err := f.Write(p); err != nil {
+			f.Close()
+			return info, err
 		}
-
-		chunkHMAC := HMAC256(chunkData, hmacKey)
-
-		manifest.Chunks = append(manifest.Chunks, ChunkInfo{
-			Name: chunkName,
-			Size: int64(thisChunkSize),
-			HMAC: chunkHMAC,
-		})
-
-		offset += thisChunkSize
-		chunkIndex++
+		mac.Write(p)
+		info.Size += int64(len(p))
 	}
+	info.HMAC = mac.Sum(nil)
 
-	manifest.TotalChunks = chunkIndex
-	return nil
+	return info, f.Close()
 }
 
 func generateRandomChunkName() string {
+	return randomChunkName(chunkExtensions[randomIntN(len(chunkExtensions))])
+}
+
+// randomChunkName builds a junk-looking chunk name ending in ext
+func randomChunkName(ext string) string {
 	prefixes := []string{
 		"~$", "~", ".", ".~", "$", "._",
 	}
@@ -233,8 +496,6 @@ func generateRandomChunkName() string {
 		fmt.Sprintf("%d", time.Now().UnixNano()%1000000),
 	}
 
-	ext := chunkExtensions[randomIntN(len(chunkExtensions))]
-
 	prefix := prefixes[randomIntN(len(prefixes))]
 	middle := middles[randomIntN(len(middles))]
 
@@ -250,114 +511,216 @@ func randomIntN(max int) int {
 }
 
 // FIX: Оптимизирована производительность с предварительной аллокацией
-func DecryptDrive(drivePath, driveID, password string, progress ProgressFunc) error {
-	manifest, err := loadManifest(drivePath, password)
+func DecryptDrive(drivePath, driveID string, keys *VaultKeys, progress ProgressFunc) error {
+	if HasJournal(drivePath) {
+		return ErrInterrupted
+	}
+
+	manifest, err := loadManifest(drivePath, keys)
 	if err != nil {
-		return fmt.Errorf("wrong password or corrupted vault")
+		return errWrongPassword
 	}
 
-	var encrypted []byte
+	encrypted, err := readVaultData(drivePath, manifest, keys, progress)
+	if err != nil {
+		return err
+	}
 
-	if manifest.UseChunks && (len(manifest.Chunks) > 0 || len(manifest.ChunkNames) > 0) {
-		if progress != nil {
-			progress(0, manifest.OriginalSize, T("reading_chunks"))
-		}
+	if progress != nil {
+		progress(0, manifest.OriginalSize, T("decrypting"))
+	}
 
-		hmacKey := DeriveKeyFast(password+"_hmac", []byte("chunk_integrity"))
-		defer SecureZero(hmacKey)
+	decrypted, err := keys.Open(encrypted)
+	if err != nil {
+		return ErrDecryptFailed
+	}
 
-		// FIX: Предварительная аллокация для избежания реаллокаций
-		var totalSize int64
-		if len(manifest.Chunks) > 0 {
-			for _, chunk := range manifest.Chunks {
-				totalSize += chunk.Size
-			}
-		} else {
-			for _, size := range manifest.ChunkSizes {
-				totalSize += size
-			}
-		}
-		
-		// FIX: Аллокация заранее
-		encrypted = make([]byte, 0, totalSize)
+	names, extractedSize, err := listArchive(decrypted)
+	if err != nil {
+		return fmt.Errorf("extract failed: %w", err)
+	}
 
-		if len(manifest.Chunks) > 0 {
-			for i, chunk := range manifest.Chunks {
-				chunkPath := filepath.Join(drivePath, chunk.Name)
-				chunkData, err := os.ReadFile(chunkPath)
-				if err != nil {
-					return fmt.Errorf("chunk read failed: %s: %w", chunk.Name, err)
-				}
+	if err := preflightDecrypt(drivePath, extractedSize, len(names)); err != nil {
+		return err
+	}
 
-				if !VerifyHMAC(chunkData, chunk.HMAC, hmacKey) {
-					return fmt.Errorf("chunk integrity check failed: %s", chunk.Name)
-				}
+	j, err := beginJournal(drivePath, JournalDecrypt, PhaseExtracting, keys)
+	if err != nil {
+		return fmt.Errorf("journal failed: %w", err)
+	}
+	j.Manifest = manifest
 
-				encrypted = append(encrypted, chunkData...)
+	// While extracting the vault is intact, so a failure only has to
+	// remove the files and directories written so far
+	abort := func(err error) error {
+		j.removeCreated()
+		j.finish()
+		return err
+	}
 
-				if progress != nil {
-					progress(int64(i+1)*manifest.OriginalSize/int64(len(manifest.Chunks)),
-						manifest.OriginalSize, T("reading_chunks"))
-				}
-			}
-		} else {
-			// Legacy format
-			for i, chunkName := range manifest.ChunkNames {
-				chunkPath := filepath.Join(drivePath, chunkName)
-				chunkData, err := os.ReadFile(chunkPath)
-				if err != nil {
-					return fmt.Errorf("chunk read failed: %s: %w", chunkName, err)
-				}
-				encrypted = append(encrypted, chunkData...)
+	if err := j.save(); err != nil {
+		return abort(err)
+	}
 
-				if progress != nil {
-					progress(int64(i+1)*manifest.OriginalSize/int64(len(manifest.ChunkNames)),
-						manifest.OriginalSize, T("reading_chunks"))
-				}
-			}
-		}
-	} else {
+	if progress != nil {
+		progress(manifest.OriginalSize/2, manifest.OriginalSize, T("extracting"))
+	}
+
+	err = extractArchive(bytes.NewReader(decrypted), drivePath, j)
+	SecureZero(decrypted)
+	if err != nil {
+		return abort(fmt.Errorf("extract failed: %w", err))
+	}
+
+	if err := j.setPhase(PhaseRemoving); err != nil {
+		return abort(err)
+	}
+
+	j.removeVault()
+	j.finish()
+
+	Sessions.Set(driveID, drivePath, keys)
+
+	if progress != nil {
+		progress(manifest.OriginalSize, manifest.OriginalSize, T("done"))
+	}
+
+	return nil
+}
+
+// readVaultData reassembles the encrypted payload described by manifest,
+// verifying chunk HMACs along the way
+func readVaultData(drivePath string, manifest *VaultManifest, keys *VaultKeys, progress ProgressFunc) ([]byte, error) {
+	if !manifest.UseChunks || (len(manifest.Chunks) == 0 && len(manifest.ChunkNames) == 0) {
 		vaultName, ok := manifest.Files["__vault__"]
 		if !ok {
-			return fmt.Errorf("vault file not found")
+			return nil, fmt.Errorf("vault file not found")
 		}
 
-		vaultPath := filepath.Join(drivePath, "."+vaultName)
-		encrypted, err = os.ReadFile(vaultPath)
+		encrypted, err := os.ReadFile(filepath.Join(drivePath, "."+vaultName))
 		if err != nil {
-			return fmt.Errorf("vault read failed: %w", err)
+			return nil, fmt.Errorf("vault read failed: %w", err)
 		}
+		return stripChunkHeader(encrypted, manifest)
 	}
 
 	if progress != nil {
-		progress(0, manifest.OriginalSize, T("decrypting"))
+		progress(0, manifest.OriginalSize, T("reading_chunks"))
 	}
 
-	decrypted, err := Decrypt(encrypted, password)
-	if err != nil {
-		return ErrDecryptFailed
+
+	// FIX: Предварительная аллокация для избежания реаллокаций
+	var totalSize int64
+	if len(manifest.Chunks) > 0 {
+		for _, chunk := range manifest.Chunks {
+			totalSize += chunk.Size
+		}
+	} else {
+		for _, size := range manifest.ChunkSizes {
+			totalSize += size
+		}
 	}
 
-	archivePath := filepath.Join(drivePath, ".tmp_"+RandomHex(8))
-	if err := os.WriteFile(archivePath, decrypted, 0644); err != nil {
-		return err
+	// FIX: Аллокация заранее
+	encrypted := make([]byte, 0, totalSize)
+
+	if len(manifest.Chunks) > 0 {
+		hmacKey, err := keys.hmacFor(manifest)
+		if err != nil {
+			return nil, err
+		}
+		defer SecureZero(hmacKey)
+
+		for i, chunk := range manifest.Chunks {
+			chunkData, err := readChunkFile(drivePath, chunk)
+			if err != nil {
+				return nil, fmt.Errorf("chunk read failed: %s: %w", chunk.Name, err)
+			}
+
+			if !VerifyHMAC(chunkData, chunk.HMAC, hmacKey) {
+				return nil, fmt.Errorf("chunk integrity check failed: %s", chunk.Name)
+			}
+
+			payload, err := chunkPayload(chunkData, chunk, manifest)
+			if err != nil {
+				return nil, fmt.Errorf("chunk read failed: %s: %w", chunk.Name, err)
+			}
+			encrypted = append(encrypted, payload...)
+
+			if progress != nil {
+				progress(int64(i+1)*manifest.OriginalSize/int64(len(manifest.Chunks)),
+					manifest.OriginalSize, T("reading_chunks"))
+			}
+		}
+	} else {
+		// Legacy format
+		for i, chunkName := range manifest.ChunkNames {
+			chunkPath := filepath.Join(drivePath, chunkName)
+			chunkData, err := os.ReadFile(chunkPath)
+			if err != nil {
+				return nil, fmt.Errorf("chunk read failed: %s: %w", chunkName, err)
+			}
+			encrypted = append(encrypted, chunkData...)
+
+			if progress != nil {
+				progress(int64(i+1)*manifest.OriginalSize/int64(len(manifest.ChunkNames)),
+					manifest.OriginalSize, T("reading_chunks"))
+			}
+		}
 	}
 
-	if progress != nil {
-		progress(manifest.OriginalSize/2, manifest.OriginalSize, T("extracting"))
+	return encrypted, nil
+}
+
+// stripChunkHeader drops the chunk header from a piece of vault data
+func stripChunkHeader(data []byte, manifest *VaultManifest) ([]byte, error) {
+	if !manifest.ChunkHeaders {
+		return data, nil
+	}
+	if len(data) < ChunkHeaderSize {
+		return nil, ErrInvalidData
 	}
+	return data[ChunkHeaderSize:], nil
+}
 
-	if err := extractArchive(archivePath, drivePath); err != nil {
-		os.Remove(archivePath)
-		return fmt.Errorf("extract failed: %w", err)
+// readChunkFile returns a chunk as it was written: the chunk file itself,
+// or the piece hidden in a cover
+func readChunkFile(drivePath string, chunk ChunkInfo) ([]byte, error) {
+	if chunk.Cover != "" {
+		return readCover(drivePath, chunk)
+	}
+	return os.ReadFile(filepath.Join(drivePath, chunk.Name))
+}
+
+// chunkPayload unwraps a chunk file if needed and drops its chunk header
+func chunkPayload(data []byte, chunk ChunkInfo, manifest *VaultManifest) ([]byte, error) {
+	if chunk.Raw > 0 {
+		raw, err := unwrapChunk(data)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(raw)) != chunk.Raw {
+			return nil, errBadWrapper
+		}
+		data = raw
 	}
-	os.Remove(archivePath)
+	return stripChunkHeader(data, manifest)
+}
 
+// removeVaultData deletes the chunks or vault file listed in manifest
+func removeVaultData(drivePath string, manifest *VaultManifest) {
 	if manifest.UseChunks {
 		if len(manifest.Chunks) > 0 {
+			var names []string
 			for _, chunk := range manifest.Chunks {
+				// Covers are the user's files and stay
+				if chunk.Cover != "" {
+					continue
+				}
 				os.Remove(filepath.Join(drivePath, chunk.Name))
+				names = append(names, chunk.Name)
 			}
+			removePlacedDirs(drivePath, names)
 		} else {
 			for _, chunkName := range manifest.ChunkNames {
 				os.Remove(filepath.Join(drivePath, chunkName))
@@ -368,63 +731,167 @@ func DecryptDrive(drivePath, driveID, password string, progress ProgressFunc) er
 			os.Remove(filepath.Join(drivePath, "."+vaultName))
 		}
 	}
+}
 
-	os.Remove(filepath.Join(drivePath, ManifestFile))
-	removeDecoyFiles(drivePath)
+// resealVault replaces the vault payload with a freshly encrypted archive.
+// New data and manifest are written before the old payload is removed.
+func resealVault(drivePath string, manifest *VaultManifest, archiveData []byte, fileCount int, originalSize int64, keys *VaultKeys) error {
+	previous := *manifest
+	times := vaultTimes(drivePath, &previous)
 
-	Sessions.Set(driveID, drivePath, password)
+	encrypted, err := keys.Seal(archiveData)
+	if err != nil {
+		return fmt.Errorf("encryption failed: %w", err)
+	}
 
-	if progress != nil {
-		progress(manifest.OriginalSize, manifest.OriginalSize, T("done"))
+	manifest.Files = make(map[string]string)
+	manifest.Chunks = nil
+	manifest.ChunkNames = nil
+	manifest.ChunkSizes = nil
+	manifest.TotalChunks = 0
+	manifest.ChunkHeaders = false
+	manifest.DoubleEncrypt = AppConfig.DoubleEncrypt
+
+	st := newChunkStore(drivePath, manifest, append(vaultFileNames(drivePath, &previous), coverNames(&previous)...))
+	if err := writeVaultData(drivePath, encrypted, manifest, keys, st, nil, nil); err != nil {
+		*manifest = previous
+		return err
+	}
+
+	manifest.Modified = time.Now()
+	manifest.FileCount = fileCount
+	manifest.OriginalSize = originalSize
+
+	if err := saveManifest(drivePath, manifest, keys); err != nil {
+		removeVaultData(drivePath, manifest)
+		*manifest = previous
+		return err
 	}
 
+	removeVaultData(drivePath, &previous)
+	scrambleTimes(drivePath, manifest, times)
 	return nil
 }
 
+// QuickEncrypt seals a drive with its session keys. A drive that is
+// already encrypted is reshuffled instead when AppConfig.Reshuffle is set.
 func QuickEncrypt(drivePath, driveID string, progress ProgressFunc) error {
-	password, ok := Sessions.Get(driveID)
+	keys, ok := Sessions.Get(driveID)
 	if !ok {
 		return fmt.Errorf("no active session")
 	}
+	defer keys.Destroy()
 
-	return EncryptDrive(drivePath, driveID, password, progress)
+	if AppConfig.Reshuffle && checkEncrypted(drivePath) {
+		return ReshuffleVault(drivePath, driveID, keys, progress)
+	}
+	return EncryptDrive(drivePath, driveID, keys, progress)
 }
 
-func ChangePassword(drivePath, driveID, oldPassword, newPassword string) error {
-	Sessions.Set(driveID, drivePath, newPassword)
-	return nil
+// ChangePassword gives the session of a decrypted drive keys derived from
+// newPassword, so the next quick encrypt seals the vault with it
+func ChangePassword(drivePath, driveID string, newPassword *SecureBuffer) error {
+	keys, err := NewVaultKeys(newPassword)
+	if err != nil {
+		return err
+	}
+	defer keys.Destroy()
+	return Sessions.Set(driveID, drivePath, keys)
 }
 
-func EraseVault(drivePath, driveID string) error {
-	entries, _ := os.ReadDir(drivePath)
-	for _, e := range entries {
-		name := e.Name()
-		if len(name) > 0 && (name[0] == '.' || name[0] == '~' || name[0] == '$' || name[0] == '_') {
-			path := filepath.Join(drivePath, name)
-			if AppConfig.SecureWipe {
-				SecureDelete(path)
-			} else {
-				os.Remove(path)
+// vaultFileNames lists every file that belongs to the vault described by
+// manifest, whether or not it still exists
+func vaultFileNames(drivePath string, manifest *VaultManifest) []string {
+	var names []string
+
+	if manifest.UseChunks {
+		for _, chunk := range manifest.Chunks {
+			if chunk.Cover == "" {
+				names = append(names, chunk.Name)
 			}
 		}
+		names = append(names, manifest.ChunkNames...)
+	} else if vaultName, ok := manifest.Files["__vault__"]; ok {
+		names = append(names, "."+vaultName)
 	}
 
+	names = append(names, decoyNames(drivePath, manifest)...)
+	return append(names, ManifestFile, JournalFile)
+}
+
+// PlanErase lists the files EraseVault would delete. Only files recorded in
+// the manifest are included, so unrelated dotfiles like .git stay.
+func PlanErase(drivePath string, keys *VaultKeys) ([]string, error) {
+	manifest, err := loadManifest(drivePath, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []string
+	for _, name := range vaultFileNames(drivePath, manifest) {
+		if _, err := os.Lstat(filepath.Join(drivePath, filepath.FromSlash(name))); err == nil {
+			plan = append(plan, name)
+		}
+	}
+	return plan, nil
+}
+
+// EraseVault deletes the files listed by PlanErase
+func EraseVault(drivePath, driveID string, plan []string) error {
+	report := newWipeReport("erase", drivePath, driveID)
+
+	for _, name := range plan {
+		path := filepath.Join(drivePath, filepath.FromSlash(name))
+		var size int64
+		if info, err := os.Lstat(path); err == nil {
+			size = info.Size()
+		}
+		report.add(drivePath, removeOriginal(path, size))
+	}
+	removePlacedDirs(drivePath, plan)
+
 	Sessions.Clear(driveID)
+
+	// Nothing is left on the drive to hold the report, so it is exported
+	if report != nil {
+		if err := report.sign(); err != nil {
+			return err
+		}
+		if _, err := ExportWipeReport(report, wipeReportDir()); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func GetVaultInfo(drivePath, password string) (*VaultManifest, error) {
-	return loadManifest(drivePath, password)
+func GetVaultInfo(drivePath string, keys *VaultKeys) (*VaultManifest, error) {
+	return loadManifest(drivePath, keys)
 }
 
-func loadManifest(drivePath, password string) (*VaultManifest, error) {
+func saveManifest(drivePath string, manifest *VaultManifest, keys *VaultKeys) error {
+	manifestData, _ := json.Marshal(manifest)
+	encManifest, err := keys.Seal(manifestData)
+	if err != nil {
+		return err
+	}
+
+	// Written through a temporary file, a torn manifest would lose the vault
+	path := filepath.Join(drivePath, ManifestFile)
+	if err := os.WriteFile(path+".tmp", encManifest, 0644); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func loadManifest(drivePath string, keys *VaultKeys) (*VaultManifest, error) {
 	manifestPath := filepath.Join(drivePath, ManifestFile)
 	encrypted, err := os.ReadFile(manifestPath)
 	if err != nil {
 		return nil, err
 	}
 
-	decrypted, err := Decrypt(encrypted, password)
+	decrypted, err := keys.Open(encrypted)
 	if err != nil {
 		return nil, err
 	}
@@ -492,18 +959,9 @@ func (f *fileInfoWithPath) Name() string {
 	return f.path
 }
 
-func createArchive(files []os.FileInfo, root, archivePath string, progress ProgressFunc, totalSize int64) error {
-	file, err := os.Create(archivePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	gzWriter := gzip.NewWriter(file)
-	defer gzWriter.Close()
-
-	tarWriter := tar.NewWriter(gzWriter)
-	defer tarWriter.Close()
+func createArchive(files []os.FileInfo, root string, w io.Writer, progress ProgressFunc, totalSize int64) error {
+	segWriter := newSegmentWriter(w)
+	tarWriter := tar.NewWriter(segWriter)
 
 	var processed int64
 
@@ -539,19 +997,59 @@ func createArchive(files []os.FileInfo, root, archivePath string, progress Progr
 				progress(processed/2, totalSize, T("compressing"))
 			}
 		}
+
+		if err := tarWriter.Flush(); err == nil {
+			segWriter.Cut()
+		}
 	}
 
-	return nil
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return segWriter.Close()
 }
 
-func extractArchive(archivePath, destPath string) error {
-	file, err := os.Open(archivePath)
-	if err != nil {
+// segmentWriter compresses into consecutive gzip members. Cut is called at
+// tar entry boundaries, so every member holds whole entries and salvage can
+// resynchronise on the next member after a damaged range. Multi-member
+// streams are read transparently by gzip.Reader.
+type segmentWriter struct {
+	w       io.Writer
+	gz      *gzip.Writer
+	written int64
+}
+
+func newSegmentWriter(w io.Writer) *segmentWriter {
+	return &segmentWriter{w: w, gz: gzip.NewWriter(w)}
+}
+
+func (s *segmentWriter) Write(p []byte) (int, error) {
+	n, err := s.gz.Write(p)
+	s.written += int64(n)
+	return n, err
+}
+
+// Cut starts a new gzip member once the current one is large enough
+func (s *segmentWriter) Cut() error {
+	if s.written < ArchiveSegmentSize {
+		return nil
+	}
+	if err := s.gz.Close(); err != nil {
 		return err
 	}
-	defer file.Close()
+	s.gz = gzip.NewWriter(s.w)
+	s.written = 0
+	return nil
+}
+
+func (s *segmentWriter) Close() error {
+	return s.gz.Close()
+}
 
-	gzReader, err := gzip.NewReader(file)
+// extractArchive unpacks the vault archive into destPath, recording every
+// directory and file it creates in j first
+func extractArchive(r io.Reader, destPath string, j *Journal) error {
+	gzReader, err := gzip.NewReader(r)
 	if err != nil {
 		return err
 	}
@@ -568,17 +1066,25 @@ func extractArchive(archivePath, destPath string) error {
 			return err
 		}
 
-		targetPath := filepath.Join(destPath, header.Name)
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		targetPath := filepath.Join(destPath, name)
 
-		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+		// A directory that cannot be made or recorded skips the entry;
+		// nothing unrecorded has been created by then
+		if err := j.createDirs(filepath.Dir(name), 0755); err != nil {
 			continue
 		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
-			os.MkdirAll(targetPath, os.FileMode(header.Mode))
+			j.createDirs(name, os.FileMode(header.Mode))
 
 		case tar.TypeReg:
+			if _, err := os.Lstat(targetPath); err != nil {
+				if err := j.addCreated(name); err != nil {
+					return err
+				}
+			}
 			outFile, err := os.Create(targetPath)
 			if err != nil {
 				continue
@@ -598,31 +1104,6 @@ func extractArchive(archivePath, destPath string) error {
 	return nil
 }
 
-func removeEmptyDirs(root string) {
-	var dirs []string
-
-	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil || path == root {
-			return nil
-		}
-		if info.IsDir() {
-			dirs = append(dirs, path)
-		}
-		return nil
-	})
-
-	sort.Slice(dirs, func(i, j int) bool {
-		return strings.Count(dirs[i], string(os.PathSeparator)) > strings.Count(dirs[j], string(os.PathSeparator))
-	})
-
-	for _, dir := range dirs {
-		entries, _ := os.ReadDir(dir)
-		if len(entries) == 0 {
-			os.Remove(dir)
-		}
-	}
-}
-
 func loadExclusions(drivePath string) []string {
 	var exclusions []string
 
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// VerifyReport is the result of checking a vault without decrypting it
+type VerifyReport struct {
+	Chunks     int
+	Healthy    int
+	Missing    []string
+	Corrupted  []string
+	WrongSize  []string
+	Unexpected []string
+	Decoys     int
+}
+
+// OK reports whether every chunk is present and intact
+func (r *VerifyReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Corrupted) == 0 && len(r.WrongSize) == 0
+}
+
+// String formats the report for display
+func (r *VerifyReport) String() string {
+	var b strings.Builder
+
+	status := T("verify_ok")
+	if !r.OK() {
+		status = T("verify_failed")
+	}
+
+	fmt.Fprintf(&b, "%s\n\n", status)
+	fmt.Fprintf(&b, "%s: %d/%d\n", T("verify_healthy"), r.Healthy, r.Chunks)
+	fmt.Fprintf(&b, "%s: %d\n", T("vault_decoys"), r.Decoys)
+
+	sections := []struct {
+		label string
+		names []string
+	}{
+		{T("verify_missing"), r.Missing},
+		{T("verify_corrupted"), r.Corrupted},
+		{T("verify_wrong_size"), r.WrongSize},
+		{T("verify_unexpected"), r.Unexpected},
+	}
+
+	for _, sec := range sections {
+		if len(sec.names) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s (%d):\n", sec.label, len(sec.names))
+		for _, name := range sec.names {
+			fmt.Fprintf(&b, "  %s\n", name)
+		}
+	}
+
+	return b.String()
+}
+
+// VerifyVault checks every chunk of the vault for presence, size and HMAC.
+// Nothing is extracted or deleted.
+func VerifyVault(drivePath string, keys *VaultKeys, progress ProgressFunc) (*VerifyReport, error) {
+	manifest, err := loadManifest(drivePath, keys)
+	if err != nil {
+		return nil, errWrongPassword
+	}
+
+	report := &VerifyReport{}
+	known := map[string]bool{
+		ManifestFile: true,
+		ExcludeFile:  true,
+	}
+
+	type expected struct {
+		name   string
+		size   int64
+		hmac   []byte
+		cover  *ChunkInfo
+		header bool // a single vault file, checked against its chunk header
+	}
+
+	var items []expected
+	if manifest.UseChunks && len(manifest.Chunks) > 0 {
+		for i, c := range manifest.Chunks {
+			item := expected{c.Name, c.Size, c.HMAC, nil, false}
+			if c.Cover != "" {
+				item.cover = &manifest.Chunks[i]
+			}
+			items = append(items, item)
+		}
+	} else if manifest.UseChunks && len(manifest.ChunkNames) > 0 {
+		for i, name := range manifest.ChunkNames {
+			size := int64(-1)
+			if i < len(manifest.ChunkSizes) {
+				size = manifest.ChunkSizes[i]
+			}
+			items = append(items, expected{name, size, nil, nil, false})
+		}
+	} else if vaultName, ok := manifest.Files["__vault__"]; ok {
+		items = append(items, expected{"." + vaultName, -1, nil, nil, manifest.ChunkHeaders})
+	}
+
+	var totalSize int64
+	for _, item := range items {
+		if item.size > 0 {
+			totalSize += item.size
+		}
+	}
+
+	// Vaults too old for chunk HMACs have nothing to check them with
+	var hmacKey []byte
+	if len(manifest.Chunks) > 0 || manifest.ChunkHeaders {
+		if hmacKey, err = keys.hmacFor(manifest); err != nil {
+			return nil, err
+		}
+		defer SecureZero(hmacKey)
+	}
+
+	var processed int64
+	for _, item := range items {
+		known[filepath.ToSlash(item.name)] = true
+		report.Chunks++
+
+		if progress != nil {
+			progress(processed, totalSize, T("verifying"))
+		}
+
+		path := filepath.Join(drivePath, item.name)
+		info, err := os.Stat(path)
+		if err != nil {
+			report.Missing = append(report.Missing, item.name)
+			continue
+		}
+
+		// A cover only holds its chunk in the low bits, which have to be
+		// read out to be checked
+		if item.cover != nil {
+			processed += item.size
+			data, err := readChunkFile(drivePath, *item.cover)
+			if err != nil || !hmac.Equal(HMAC256(data, hmacKey), item.hmac) {
+				report.Corrupted = append(report.Corrupted, item.name)
+				continue
+			}
+			report.Healthy++
+			continue
+		}
+
+		if item.header {
+			processed += info.Size()
+			sizeOK, intact := checkVaultFile(path, info.Size(), keys, hmacKey)
+			switch {
+			case !sizeOK:
+				report.WrongSize = append(report.WrongSize, item.name)
+			case !intact:
+				report.Corrupted = append(report.Corrupted, item.name)
+			default:
+				report.Healthy++
+			}
+			continue
+		}
+
+		if item.size >= 0 && info.Size() != item.size {
+			report.WrongSize = append(report.WrongSize, item.name)
+			processed += item.size
+			continue
+		}
+
+		if item.hmac != nil {
+			f, err := os.Open(path)
+			if err != nil {
+				report.Missing = append(report.Missing, item.name)
+				continue
+			}
+			mac, _, err := HMAC256Reader(f, hmacKey)
+			f.Close()
+
+			if err != nil || !hmac.Equal(mac, item.hmac) {
+				report.Corrupted = append(report.Corrupted, item.name)
+				processed += item.size
+				continue
+			}
+		}
+
+		report.Healthy++
+		processed += info.Size()
+	}
+
+	decoys := decoyNames(drivePath, manifest)
+	for _, name := range decoys {
+		known[name] = true
+	}
+	report.Decoys = len(decoys)
+	report.Unexpected = findUnexpectedFiles(drivePath, known)
+
+	if progress != nil {
+		progress(totalSize, totalSize, T("done"))
+	}
+
+	return report, nil
+}
+
+// checkVaultFile checks a single vault file against its chunk header: the
+// size the header records and the HMAC of the data after it. A header that
+// does not open counts as corrupted.
+func checkVaultFile(path string, size int64, keys *VaultKeys, hmacKey []byte) (sizeOK, intact bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return true, false
+	}
+	defer f.Close()
+
+	raw := make([]byte, ChunkHeaderSize)
+	if _, err := io.ReadFull(f, raw); err != nil {
+		return false, false
+	}
+
+	headerKeys, err := keys.headerKeys()
+	if err != nil {
+		return true, false
+	}
+	defer func() {
+		for _, key := range headerKeys {
+			SecureZero(key)
+		}
+	}()
+	var h *chunkHeader
+	for _, key := range headerKeys {
+		aead, err := chunkHeaderAEAD(key)
+		if err != nil {
+			continue
+		}
+		if opened, ok := openChunkHeader(aead, raw); ok {
+			h = opened
+			break
+		}
+	}
+	if h == nil {
+		return true, false
+	}
+	if h.Size != size-ChunkHeaderSize {
+		return false, false
+	}
+
+	mac, _, err := HMAC256Reader(f, hmacKey)
+	return true, err == nil && hmac.Equal(mac, h.HMAC)
+}
+
+// findUnexpectedFiles lists files on the drive that are neither part of the
+// vault nor excluded
+func findUnexpectedFiles(drivePath string, known map[string]bool) []string {
+	exclusions := loadExclusions(drivePath)
+
+	var unexpected []string
+
+	filepath.Walk(drivePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == drivePath {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(drivePath, path)
+		rel = filepath.ToSlash(rel)
+
+		for _, excl := range exclusions {
+			if matched, _ := filepath.Match(excl, info.Name()); matched || strings.Contains(rel, excl) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if known[rel] {
+			return nil
+		}
+
+		unexpected = append(unexpected, rel)
+		return nil
+	})
+
+	sort.Strings(unexpected)
+	return unexpected
+}
+
+// FileProblem is a file that did not make it into the vault intact
+type FileProblem struct {
+	Name   string
+	Reason string
+}
+
+// RoundTripError is returned by EncryptDrive when the sealed vault does not
+// match the originals. Nothing has been deleted when it is returned.
+type RoundTripError struct {
+	Problems []FileProblem
+}
+
+func (e *RoundTripError) Error() string {
+	var b strings.Builder
+
+	b.WriteString(T("roundtrip_failed"))
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  %s: %s", p.Name, p.Reason)
+	}
+
+	return b.String()
+}
+
+// verifyRoundTrip decrypts the freshly sealed vault and checks that every
+// scanned file is in it with the same size and SHA-256 as on the drive
+func verifyRoundTrip(drivePath string, manifest *VaultManifest, keys *VaultKeys, files []os.FileInfo) error {
+	encrypted, err := readVaultData(drivePath, manifest, keys, nil)
+	if err != nil {
+		return err
+	}
+
+	archive, err := keys.Open(encrypted)
+	if err != nil {
+		return ErrDecryptFailed
+	}
+	defer SecureZero(archive)
+
+	type entry struct {
+		size int64
+		hash []byte
+	}
+	sealed := make(map[string]entry)
+
+	gzReader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return err
+	}
+	defer gzReader.Close()
+
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		h := sha256.New()
+		n, err := io.Copy(h, tarReader)
+		if err != nil {
+			return err
+		}
+		sealed[header.Name] = entry{n, h.Sum(nil)}
+	}
+
+	var problems []FileProblem
+	for _, f := range files {
+		got, ok := sealed[f.Name()]
+		if !ok {
+			problems = append(problems, FileProblem{f.Name(), T("roundtrip_missing")})
+			continue
+		}
+
+		file, err := os.Open(filepath.Join(drivePath, f.Name()))
+		if err != nil {
+			problems = append(problems, FileProblem{f.Name(), T("roundtrip_unreadable")})
+			continue
+		}
+		h := sha256.New()
+		n, err := io.Copy(h, file)
+		file.Close()
+
+		switch {
+		case err != nil:
+			problems = append(problems, FileProblem{f.Name(), T("roundtrip_unreadable")})
+		case n != got.size:
+			problems = append(problems, FileProblem{f.Name(), T("roundtrip_size")})
+		case !bytes.Equal(h.Sum(nil), got.hash):
+			problems = append(problems, FileProblem{f.Name(), T("roundtrip_hash")})
+		}
+	}
+
+	if len(problems) > 0 {
+		return &RoundTripError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// ServeFlushDelay is how long the server waits after the last change before
+// re-sealing the vault
+const ServeFlushDelay = 30 * time.Second
+
+// VaultServer exposes an unlocked vault over WebDAV on the loopback interface
+type VaultServer struct {
+	vault    *UnlockedVault
+	server   *http.Server
+	listener net.Listener
+	token    string
+
+	flushTimer *time.Timer
+	onError    func(error)
+	mu         sync.Mutex
+}
+
+// ServeVault starts a WebDAV server for v on 127.0.0.1:port (0 = random port)
+func ServeVault(v *UnlockedVault, port int) (*VaultServer, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &VaultServer{
+		vault:    v,
+		listener: listener,
+		token:    RandomHex(32),
+	}
+
+	handler := &webdav.Handler{
+		Prefix:     "/" + s.token,
+		FileSystem: v.FileSystem(),
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	s.server = &http.Server{
+		Handler:           s.authorize(handler),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	v.SetChangeCallback(s.scheduleFlush)
+
+	go s.server.Serve(listener)
+
+	return s, nil
+}
+
+// URL returns the address file managers should open, including the token
+func (s *VaultServer) URL() string {
+	return fmt.Sprintf("http://%s/%s/", s.listener.Addr().String(), s.token)
+}
+
+// SetErrorCallback registers fn to be called when a background flush fails
+func (s *VaultServer) SetErrorCallback(fn func(error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onError = fn
+}
+
+// Stop shuts the server down, writes pending changes and locks the vault
+func (s *VaultServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s.server.Shutdown(ctx)
+
+	s.mu.Lock()
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+	}
+	s.mu.Unlock()
+
+	return s.vault.Close()
+}
+
+func (s *VaultServer) authorize(next http.Handler) http.Handler {
+	prefix := "/" + s.token
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := r.URL.Path
+		if len(p) < len(prefix) ||
+			subtle.ConstantTimeCompare([]byte(p[:len(prefix)]), []byte(prefix)) != 1 ||
+			(len(p) > len(prefix) && p[len(prefix)] != '/') {
+			http.NotFound(w, r)
+			return
+		}
+
+		AutoLocker.Touch()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *VaultServer) scheduleFlush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+	}
+
+	s.flushTimer = time.AfterFunc(ServeFlushDelay, func() {
+		err := s.vault.Flush()
+
+		s.mu.Lock()
+		callback := s.onError
+		s.mu.Unlock()
+
+		if err != nil && callback != nil {
+			callback(err)
+		}
+	})
+}
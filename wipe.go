@@ -1,74 +1,272 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/rand"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	// Filler files written by WipeFreeSpace start with this prefix
+	freeSpaceFilePrefix = ".~fill"
+
+	// Filler files stay well below FAT's 4 GB file limit
+	freeSpaceFileSize = 1024 * 1024 * 1024
 )
 
-// SecureDelete overwrites file with random data before deletion
+// Wipe strategies for SecureDelete
+const (
+	WipeRandom = "random" // one pass of random data
+	WipeZero   = "zero"   // one pass of zeros
+	WipeDoD    = "dod"    // zeros, ones, random (DoD 5220.22-M)
+	WipeCustom = "custom" // WipePassCount random passes, then zeros
+)
+
+// WipeStrategies lists the strategies in the order shown in settings
+var WipeStrategies = []string{WipeRandom, WipeZero, WipeDoD, WipeCustom}
+
+// WipeResult is the outcome of wiping a single file
+type WipeResult struct {
+	Path     string
+	Size     int64
+	Passes   int  // passes fully written and synced
+	Verified bool // the last pass was read back and matched
+	Time     time.Time
+	Err      error
+}
+
+// WipeError lists the originals that could not be wiped. The vault itself
+// is complete when EncryptDrive returns it.
+type WipeError struct {
+	Failed []WipeResult
+}
+
+func (e *WipeError) Error() string {
+	lines := make([]string, 0, len(e.Failed)+1)
+	lines = append(lines, fmt.Sprintf("%d file(s) could not be wiped", len(e.Failed)))
+	for _, r := range e.Failed {
+		lines = append(lines, fmt.Sprintf("%s: %v", r.Path, r.Err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wipePass writes either a fixed byte or a random stream. Random passes use
+// a ChaCha20 keystream so the same bytes can be regenerated for read-back.
+type wipePass struct {
+	fill byte
+	seed []byte
+}
+
+func randomPass() wipePass {
+	seed := make([]byte, chacha20.KeySize+chacha20.NonceSize)
+	rand.Read(seed)
+	return wipePass{seed: seed}
+}
+
+// stream returns a function that fills buf with the next bytes of the pass
+func (p wipePass) stream() func(buf []byte) {
+	if p.seed == nil {
+		return func(buf []byte) {
+			for i := range buf {
+				buf[i] = p.fill
+			}
+		}
+	}
+
+	c, _ := chacha20.NewUnauthenticatedCipher(p.seed[:chacha20.KeySize], p.seed[chacha20.KeySize:])
+	return func(buf []byte) {
+		clear(buf)
+		c.XORKeyStream(buf, buf)
+	}
+}
+
+// wipePasses builds the passes for the configured strategy
+func wipePasses() []wipePass {
+	switch AppConfig.WipeStrategy {
+	case WipeRandom:
+		return []wipePass{randomPass()}
+	case WipeZero:
+		return []wipePass{{fill: 0x00}}
+	case WipeDoD:
+		return []wipePass{{fill: 0x00}, {fill: 0xFF}, randomPass()}
+	}
+
+	n := AppConfig.WipePassCount
+	if n < 1 {
+		n = WipePasses
+	}
+	passes := make([]wipePass, 0, n+1)
+	for i := 0; i < n; i++ {
+		passes = append(passes, randomPass())
+	}
+	return append(passes, wipePass{fill: 0x00})
+}
+
+// SecureDelete overwrites a file according to the configured wipe strategy
+// and removes it
 func SecureDelete(path string) error {
+	return WipeFile(path).Err
+}
+
+// WipeFile overwrites and removes a file, reporting every failure. The file
+// is removed even when overwriting fails, so the result says whether its
+// contents may still be recoverable.
+func WipeFile(path string) (res WipeResult) {
+	res.Path = path
+	defer func() { res.Time = time.Now() }()
+
 	info, err := os.Stat(path)
 	if err != nil {
-		return err
+		res.Err = err
+		return res
 	}
 
 	if info.IsDir() {
-		return os.RemoveAll(path)
+		res.Err = os.RemoveAll(path)
+		return res
 	}
 
 	size := info.Size()
+	res.Size = size
+	passes := wipePasses()
 
-	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
 	if err != nil {
-		return os.Remove(path)
+		res.Err = fmt.Errorf("not overwritten: %w", err)
+		os.Remove(path)
+		return res
 	}
 
-	// Multiple passes of random data
-	for pass := 0; pass < WipePasses; pass++ {
-		f.Seek(0, 0)
+	for i, p := range passes {
+		if err := writePass(f, size, p); err != nil {
+			res.Err = fmt.Errorf("pass %d of %d: %w", i+1, len(passes), err)
+			break
+		}
+		res.Passes++
+	}
 
-		// Write in chunks
-		chunkSize := int64(1024 * 1024) // 1 MB
-		buf := make([]byte, chunkSize)
+	if res.Err == nil && AppConfig.WipeVerify {
+		if err := verifyPass(f, size, passes[len(passes)-1]); err != nil {
+			res.Err = fmt.Errorf("verify: %w", err)
+		} else {
+			res.Verified = true
+		}
+	}
 
-		remaining := size
-		for remaining > 0 {
-			writeSize := chunkSize
-			if remaining < chunkSize {
-				writeSize = remaining
-			}
+	if err := f.Close(); err != nil && res.Err == nil {
+		res.Err = err
+	}
+
+	if err := removeWiped(path); err != nil && res.Err == nil {
+		res.Err = err
+	}
 
-			rand.Read(buf[:writeSize])
-			f.Write(buf[:writeSize])
-			remaining -= writeSize
+	return res
+}
+
+// removeOriginal deletes a file, wiping it first when secure wipe is on
+func removeOriginal(path string, size int64) WipeResult {
+	if AppConfig.SecureWipe {
+		return WipeFile(path)
+	}
+	err := os.Remove(path)
+	return WipeResult{Path: path, Size: size, Time: time.Now(), Err: err}
+}
+
+func writePass(f *os.File, size int64, p wipePass) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	next := p.stream()
+	buf := make([]byte, 1024*1024)
+
+	for remaining := size; remaining > 0; {
+		n := int64(len(buf))
+		if remaining < n {
+			n = remaining
+		}
+		next(buf[:n])
+		if _, err := f.Write(buf[:n]); err != nil {
+			return err
 		}
+		remaining -= n
+	}
 
-		f.Sync()
+	return f.Sync()
+}
+
+// verifyPass reads the file back and compares it with the pass. The read may
+// be served from the OS cache, so it proves the writes were accepted rather
+// than what the flash controller did with them.
+func verifyPass(f *os.File, size int64, p wipePass) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
 	}
 
-	// Final pass with zeros
-	f.Seek(0, 0)
-	zeros := make([]byte, 1024*1024)
-	remaining := size
-	for remaining > 0 {
-		writeSize := int64(len(zeros))
-		if remaining < writeSize {
-			writeSize = remaining
+	next := p.stream()
+	want := make([]byte, 1024*1024)
+	got := make([]byte, len(want))
+
+	for offset := int64(0); offset < size; {
+		n := int64(len(want))
+		if size-offset < n {
+			n = size - offset
 		}
-		f.Write(zeros[:writeSize])
-		remaining -= writeSize
+		next(want[:n])
+		if _, err := io.ReadFull(f, got[:n]); err != nil {
+			return err
+		}
+		if !bytes.Equal(want[:n], got[:n]) {
+			return fmt.Errorf("data differs near offset %d", offset)
+		}
+		offset += n
 	}
 
-	f.Sync()
-	f.Close()
+	return nil
+}
 
-	// Rename to random name before deletion
-	newPath := path + "." + RandomHex(8)
-	os.Rename(path, newPath)
+// removeWiped renames a wiped file before deleting it so its name does not
+// stay in the directory entry. In flash-aware mode it is truncated first so
+// its size does not either.
+func removeWiped(path string) error {
+	if AppConfig.WipeFlashAware {
+		if err := os.Truncate(path, 0); err != nil {
+			return fmt.Errorf("truncate: %w", err)
+		}
+	}
+
+	dir, name := filepath.Split(path)
+	newPath := wipedName(dir, len(name))
+	if err := os.Rename(path, newPath); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
 
 	return os.Remove(newPath)
 }
 
+// wipedName picks a random name of the given length in dir that no file
+// has yet, so the rename cannot replace one. Short names run out of
+// combinations quickly; those fall back to a longer name.
+func wipedName(dir string, length int) string {
+	for i := 0; i < 16; i++ {
+		path := filepath.Join(dir, RandomHex(length + 1)[:length])
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			return path
+		}
+	}
+	return filepath.Join(dir, RandomHex(32))
+}
+
 // SecureDeleteDir recursively wipes directory
 func SecureDeleteDir(path string) error {
 	entries, err := os.ReadDir(path)
@@ -95,14 +293,87 @@ func WipeBuffer(buf []byte) {
 	}
 }
 
-// WipeString attempts to wipe string from memory
-func WipeString(s *string) {
-	if s == nil || *s == "" {
-		return
+// WipeFreeSpace fills the free space of a drive with random data, syncs and
+// removes the filler files, so blocks of deleted files cannot be recovered.
+// Cancelling ctx stops early; filler files are removed either way.
+func WipeFreeSpace(ctx context.Context, drivePath string, progress ProgressFunc) error {
+	removeFillerFiles(drivePath)
+
+	usage, err := disk.Usage(drivePath)
+	if err != nil {
+		return err
 	}
+	total := int64(usage.Free)
 
-	// Can't really wipe Go strings, but we can try
-	b := []byte(*s)
-	WipeBuffer(b)
-	*s = ""
+	var fillers []string
+	defer func() {
+		for _, path := range fillers {
+			os.Remove(path)
+		}
+	}()
+
+	buf := make([]byte, 1024*1024)
+	size := len(buf)
+	var written int64
+	full := false
+
+	for !full {
+		path := filepath.Join(drivePath, freeSpaceFilePrefix+RandomHex(8))
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			break
+		}
+		fillers = append(fillers, path)
+
+		var fileWritten int64
+		for fileWritten < freeSpaceFileSize {
+			if err := ctx.Err(); err != nil {
+				f.Close()
+				return err
+			}
+
+			rand.Read(buf[:size])
+			n, err := f.Write(buf[:size])
+			written += int64(n)
+			fileWritten += int64(n)
+
+			if err != nil {
+				// Fill the last few clusters with smaller writes
+				if size > 4096 {
+					size = 4096
+					continue
+				}
+				full = true
+				break
+			}
+
+			if progress != nil {
+				progress(written, total, T("wiping_free_space"))
+			}
+		}
+
+		f.Sync()
+		f.Close()
+	}
+
+	// A write error with space still left is a real failure, not a full drive
+	if usage, err := disk.Usage(drivePath); err == nil && usage.Free > uint64(len(buf))*4 {
+		return fmt.Errorf("free space wipe stopped early with %s left", FormatBytes(usage.Free))
+	}
+
+	if progress != nil {
+		progress(total, total, T("done"))
+	}
+
+	return nil
+}
+
+// removeFillerFiles deletes filler files left by an interrupted wipe
+func removeFillerFiles(drivePath string) {
+	entries, _ := os.ReadDir(drivePath)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), freeSpaceFilePrefix) {
+			os.Remove(filepath.Join(drivePath, e.Name()))
+		}
+	}
 }
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	mrand "math/rand"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Chunk wrappers hide chunk data inside ordinary container files so magic
+// sniffers see a ZIP, PNG or SQLite file that matches the extension. The raw
+// chunk always starts at a multiple of wrapAlign, so recovery from a disk
+// image still finds its header at a sector boundary.
+const (
+	wrapZIP    = "zip"
+	wrapPNG    = "png"
+	wrapSQLite = "sqlite"
+
+	wrapAlign = 512
+
+	// Largest wrapper overhead, used when estimating free space
+	wrapMaxOverhead = 16 * 1024
+
+	// Enough of a wrapped file to locate the chunk inside it
+	wrapPrefixSize = 2 * sqlitePageSize
+)
+
+var wrapFormats = []string{wrapZIP, wrapPNG, wrapSQLite}
+
+var wrapExtensions = map[string][]string{
+	wrapZIP:    {".zip", ".bak"},
+	wrapPNG:    {".png", ".cache", ".tmp"},
+	wrapSQLite: {".db", ".idx", ".sqlite"},
+}
+
+// Names of the single member in ZIP wrappers; all of them are normally
+// stored without compression
+var zipMemberExts = []string{".7z", ".tar.xz", ".jpg", ".mp4", ".tar.gz"}
+
+var errBadWrapper = errors.New("chunk wrapper is damaged")
+
+// newChunkName picks a chunk name from the slot's grammar of profile, or any
+// of its grammars when it has none, and, when wrapping is on, the format that
+// matches its extension
+func newChunkName(profile string, slot chunkSlot) (string, string) {
+	np, ok := nameProfiles[profile]
+	if !ok {
+		if !AppConfig.WrapChunks {
+			if slot.ext != "" {
+				return randomChunkName(slot.ext), ""
+			}
+			return generateRandomChunkName(), ""
+		}
+
+		format := wrapFormats[randomIntN(len(wrapFormats))]
+		exts := wrapExtensions[format]
+		ext := exts[randomIntN(len(exts))]
+		for f, fexts := range wrapExtensions {
+			if slices.Contains(fexts, slot.ext) {
+				format, ext = f, slot.ext
+			}
+		}
+		return randomChunkName(ext), format
+	}
+
+	r := decoyRand()
+	g := slot.grammar
+	if g == nil {
+		g = &np.grammars[r.Intn(len(np.grammars))]
+	}
+	stem, ext := g.name(r)
+
+	// Profiles without a fitting container keep their chunks plain
+	var formats []string
+	for _, f := range wrapFormats {
+		if len(np.wraps[f]) > 0 {
+			formats = append(formats, f)
+		}
+	}
+	if !AppConfig.WrapChunks || len(formats) == 0 {
+		return stem + ext, ""
+	}
+
+	format := pick(r, formats)
+	return stem + pick(r, np.wraps[format]), format
+}
+
+// wrapChunk packs a raw chunk (header and data) into format
+func wrapChunk(format string, raw []byte) []byte {
+	r := decoyRand()
+
+	switch format {
+	case wrapZIP:
+		return wrapZIPChunk(r, raw)
+	case wrapPNG:
+		return wrapPNGChunk(r, raw)
+	case wrapSQLite:
+		return wrapSQLiteChunk(r, raw)
+	}
+	return raw
+}
+
+// unwrapChunk returns the raw chunk inside a wrapped file
+func unwrapChunk(data []byte) ([]byte, error) {
+	offset, length, ok := chunkSpan(data)
+	if !ok || offset+length > int64(len(data)) {
+		return nil, errBadWrapper
+	}
+	return data[offset : offset+length], nil
+}
+
+// chunkSpan locates the raw chunk from the first wrapPrefixSize bytes of a
+// wrapped file
+func chunkSpan(prefix []byte) (int64, int64, bool) {
+	switch {
+	case bytes.HasPrefix(prefix, []byte("PK\x03\x04")):
+		return zipSpan(prefix)
+	case bytes.HasPrefix(prefix, pngSignature):
+		return pngSpan(prefix)
+	case bytes.HasPrefix(prefix, []byte("SQLite format 3\x00")):
+		return sqliteSpan(prefix)
+	}
+	return 0, 0, false
+}
+
+// alignUp rounds n up to a multiple of wrapAlign
+func alignUp(n int) int {
+	return (n + wrapAlign - 1) / wrapAlign * wrapAlign
+}
+
+// dosTime encodes t the way ZIP headers store it
+func dosTime(t time.Time) (uint16, uint16) {
+	tm := uint16(t.Hour()<<11 | t.Minute()<<5 | t.Second()/2)
+	dt := uint16((t.Year()-1980)<<9 | int(t.Month())<<5 | t.Day())
+	return tm, dt
+}
+
+// wrapZIPChunk stores the chunk as the only member of a ZIP archive. The
+// local header is padded with an alignment extra field, like zipalign does.
+func wrapZIPChunk(r *mrand.Rand, raw []byte) []byte {
+	name := pick(r, officeLockWords) + pick(r, zipMemberExts)
+	tm, dt := dosTime(decoyTime(r))
+	crc := crc32.ChecksumIEEE(raw)
+
+	offset := alignUp(30 + len(name) + 6)
+	extra := make([]byte, offset-30-len(name))
+	binary.LittleEndian.PutUint16(extra[0:], 0xD935)
+	binary.LittleEndian.PutUint16(extra[2:], uint16(len(extra)-4))
+	binary.LittleEndian.PutUint16(extra[4:], wrapAlign)
+
+	var b bytes.Buffer
+	le := func(v interface{}) { binary.Write(&b, binary.LittleEndian, v) }
+
+	// Local file header
+	le(uint32(0x04034b50))
+	le([]uint16{20, 0, 0, tm, dt})
+	le([]uint32{crc, uint32(len(raw)), uint32(len(raw))})
+	le([]uint16{uint16(len(name)), uint16(len(extra))})
+	b.WriteString(name)
+	b.Write(extra)
+	b.Write(raw)
+
+	// Central directory
+	cdOffset := b.Len()
+	le(uint32(0x02014b50))
+	le([]uint16{20, 20, 0, 0, tm, dt})
+	le([]uint32{crc, uint32(len(raw)), uint32(len(raw))})
+	le([]uint16{uint16(len(name)), 0, 0, 0, 0})
+	le([]uint32{0, 0})
+	b.WriteString(name)
+	cdSize := b.Len() - cdOffset
+
+	// End of central directory
+	le(uint32(0x06054b50))
+	le([]uint16{0, 0, 1, 1})
+	le([]uint32{uint32(cdSize), uint32(cdOffset)})
+	le(uint16(0))
+
+	return b.Bytes()
+}
+
+func zipSpan(prefix []byte) (int64, int64, bool) {
+	if len(prefix) < 30 || binary.LittleEndian.Uint16(prefix[8:]) != 0 {
+		return 0, 0, false
+	}
+	size := int64(binary.LittleEndian.Uint32(prefix[18:]))
+	offset := 30 + int64(binary.LittleEndian.Uint16(prefix[26:])) + int64(binary.LittleEndian.Uint16(prefix[28:]))
+	return offset, size, true
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// The chunk travels in a private chunk that Adobe Fireworks uses for its
+// own compressed document data
+const pngChunkType = "mkBT"
+
+func pngAppend(b *bytes.Buffer, typ string, data []byte) {
+	binary.Write(b, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	b.WriteString(typ)
+	b.Write(data)
+	binary.Write(b, binary.BigEndian, crc.Sum32())
+}
+
+// wrapPNGChunk builds a small valid image with the chunk in a private
+// chunk. XMP packets are padded with whitespace anyway, which lines the
+// chunk up with wrapAlign.
+func wrapPNGChunk(r *mrand.Rand, raw []byte) []byte {
+	const side = 16
+
+	var b bytes.Buffer
+	b.Write(pngSignature)
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], side)
+	binary.BigEndian.PutUint32(ihdr[4:], side)
+	ihdr[8], ihdr[9] = 8, 2 // 8-bit RGB
+	pngAppend(&b, "IHDR", ihdr)
+
+	xmp := "XML:com.adobe.xmp\x00\x00\x00\x00\x00" +
+		`<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?><x:xmpmeta xmlns:x="adobe:ns:meta/">` +
+		`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description rdf:about="" ` +
+		`xmlns:xmp="http://ns.adobe.com/xap/1.0/"><xmp:CreatorTool>Adobe Fireworks CS6</xmp:CreatorTool>` +
+		`<xmp:CreateDate>` + decoyTime(r).Format(time.RFC3339) + `</xmp:CreateDate></rdf:Description></rdf:RDF></x:xmpmeta>`
+	end := `<?xpacket end="w"?>`
+
+	// iTXt header and trailer, then the private chunk header
+	used := b.Len() + 12 + len(xmp) + len(end) + 8
+	pad := alignUp(used) - used
+	pngAppend(&b, "iTXt", []byte(xmp+strings.Repeat(" ", pad)+end))
+
+	pngAppend(&b, pngChunkType, raw)
+
+	// A flat colour image
+	pixels := make([]byte, 0, side*(1+3*side))
+	color := []byte{byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256))}
+	for y := 0; y < side; y++ {
+		pixels = append(pixels, 0)
+		for x := 0; x < side; x++ {
+			pixels = append(pixels, color...)
+		}
+	}
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(pixels)
+	zw.Close()
+	pngAppend(&b, "IDAT", z.Bytes())
+	pngAppend(&b, "IEND", nil)
+
+	return b.Bytes()
+}
+
+func pngSpan(prefix []byte) (int64, int64, bool) {
+	for pos := len(pngSignature); pos+8 <= len(prefix); {
+		length := int64(binary.BigEndian.Uint32(prefix[pos:]))
+		if string(prefix[pos+4:pos+8]) == pngChunkType {
+			return int64(pos + 8), length, true
+		}
+		pos += 12 + int(length)
+	}
+	return 0, 0, false
+}
+
+// Freelist trunk pages list this many leaf pages each; SQLite before 3.6.0
+// rejects fuller trunks
+const sqliteTrunkLeaves = sqlitePageSize/4 - 8
+
+// sqliteFreePages returns how many trunk and leaf freelist pages hold size
+// bytes
+func sqliteFreePages(size int64) (int, int) {
+	leaves := int((size + sqlitePageSize - 1) / sqlitePageSize)
+	trunks := (leaves + sqliteTrunkLeaves - 1) / sqliteTrunkLeaves
+	return trunks, leaves
+}
+
+// wrapSQLiteChunk builds a database with one small table whose deleted
+// pages sit on the freelist. SQLite never reads freelist leaves, so the
+// chunk is kept there, with its size in the table.
+func wrapSQLiteChunk(r *mrand.Rand, raw []byte) []byte {
+	trunks, leaves := sqliteFreePages(int64(len(raw)))
+	total := 2 + trunks + leaves
+	db := make([]byte, total*sqlitePageSize)
+
+	copy(db, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(db[16:], sqlitePageSize)
+	db[18], db[19] = 1, 1
+	db[21], db[22], db[23] = 64, 32, 32
+	counter := uint32(1 + r.Intn(5000))
+	binary.BigEndian.PutUint32(db[24:], counter)
+	binary.BigEndian.PutUint32(db[28:], uint32(total))
+	binary.BigEndian.PutUint32(db[32:], 3)
+	binary.BigEndian.PutUint32(db[36:], uint32(trunks+leaves))
+	binary.BigEndian.PutUint32(db[40:], uint32(1+r.Intn(50)))
+	binary.BigEndian.PutUint32(db[44:], 4)
+	binary.BigEndian.PutUint32(db[56:], 1)
+	binary.BigEndian.PutUint32(db[92:], counter)
+	binary.BigEndian.PutUint32(db[96:], 3039004)
+
+	schema := "CREATE TABLE blobs(id INTEGER PRIMARY KEY,size INTEGER,created INTEGER)"
+	master := sqliteCell(1, sqliteRecord("table", "blobs", "blobs", int64(2), schema))
+	sqlitePage(db[:sqlitePageSize], 100, 0x0D, [][]byte{master}, 0)
+
+	row := sqliteCell(1, sqliteRecord(nil, int64(len(raw)), decoyTime(r).Unix()))
+	sqlitePage(db[sqlitePageSize:2*sqlitePageSize], 0, 0x0D, [][]byte{row}, 0)
+
+	// Trunks come first, each listing its share of the leaves
+	firstLeaf := 3 + trunks
+	for t := 0; t < trunks; t++ {
+		page := db[(2+t)*sqlitePageSize : (3+t)*sqlitePageSize]
+		if t < trunks-1 {
+			binary.BigEndian.PutUint32(page[0:], uint32(4+t))
+		}
+
+		n := min(sqliteTrunkLeaves, leaves-t*sqliteTrunkLeaves)
+		binary.BigEndian.PutUint32(page[4:], uint32(n))
+		for i := 0; i < n; i++ {
+			binary.BigEndian.PutUint32(page[8+4*i:], uint32(firstLeaf+t*sqliteTrunkLeaves+i))
+		}
+	}
+
+	copy(db[(firstLeaf-1)*sqlitePageSize:], raw)
+	return db
+}
+
+// sqliteReadVarint decodes a varint, returning 0 bytes read on bad input
+func sqliteReadVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 9; i++ {
+		if i == 8 {
+			return v<<8 | uint64(b[i]), 9
+		}
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func sqliteSpan(prefix []byte) (int64, int64, bool) {
+	if len(prefix) < 2*sqlitePageSize || binary.BigEndian.Uint16(prefix[16:]) != sqlitePageSize {
+		return 0, 0, false
+	}
+
+	// The size is the second column of the only row on page 2
+	page := prefix[sqlitePageSize : 2*sqlitePageSize]
+	if page[0] != 0x0D || binary.BigEndian.Uint16(page[3:]) != 1 {
+		return 0, 0, false
+	}
+	cell := int(binary.BigEndian.Uint16(page[8:]))
+	if cell >= len(page) {
+		return 0, 0, false
+	}
+
+	rec := page[cell:]
+	for i := 0; i < 2; i++ { // payload length, rowid
+		_, n := sqliteReadVarint(rec)
+		if n == 0 {
+			return 0, 0, false
+		}
+		rec = rec[n:]
+	}
+
+	hdrLen, n := sqliteReadVarint(rec)
+	if n == 0 || hdrLen < uint64(n) || hdrLen > uint64(len(rec)) {
+		return 0, 0, false
+	}
+	types := rec[n:hdrLen]
+	body := rec[hdrLen:]
+
+	// NULL id, then an 8-byte size
+	if len(types) < 2 || types[0] != 0 || types[1] != 6 || len(body) < 8 {
+		return 0, 0, false
+	}
+	size := int64(binary.BigEndian.Uint64(body))
+
+	trunks, leaves := sqliteFreePages(size)
+	if binary.BigEndian.Uint32(prefix[36:]) != uint32(trunks+leaves) {
+		return 0, 0, false
+	}
+	return int64(2+trunks) * sqlitePageSize, size, true
+}